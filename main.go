@@ -1,32 +1,45 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"io"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/uitachi123/go-plaid/pkg/api"
+	"github.com/uitachi123/go-plaid/pkg/auth"
 	"github.com/uitachi123/go-plaid/pkg/db"
 	"github.com/uitachi123/go-plaid/pkg/echo"
+	"github.com/uitachi123/go-plaid/pkg/logging"
+	"github.com/uitachi123/go-plaid/pkg/metrics"
 	"github.com/uitachi123/go-plaid/pkg/plaid"
+	"github.com/uitachi123/go-plaid/pkg/plaidfake"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-func setUpLogger(level string) *zap.Logger {
+func setUpLogger(level string, redactor *logging.Redactor) *zap.Logger {
 	l, err := zapcore.ParseLevel(strings.ToLower(level))
 	if err != nil {
 		panic(err)
 	}
 	cfg := zap.Config{
-		Level:       zap.NewAtomicLevelAt(l),
-		Encoding:    "json",
-		OutputPaths: []string{"stdout"},
+		Level:         zap.NewAtomicLevelAt(l),
+		Encoding:      "json",
+		EncoderConfig: zap.NewProductionEncoderConfig(),
+		OutputPaths:   []string{"stdout"},
 	}
-	logger, err := cfg.Build()
+	logger, err := cfg.Build(zap.WrapCore(redactor.Core))
 	if err != nil {
 		panic(err)
 	}
@@ -36,10 +49,19 @@ func setUpLogger(level string) *zap.Logger {
 func main() {
 
 	loggingLevel := flag.String("logging", "INFO", "logging level")
-	port := flag.String("port", "8080", "listening port")
-	flag.Parse()
+	fakePlaid := flag.Bool("fake-plaid", false, "serve Plaid API calls from an in-process fake")
+	readTimeout := flag.Duration("read-timeout", 10*time.Second, "maximum duration for reading a request")
+	writeTimeout := flag.Duration("write-timeout", 60*time.Second, "maximum duration before timing out writes of a response")
+	idleTimeout := flag.Duration("idle-timeout", 120*time.Second, "maximum time to wait for the next request on keep-alive connections")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "maximum time to drain in-flight requests on shutdown")
+	seedUsers := flag.Bool("seed-users", false, "create the alice@test.com and bob@test.com test users, with the password of SEED_USERS_PASSWORD if set")
+	openSignup := flag.Bool("open-signup", false, "let anyone sign up with POST /users instead of only the users:admin scope")
+	cfg, err := plaid.LoadConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	logger := setUpLogger(*loggingLevel)
+	logger := setUpLogger(*loggingLevel, logging.NewRedactor(cfg.Secrets()...))
 	defer logger.Sync()
 	logger.Info("Starting web server...",
 		// Structured context as strongly typed Field values.
@@ -47,36 +69,89 @@ func main() {
 		zap.String("logging level", *loggingLevel),
 	)
 
-	_, err := db.Init()
+	store, err := db.NewEmptyStore()
 	if err != nil {
-		logger.Error("Error initializing database", zap.Error(err))
+		logger.Fatal("Error initializing database", zap.Error(err))
+	}
+	if *seedUsers {
+		// the password is not a flag so it does not show up in process lists
+		var hash string
+		if password := os.Getenv("SEED_USERS_PASSWORD"); password != "" {
+			if hash, err = auth.HashPassword(password); err != nil {
+				logger.Fatal("Invalid SEED_USERS_PASSWORD", zap.Error(err))
+			}
+		}
+		if err := store.SeedUsers(hash); err != nil {
+			logger.Fatal("Error creating test users", zap.Error(err))
+		}
+	}
+
+	if *fakePlaid {
+		fake := plaidfake.NewServer()
+		defer fake.Close()
+		cfg.APIURL = fake.URL
+		// the fake accepts any credentials
+		if cfg.ClientID == "" && cfg.Secret == "" {
+			cfg.ClientID, cfg.Secret = "plaidfake", "plaidfake"
+		}
+		logger.Info("Using fake Plaid API", zap.String("url", fake.URL))
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	m := metrics.New(registry)
+	server, err := plaid.NewServer(cfg, store, logger, m)
+	if err != nil {
+		logger.Fatal("Error configuring Plaid", zap.Error(err))
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/echo/", echo.Echo)
-	mux.HandleFunc("/users", api.Users)
+	users := api.NewUsersHandler(store, server.Authenticator(), server, *openSignup)
+	mux.Handle("/users", users)
+	mux.Handle("/users/", users)
+	keys := api.NewAPIKeysHandler(store, server.Authenticator())
+	mux.Handle("/api/keys", keys)
+	mux.Handle("/api/keys/", keys)
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, "OK")
 	})
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 
 	// endpoints for plaid
-	mux.HandleFunc("/api/set_access_token", plaid.GetAccessToken)
-	mux.HandleFunc("/api/create_link_token_for_payment", plaid.CreateLinkTokenForPayment)
-	mux.HandleFunc("/api/auth", plaid.Auth)
-	mux.HandleFunc("/api/accounts", plaid.Accounts)
-	mux.HandleFunc("/api/balance", plaid.Balance)
-	mux.HandleFunc("/api/item", plaid.Item)
-	mux.HandleFunc("/api/identity", plaid.Identity)
-	mux.HandleFunc("/api/transactions", plaid.Transactions)
-	mux.HandleFunc("/api/payment", plaid.Payment)
-	mux.HandleFunc("/api/create_public_token", plaid.CreatePublicToken)
-	mux.HandleFunc("/api/create_link_token", plaid.CreateLinkToken)
-	mux.HandleFunc("/api/investments_transactions", plaid.InvestmentTransactions)
-	mux.HandleFunc("/api/holdings", plaid.Holdings)
-	mux.HandleFunc("/api/assets", plaid.Assets)
-	mux.HandleFunc("/api/transfer", plaid.Transfer)
-	mux.HandleFunc("/api/info", plaid.Info)
+	mux.Handle("/api/", server.Routes())
+
+	httpServer := &http.Server{
+		Addr:         ":" + cfg.Port,
+		Handler:      logging.AccessLog(logger, m.Middleware(mux)),
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  *idleTimeout,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// listen to port
-	http.ListenAndServe(":"+*port, mux)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- httpServer.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		logger.Fatal("Error serving requests", zap.Error(err))
+	case <-ctx.Done():
+	}
+	stop()
+
+	// drain in-flight requests, then cancel whatever is still running
+	logger.Info("Shutting down web server...", zap.Duration("shutdown timeout", *shutdownTimeout))
+	drainCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(drainCtx); err != nil {
+		logger.Warn("Error draining requests", zap.Error(err))
+	}
+	server.Close()
+	logger.Info("Web server stopped")
 }
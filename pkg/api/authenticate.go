@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+// Authenticator authenticates requests with the session cookie of a user or
+// with an API key in an "Authorization: Bearer" header. Sessions have every
+// scope of their user, while API keys only have the scopes they were issued
+// with that their user still has.
+type Authenticator struct {
+	sessions *auth.Sessions
+	store    *db.Store
+	// admins are the emails of the users with the users:admin scope
+	admins map[string]bool
+}
+
+// NewAuthenticator returns an authenticator of the users of store, granting
+// users:admin to the users of admins.
+func NewAuthenticator(sessions *auth.Sessions, store *db.Store, admins []string) *Authenticator {
+	a := &Authenticator{sessions: sessions, store: store, admins: map[string]bool{}}
+	for _, email := range admins {
+		a.admins[email] = true
+	}
+	return a
+}
+
+// Principal authenticates r.
+func (a *Authenticator) Principal(r *http.Request) (*auth.Principal, error) {
+	if key := auth.BearerAPIKey(r); key != "" {
+		k, err := a.store.FindAPIKey(auth.HashAPIKey(key))
+		if err == db.ErrNotFound {
+			return nil, auth.ErrInvalidAPIKey
+		} else if err != nil {
+			return nil, err
+		}
+		p := &auth.Principal{User: k.User, APIKeyID: k.ID}
+		for _, scope := range k.Scopes {
+			if a.userHasScope(k.User, scope) {
+				p.Scopes = append(p.Scopes, scope)
+			}
+		}
+		return p, nil
+	}
+	email, err := a.sessions.User(r)
+	if err != nil {
+		return nil, err
+	}
+	// users deleted since they logged in lose their sessions
+	if _, err := a.store.GetUser(email); err == db.ErrNotFound {
+		return nil, auth.ErrInvalidSession
+	} else if err != nil {
+		return nil, err
+	}
+	return &auth.Principal{User: email, Scopes: auth.UserScopes(a.admins[email])}, nil
+}
+
+func (a *Authenticator) userHasScope(email, scope string) bool {
+	return auth.ValidScope(scope) && (scope != auth.ScopeUsersAdmin || a.admins[email])
+}
+
+// Require serves next only to authenticated requests with scope, or to any
+// authenticated request if scope is empty. The principal of the request is
+// put in its context for auth.PrincipalFrom.
+func (a *Authenticator) Require(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Principal(r)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		if scope != "" && !p.HasScope(scope) {
+			WriteError(w, insufficientScope(scope))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+	})
+}
+
+// RequireSession serves next only to requests authenticated with a session,
+// e.g. to keep API keys from issuing other keys.
+func (a *Authenticator) RequireSession(next http.Handler) http.Handler {
+	return a.Require("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.PrincipalFrom(r.Context()).APIKeyID != "" {
+			WriteError(w, Forbidden("this endpoint requires a session"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// CheckScope returns an error answered with 403 if the principal of the
+// request context lacks scope, for handlers needing more scopes depending
+// on the request.
+func CheckScope(r *http.Request, scope string) error {
+	if p := auth.PrincipalFrom(r.Context()); p == nil || !p.HasScope(scope) {
+		return insufficientScope(scope)
+	}
+	return nil
+}
+
+func insufficientScope(scope string) *Error {
+	return NewError(http.StatusForbidden, "INVALID_REQUEST", "INSUFFICIENT_SCOPE", "the "+scope+" scope is required")
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+func Test_Authenticator(t *testing.T) {
+	store, _ := db.NewEmptyStore()
+	store.SeedUsers("")
+	key, _ := auth.GenerateKey()
+	sessions := auth.NewSessions(key, time.Hour)
+	authn := NewAuthenticator(sessions, store, []string{"alice@test.com"})
+	keys := map[string]string{}
+	for _, k := range []*db.APIKey{
+		{ID: "exports", User: "bob@test.com", Scopes: []string{auth.ScopeTransactionsRead}},
+		// users:admin is dropped from keys of users that are not admins
+		{ID: "escalated", User: "bob@test.com", Scopes: []string{auth.ScopeTransactionsRead, auth.ScopeUsersAdmin}},
+		{ID: "admin", User: "alice@test.com", Scopes: []string{auth.ScopeUsersAdmin}},
+	} {
+		keys[k.ID], _ = auth.GenerateAPIKey()
+		k.Hash = auth.HashAPIKey(keys[k.ID])
+		store.SaveAPIKey(k)
+	}
+	whoami := func(scope string) http.Handler {
+		return authn.Require(scope, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := auth.PrincipalFrom(r.Context())
+			io.WriteString(w, p.User+" "+p.APIKeyID)
+		}))
+	}
+
+	tests := []struct {
+		session, key, scope string
+		code                int
+		expected            string
+	}{
+		{"", "", "", http.StatusUnauthorized, ""},
+		{"", "gpk_unknown", "", http.StatusUnauthorized, ""},
+		{"", keys["exports"], "", http.StatusOK, "bob@test.com exports"},
+		{"", keys["exports"], auth.ScopeTransactionsRead, http.StatusOK, "bob@test.com exports"},
+		{"", keys["exports"], auth.ScopeTransferWrite, http.StatusForbidden, ""},
+		{"", keys["escalated"], auth.ScopeUsersAdmin, http.StatusForbidden, ""},
+		{"", keys["admin"], auth.ScopeUsersAdmin, http.StatusOK, "alice@test.com admin"},
+		{"bob@test.com", "", auth.ScopeTransferWrite, http.StatusOK, "bob@test.com "},
+		{"bob@test.com", "", auth.ScopeUsersAdmin, http.StatusForbidden, ""},
+		{"alice@test.com", "", auth.ScopeUsersAdmin, http.StatusOK, "alice@test.com "},
+		// the key is used over the session
+		{"alice@test.com", keys["exports"], "", http.StatusOK, "bob@test.com exports"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/api/transactions", nil)
+		if test.session != "" {
+			req.AddCookie(sessions.Cookie(test.session))
+		}
+		if test.key != "" {
+			req.Header.Set("Authorization", "Bearer "+test.key)
+		}
+		w := httptest.NewRecorder()
+		whoami(test.scope).ServeHTTP(w, req)
+		if w.Code != test.code || (test.expected != "" && w.Body.String() != test.expected) {
+			t.Errorf("%v %v: Expected %v %v\tGot %v %v", test.session, test.scope, test.code, test.expected, w.Code, strings.TrimSpace(w.Body.String()))
+		}
+	}
+
+	// API keys can not be used where a session is required
+	req := httptest.NewRequest("GET", "/api/keys", nil)
+	req.Header.Set("Authorization", "Bearer "+keys["exports"])
+	w := httptest.NewRecorder()
+	authn.RequireSession(whoami("")).ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected %v\tGot %v", http.StatusForbidden, w.Code)
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+// Error is the JSON error returned by the API. It has the fields of a Plaid
+// error so the UI renders errors from Plaid and from this server alike.
+type Error struct {
+	StatusCode     int     `json:"status_code"`
+	ErrorType      string  `json:"error_type"`
+	ErrorCode      string  `json:"error_code"`
+	ErrorMessage   string  `json:"error_message"`
+	DisplayMessage *string `json:"display_message"`
+	RequestID      string  `json:"request_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.ErrorMessage
+}
+
+// NewError returns an error of this server answered with the given status.
+func NewError(status int, errorType, errorCode, message string) *Error {
+	return &Error{
+		StatusCode:   status,
+		ErrorType:    errorType,
+		ErrorCode:    errorCode,
+		ErrorMessage: message,
+	}
+}
+
+// BadRequest returns an INVALID_REQUEST error answered with 400.
+func BadRequest(errorCode, message string) *Error {
+	return NewError(http.StatusBadRequest, "INVALID_REQUEST", errorCode, message)
+}
+
+// NotFound returns an INVALID_INPUT error answered with 404.
+func NotFound(errorCode, message string) *Error {
+	return NewError(http.StatusNotFound, "INVALID_INPUT", errorCode, message)
+}
+
+// Forbidden returns an INVALID_REQUEST error answered with 403.
+func Forbidden(message string) *Error {
+	return NewError(http.StatusForbidden, "INVALID_REQUEST", "FORBIDDEN", message)
+}
+
+// MethodNotAllowed is returned for requests with an unsupported method.
+var MethodNotAllowed = NewError(http.StatusMethodNotAllowed, "INVALID_REQUEST", "METHOD_NOT_ALLOWED", "Method not supported")
+
+// plaidStatusCodes maps Plaid error types to the status answered by this
+// server. Errors caused by the request or the item are client errors, while
+// failures of Plaid or of the institution are reported as a bad gateway.
+var plaidStatusCodes = map[string]int{
+	"INVALID_REQUEST":     http.StatusBadRequest,
+	"INVALID_INPUT":       http.StatusBadRequest,
+	"INVALID_RESULT":      http.StatusBadRequest,
+	"ITEM_ERROR":          http.StatusBadRequest,
+	"ASSET_REPORT_ERROR":  http.StatusBadRequest,
+	"TRANSACTIONS_ERROR":  http.StatusBadRequest,
+	"PAYMENT_ERROR":       http.StatusBadRequest,
+	"BANK_TRANSFER_ERROR": http.StatusBadRequest,
+	"TRANSFER_ERROR":      http.StatusBadRequest,
+	"OAUTH_ERROR":         http.StatusBadRequest,
+	"SANDBOX_ERROR":       http.StatusBadRequest,
+	"RECAPTCHA_ERROR":     http.StatusBadRequest,
+	"RATE_LIMIT_EXCEEDED": http.StatusTooManyRequests,
+	"API_ERROR":           http.StatusBadGateway,
+	"INSTITUTION_ERROR":   http.StatusBadGateway,
+}
+
+// ToError converts any error into an Error. Errors returned by the Plaid
+// client keep their Plaid type, code and messages.
+func ToError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var apiErr plaid.GenericOpenAPIError
+	if errors.As(err, &apiErr) {
+		if plaidErr, perr := plaid.ToPlaidError(apiErr); perr == nil && plaidErr.ErrorType != "" {
+			status, ok := plaidStatusCodes[plaidErr.ErrorType]
+			if !ok {
+				status = http.StatusBadGateway
+			}
+			return &Error{
+				StatusCode:     status,
+				ErrorType:      plaidErr.ErrorType,
+				ErrorCode:      plaidErr.ErrorCode,
+				ErrorMessage:   plaidErr.ErrorMessage,
+				DisplayMessage: plaidErr.DisplayMessage.Get(),
+				RequestID:      plaidErr.GetRequestId(),
+			}
+		}
+		return NewError(http.StatusBadGateway, "API_ERROR", "PLAID_ERROR", err.Error())
+	}
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return NotFound("NOT_FOUND", err.Error())
+	case errors.Is(err, db.ErrInvalidCursor):
+		return BadRequest("INVALID_FIELD", err.Error())
+	case errors.Is(err, auth.ErrNoSession):
+		return NewError(http.StatusUnauthorized, "INVALID_REQUEST", "SESSION_REQUIRED", err.Error())
+	case errors.Is(err, auth.ErrInvalidSession):
+		return NewError(http.StatusUnauthorized, "INVALID_REQUEST", "INVALID_SESSION", err.Error())
+	case errors.Is(err, auth.ErrInvalidAPIKey):
+		return NewError(http.StatusUnauthorized, "INVALID_REQUEST", "INVALID_API_KEY", err.Error())
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return NewError(http.StatusUnauthorized, "INVALID_INPUT", "INVALID_CREDENTIALS", err.Error())
+	case errors.Is(err, db.ErrUserExists):
+		return NewError(http.StatusConflict, "INVALID_INPUT", "USER_ALREADY_EXISTS", err.Error())
+	}
+	return NewError(http.StatusInternalServerError, "API_ERROR", "INTERNAL_SERVER_ERROR", err.Error())
+}
+
+// WriteError answers a request with err as a JSON error envelope.
+func WriteError(w http.ResponseWriter, err error) {
+	e := ToError(err)
+	b, merr := json.Marshal(map[string]interface{}{
+		"error": e,
+	})
+	if merr != nil {
+		http.Error(w, e.ErrorMessage, e.StatusCode)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.StatusCode)
+	w.Write(b)
+}
+
+// WriteJSON answers a request with v as JSON and the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
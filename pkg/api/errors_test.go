@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"github.com/uitachi123/go-plaid/pkg/plaidfake"
+)
+
+func Test_ToError(t *testing.T) {
+	fake := plaidfake.NewServer()
+	defer fake.Close()
+	configuration := plaid.NewConfiguration()
+	configuration.AddDefaultHeader("PLAID-CLIENT-ID", "client")
+	configuration.AddDefaultHeader("PLAID-SECRET", "secret")
+	configuration.Servers = plaid.ServerConfigurations{{URL: fake.URL}}
+	client := plaid.NewAPIClient(configuration)
+
+	plaidError := func(errorType, errorCode string) error {
+		fake.FailNext("/accounts/get", plaidfake.Error{ErrorType: errorType, ErrorCode: errorCode})
+		_, _, err := client.PlaidApi.AccountsGet(context.Background()).AccountsGetRequest(
+			*plaid.NewAccountsGetRequest("access-token"),
+		).Execute()
+		return err
+	}
+
+	tests := []struct {
+		err       error
+		status    int
+		errorType string
+		errorCode string
+	}{
+		{plaidError("INVALID_INPUT", "INVALID_ACCESS_TOKEN"), http.StatusBadRequest, "INVALID_INPUT", "INVALID_ACCESS_TOKEN"},
+		{plaidError("ITEM_ERROR", "ITEM_LOGIN_REQUIRED"), http.StatusBadRequest, "ITEM_ERROR", "ITEM_LOGIN_REQUIRED"},
+		{plaidError("RATE_LIMIT_EXCEEDED", "ACCOUNTS_LIMIT"), http.StatusTooManyRequests, "RATE_LIMIT_EXCEEDED", "ACCOUNTS_LIMIT"},
+		{plaidError("API_ERROR", "INTERNAL_SERVER_ERROR"), http.StatusBadGateway, "API_ERROR", "INTERNAL_SERVER_ERROR"},
+		{NotFound("ITEM_NOT_FOUND", "item not found"), http.StatusNotFound, "INVALID_INPUT", "ITEM_NOT_FOUND"},
+		{fmt.Errorf("wrapped: %w", BadRequest("MISSING_FIELDS", "user is required")), http.StatusBadRequest, "INVALID_REQUEST", "MISSING_FIELDS"},
+		{db.ErrNotFound, http.StatusNotFound, "INVALID_INPUT", "NOT_FOUND"},
+		{db.ErrUserExists, http.StatusConflict, "INVALID_INPUT", "USER_ALREADY_EXISTS"},
+		{auth.ErrNoSession, http.StatusUnauthorized, "INVALID_REQUEST", "SESSION_REQUIRED"},
+		{auth.ErrInvalidSession, http.StatusUnauthorized, "INVALID_REQUEST", "INVALID_SESSION"},
+		{auth.ErrInvalidAPIKey, http.StatusUnauthorized, "INVALID_REQUEST", "INVALID_API_KEY"},
+		{auth.ErrInvalidCredentials, http.StatusUnauthorized, "INVALID_INPUT", "INVALID_CREDENTIALS"},
+		{errors.New("boom"), http.StatusInternalServerError, "API_ERROR", "INTERNAL_SERVER_ERROR"},
+	}
+	for _, test := range tests {
+		e := ToError(test.err)
+		if e.StatusCode != test.status || e.ErrorType != test.errorType || e.ErrorCode != test.errorCode {
+			t.Errorf("Data mismatch, expected:  %v %v %v got: %v %v %v", test.status, test.errorType, test.errorCode, e.StatusCode, e.ErrorType, e.ErrorCode)
+		}
+	}
+	if e := ToError(plaidError("ITEM_ERROR", "ITEM_LOGIN_REQUIRED")); e.RequestID == "" {
+		t.Errorf("Expected the request_id of the Plaid error, got %v", e)
+	}
+}
+
+func Test_WriteError(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteError(w, NotFound("ITEM_NOT_FOUND", "item not found"))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected %v\tGot %v", http.StatusNotFound, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected %v\tGot %v", "application/json", ct)
+	}
+	expected := `{"error":{"status_code":404,"error_type":"INVALID_INPUT","error_code":"ITEM_NOT_FOUND","error_message":"item not found","display_message":null}}`
+	if body := w.Body.String(); body != expected {
+		t.Errorf("Expected %v\tGot %v", expected, body)
+	}
+	var resp struct {
+		Error *Error `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error == nil {
+		t.Errorf("error unmarshal error envelope: %v", err)
+	}
+}
+
+func Test_WriteJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteJSON(w, http.StatusAccepted, map[string]string{"job_id": "job-1"})
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected %v\tGot %v", http.StatusAccepted, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected %v\tGot %v", "application/json", ct)
+	}
+	if body := w.Body.String(); body != `{"job_id":"job-1"}` {
+		t.Errorf("Expected %v\tGot %v", `{"job_id":"job-1"}`, body)
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+var errAPIKeyNotFound = NotFound("API_KEY_NOT_FOUND", "API key not found")
+
+// APIKeysHandler serves the API keys of the logged in user, mounted on both
+// /api/keys and /api/keys/:
+//
+//	GET    /api/keys           lists the keys of the user
+//	POST   /api/keys           issues a key from the JSON body
+//	DELETE /api/keys/{id}      revokes a key
+//
+// Keys are managed with a session only, and can only be issued with scopes
+// the user has. The key itself is only returned when it is issued.
+type APIKeysHandler struct {
+	store *db.Store
+	auth  *Authenticator
+}
+
+// NewAPIKeysHandler returns the API keys API of store, authenticating
+// requests with authn.
+func NewAPIKeysHandler(store *db.Store, authn *Authenticator) *APIKeysHandler {
+	return &APIKeysHandler{store: store, auth: authn}
+}
+
+func (h *APIKeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.auth.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := auth.PrincipalFrom(r.Context())
+		id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/keys"), "/")
+		switch {
+		case id == "" && r.Method == "GET":
+			h.list(w, p)
+		case id == "" && r.Method == "POST":
+			h.create(w, r, p)
+		case id != "" && r.Method == "DELETE":
+			h.delete(w, p, id)
+		default:
+			WriteError(w, MethodNotAllowed)
+		}
+	})).ServeHTTP(w, r)
+}
+
+func (h *APIKeysHandler) list(w http.ResponseWriter, p *auth.Principal) {
+	keys, err := h.store.ListAPIKeys(p.User)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	res := []db.APIKey{}
+	for _, k := range keys {
+		res = append(res, publicAPIKey(k))
+	}
+	WriteJSON(w, http.StatusOK, res)
+}
+
+// apiKeyRequest is the JSON body of key issuances.
+type apiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func (h *APIKeysHandler) create(w http.ResponseWriter, r *http.Request, p *auth.Principal) {
+	var req apiKeyRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		WriteError(w, BadRequest("INVALID_BODY", "request body must be a JSON API key: "+err.Error()))
+		return
+	}
+	if req.Name = strings.TrimSpace(req.Name); req.Name == "" || len(req.Scopes) == 0 {
+		WriteError(w, BadRequest("MISSING_FIELDS", "name and scopes are required"))
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			WriteError(w, BadRequest("INVALID_FIELD", "unknown scope "+scope))
+			return
+		}
+		if !p.HasScope(scope) {
+			WriteError(w, insufficientScope(scope))
+			return
+		}
+	}
+	id, err := db.NewAPIKeyID()
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	key, err := auth.GenerateAPIKey()
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	k := &db.APIKey{
+		ID:        id,
+		User:      p.User,
+		Name:      req.Name,
+		Hash:      auth.HashAPIKey(key),
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now(),
+	}
+	if err := h.store.SaveAPIKey(k); err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/keys/"+k.ID)
+	WriteJSON(w, http.StatusCreated, struct {
+		db.APIKey
+		Key string `json:"key"`
+	}{publicAPIKey(k), key})
+}
+
+// delete revokes a key of the user. Keys of other users are not found.
+func (h *APIKeysHandler) delete(w http.ResponseWriter, p *auth.Principal, id string) {
+	k, err := h.store.GetAPIKey(id)
+	if err == db.ErrNotFound || (err == nil && k.User != p.User) {
+		err = errAPIKeyNotFound
+	}
+	if err == nil {
+		err = h.store.DeleteAPIKey(id)
+	}
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publicAPIKey returns what is shown of an API key, without its hash.
+func publicAPIKey(k *db.APIKey) db.APIKey {
+	res := *k
+	res.Hash = ""
+	return res
+}
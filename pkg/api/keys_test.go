@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+func Test_APIKeysHandler(t *testing.T) {
+	store, _ := db.NewEmptyStore()
+	store.SeedUsers("")
+	key, _ := auth.GenerateKey()
+	sessions := auth.NewSessions(key, time.Hour)
+	authn := NewAuthenticator(sessions, store, nil)
+	h := NewAPIKeysHandler(store, authn)
+	do := func(as, apiKey, method, path, body string) (int, string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if as != "" {
+			req.AddCookie(sessions.Cookie(as))
+		}
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+
+	const alice, bob = "alice@test.com", "bob@test.com"
+	code, body := do(alice, "", "POST", "/api/keys", `{"name":"exports","scopes":["transactions:read"]}`)
+	if code != http.StatusCreated {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusCreated, code, body)
+	}
+	var issued struct {
+		ID     string   `json:"id"`
+		Key    string   `json:"key"`
+		Hash   string   `json:"hash"`
+		Scopes []string `json:"scopes"`
+	}
+	json.Unmarshal([]byte(body), &issued)
+	if !strings.HasPrefix(issued.Key, auth.APIKeyPrefix) || issued.Hash != "" || len(issued.Scopes) != 1 {
+		t.Errorf("Unexpected key %v", body)
+	}
+	if k, err := store.FindAPIKey(auth.HashAPIKey(issued.Key)); err != nil || k.ID != issued.ID || k.User != alice {
+		t.Errorf("Unexpected stored key %v, %v", k, err)
+	}
+
+	tests := []struct {
+		as, apiKey, method, path, body string
+		code                           int
+	}{
+		{"", "", "GET", "/api/keys", "", http.StatusUnauthorized},
+		{"", issued.Key, "GET", "/api/keys", "", http.StatusForbidden},
+		{"", issued.Key, "POST", "/api/keys", `{"name":"more","scopes":["transactions:read"]}`, http.StatusForbidden},
+		{alice, "", "POST", "/api/keys", `{"name":"exports"}`, http.StatusBadRequest},
+		{alice, "", "POST", "/api/keys", `{"name":"exports","scopes":["everything"]}`, http.StatusBadRequest},
+		{alice, "", "POST", "/api/keys", `{"name":"admin","scopes":["users:admin"]}`, http.StatusForbidden},
+		{alice, "", "POST", "/api/keys", `not json`, http.StatusBadRequest},
+		{bob, "", "DELETE", "/api/keys/" + issued.ID, "", http.StatusNotFound},
+		{alice, "", "PUT", "/api/keys/" + issued.ID, "", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		if code, body := do(test.as, test.apiKey, test.method, test.path, test.body); code != test.code {
+			t.Errorf("%s %s: Expected %v\tGot %v: %s", test.method, test.path, test.code, code, body)
+		}
+	}
+
+	if code, body := do(alice, "", "GET", "/api/keys", ""); code != http.StatusOK || !strings.Contains(body, issued.ID) || strings.Contains(body, "hash") {
+		t.Errorf("Unexpected keys %v %v", code, body)
+	}
+	if code, body := do(bob, "", "GET", "/api/keys", ""); code != http.StatusOK || body != "[]" {
+		t.Errorf("Expected %v\tGot %v %v", "[]", code, body)
+	}
+	if code, _ := do(alice, "", "DELETE", "/api/keys/"+issued.ID, ""); code != http.StatusNoContent {
+		t.Errorf("Expected %v\tGot %v", http.StatusNoContent, code)
+	}
+	// revoked keys no longer authenticate
+	req := httptest.NewRequest("GET", "/api/transactions", nil)
+	req.Header.Set("Authorization", "Bearer "+issued.Key)
+	if _, err := authn.Principal(req); err != auth.ErrInvalidAPIKey {
+		t.Errorf("Expected %v, got %v", auth.ErrInvalidAPIKey, err)
+	}
+}
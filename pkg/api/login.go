@@ -0,0 +1,51 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+// Login checks the "email" and "password" parameters of a POST request and
+// answers with the session cookie of the user and its profile.
+func Login(sessions *auth.Sessions, store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			WriteError(w, MethodNotAllowed)
+			return
+		}
+		email, password := r.FormValue("email"), r.FormValue("password")
+		if email == "" || password == "" {
+			WriteError(w, BadRequest("MISSING_FIELDS", "email and password are required"))
+			return
+		}
+		u, err := store.GetUser(email)
+		if err == db.ErrNotFound {
+			u = &db.User{}
+		} else if err != nil {
+			WriteError(w, err)
+			return
+		}
+		if err := auth.CheckPassword(u.PasswordHash, password); err != nil {
+			WriteError(w, err)
+			return
+		}
+		sessions.Issue(w, r, u.Email)
+		WriteJSON(w, http.StatusOK, publicUser(u))
+	}
+}
+
+// Logout removes the session cookie.
+func Logout(sessions *auth.Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			WriteError(w, MethodNotAllowed)
+			return
+		}
+		sessions.Clear(w)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{}")
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+func Test_Login(t *testing.T) {
+	store, _ := db.NewEmptyStore()
+	hash, _ := auth.HashPassword("alice-password")
+	store.CreateUser(&db.User{Email: "alice@test.com", Name: "Alice", PasswordHash: hash})
+	key, _ := auth.GenerateKey()
+	sessions := auth.NewSessions(key, time.Hour)
+	whoami := NewAuthenticator(sessions, store, nil).Require("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, auth.UserFrom(r.Context()))
+	}))
+	login := func(email, password string) *httptest.ResponseRecorder {
+		form := url.Values{"email": {email}, "password": {password}}
+		req := httptest.NewRequest("POST", "/api/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		Login(sessions, store)(w, req)
+		return w
+	}
+
+	for _, credentials := range [][2]string{{"alice@test.com", "wrong password"}, {"nobody@test.com", "alice-password"}, {"bob@test.com", "password"}} {
+		if w := login(credentials[0], credentials[1]); w.Code != http.StatusUnauthorized || len(w.Result().Cookies()) != 0 {
+			t.Errorf("Expected %v without a cookie\\tGot %v %v", http.StatusUnauthorized, w.Code, w.Result().Cookies())
+		}
+	}
+	w := login("alice@test.com", "alice-password")
+	if expected := `{"email":"alice@test.com","name":"Alice"}`; w.Code != http.StatusOK || w.Body.String() != expected {
+		t.Fatalf("Expected %v\\tGot %v %v", expected, w.Code, w.Body.String())
+	}
+	cookie := w.Result().Cookies()[0]
+
+	req := httptest.NewRequest("GET", "/api/info", nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	whoami.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "alice@test.com" {
+		t.Errorf("Data mismatch, expected:  %v got: %v %v", "alice@test.com", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	whoami.ServeHTTP(w, httptest.NewRequest("GET", "/api/info", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %v\\tGot %v", http.StatusUnauthorized, w.Code)
+	}
+
+	// deleted users lose their sessions
+	store.DeleteUser("alice@test.com", &db.AuditEvent{ID: "event-1", User: "alice@test.com", Action: db.AuditUserDeleted})
+	w = httptest.NewRecorder()
+	whoami.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %v\\tGot %v", http.StatusUnauthorized, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	Logout(sessions)(w, httptest.NewRequest("POST", "/api/logout", nil))
+	if cookies := w.Result().Cookies(); w.Code != http.StatusOK || len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("Expected the cookie to be removed, got %v %v", w.Code, cookies)
+	}
+}
@@ -1,43 +1,249 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
-	"io"
 	"net/http"
+	"net/mail"
+	"strings"
+	"time"
 
+	"github.com/uitachi123/go-plaid/pkg/auth"
 	"github.com/uitachi123/go-plaid/pkg/db"
 )
 
-func Users(w http.ResponseWriter, r *http.Request) {
-	users, err := list()
+var errUserNotFound = NotFound("USER_NOT_FOUND", "user not found")
+
+// ItemRemover removes the items of a user at Plaid, which invalidates their
+// access tokens, before the user is deleted from the store.
+type ItemRemover interface {
+	RemoveUserItems(ctx context.Context, user string) error
+}
+
+// UsersHandler serves the users of a store, mounted on both /users and
+// /users/:
+//
+//	GET    /users              lists users, those whose name starts with
+//	                           the "name" parameter if given
+//	POST   /users              creates the user of the JSON body
+//	GET    /users/{email}      returns a user
+//	PUT    /users/{email}      updates a user from the JSON body
+//	DELETE /users/{email}      deletes a user
+//
+// Creating users requires the users:admin scope, unless signup is open to
+// anyone. Reading users requires the users:read scope. Users may update or
+// delete themselves with a session, and anyone with users:admin. Password
+// hashes are never returned. Deleting a user removes its items at Plaid,
+// deletes all of its data and records an audit event.
+type UsersHandler struct {
+	store      *db.Store
+	auth       *Authenticator
+	items      ItemRemover
+	openSignup bool
+}
+
+// NewUsersHandler returns the users API of store, authenticating requests
+// with authn and removing the items of deleted users with items. Anyone may
+// sign up when openSignup is set.
+func NewUsersHandler(store *db.Store, authn *Authenticator, items ItemRemover, openSignup bool) *UsersHandler {
+	return &UsersHandler{store: store, auth: authn, items: items, openSignup: openSignup}
+}
+
+func (h *UsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/users"), "/")
+	if email == "" && r.Method == "POST" && h.openSignup {
+		h.create(w, r)
+		return
+	}
+	if email == "" && r.Method == "POST" {
+		h.auth.Require(auth.ScopeUsersAdmin, http.HandlerFunc(h.create)).ServeHTTP(w, r)
+		return
+	}
+	h.auth.Require(auth.ScopeUsersRead, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.serveAuthenticated(w, r, email)
+	})).ServeHTTP(w, r)
+}
+
+func (h *UsersHandler) serveAuthenticated(w http.ResponseWriter, r *http.Request, email string) {
+	switch {
+	case email == "" && r.Method == "GET":
+		h.list(w, r)
+	case email != "" && r.Method == "GET":
+		h.get(w, email)
+	case email != "" && (r.Method == "PUT" || r.Method == "DELETE"):
+		p := auth.PrincipalFrom(r.Context())
+		if !p.HasScope(auth.ScopeUsersAdmin) && (p.User != email || p.APIKeyID != "") {
+			WriteError(w, Forbidden("users may only change themselves, with a session"))
+			return
+		}
+		if r.Method == "PUT" {
+			h.update(w, r, email)
+		} else {
+			h.delete(w, r, email)
+		}
+	default:
+		WriteError(w, MethodNotAllowed)
+	}
+}
+
+func (h *UsersHandler) list(w http.ResponseWriter, r *http.Request) {
+	var users []*db.User
+	var err error
+	if name := r.FormValue("name"); name != "" {
+		users, err = h.store.SearchUsers(name)
+	} else {
+		users, err = h.store.ListUsers()
+	}
 	if err != nil {
-		io.WriteString(w, err.Error())
+		WriteError(w, err)
+		return
+	}
+	res := []db.User{}
+	for _, u := range users {
+		res = append(res, publicUser(u))
 	}
-	b, err := json.Marshal(users)
+	WriteJSON(w, http.StatusOK, res)
+}
+
+func (h *UsersHandler) create(w http.ResponseWriter, r *http.Request) {
+	u, err := decodeUser(r, true)
 	if err != nil {
-		io.WriteString(w, err.Error())
+		WriteError(w, err)
+		return
+	}
+	if err := h.store.CreateUser(u); err != nil {
+		WriteError(w, err)
+		return
 	}
-	io.WriteString(w, string(b))
+	w.Header().Set("Location", "/users/"+u.Email)
+	WriteJSON(w, http.StatusCreated, publicUser(u))
 }
 
-func list() ([]db.User, error) {
-	d, err := db.Init()
+func (h *UsersHandler) get(w http.ResponseWriter, email string) {
+	u, err := h.store.GetUser(email)
+	if err == db.ErrNotFound {
+		err = errUserNotFound
+	}
 	if err != nil {
-		return []db.User{}, err
+		WriteError(w, err)
+		return
 	}
-	txn := d.Txn(false)
-	defer txn.Abort()
-	iter, err := txn.Get("user", "id")
+	WriteJSON(w, http.StatusOK, publicUser(u))
+}
+
+// update replaces the name of a user, and its password if one is given. The
+// email identifies the user, so a body with another email is rejected.
+func (h *UsersHandler) update(w http.ResponseWriter, r *http.Request, email string) {
+	u, err := decodeUser(r, false)
 	if err != nil {
-		return []db.User{}, err
+		WriteError(w, err)
+		return
 	}
-	var res []db.User
-	for {
-		elem := iter.Next()
-		if elem == nil {
-			break
+	if u.Email != email {
+		WriteError(w, BadRequest("INVALID_FIELD", "email can not be changed"))
+		return
+	}
+	current, err := h.store.GetUser(email)
+	if err == db.ErrNotFound {
+		err = errUserNotFound
+	}
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if u.PasswordHash == "" {
+		u.PasswordHash = current.PasswordHash
+	}
+	err = h.store.UpdateUser(u)
+	if err == db.ErrNotFound {
+		err = errUserNotFound
+	}
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, publicUser(u))
+}
+
+// delete removes the items of a user at Plaid, then deletes the user and
+// records who deleted it. A user whose items could not all be removed is
+// kept so deleting it can be retried.
+func (h *UsersHandler) delete(w http.ResponseWriter, r *http.Request, email string) {
+	if _, err := h.store.GetUser(email); err == db.ErrNotFound {
+		WriteError(w, errUserNotFound)
+		return
+	}
+	id, err := db.NewAuditEventID()
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	p := auth.PrincipalFrom(r.Context())
+	actor := p.User
+	if p.APIKeyID != "" {
+		actor = "api_key:" + p.APIKeyID
+	}
+	event := &db.AuditEvent{
+		ID:        id,
+		User:      email,
+		Actor:     actor,
+		Action:    db.AuditUserDeleted,
+		CreatedAt: time.Now(),
+	}
+	if err := h.items.RemoveUserItems(r.Context(), email); err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = h.store.DeleteUser(email, event)
+	if err == db.ErrNotFound {
+		err = errUserNotFound
+	}
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// userRequest is the JSON body of user creations and updates.
+type userRequest struct {
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// decodeUser reads and validates the JSON user of the request body, hashing
+// its password. The password may only be left out when it is not required.
+func decodeUser(r *http.Request, passwordRequired bool) (*db.User, error) {
+	var req userRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return nil, BadRequest("INVALID_BODY", "request body must be a JSON user: "+err.Error())
+	}
+	u := &db.User{
+		Email: strings.TrimSpace(req.Email),
+		Name:  strings.TrimSpace(req.Name),
+	}
+	if u.Email == "" || u.Name == "" || (passwordRequired && req.Password == "") {
+		return nil, BadRequest("MISSING_FIELDS", "email, name and password are required")
+	}
+	if addr, err := mail.ParseAddress(u.Email); err != nil || addr.Address != u.Email {
+		return nil, BadRequest("INVALID_FIELD", "email must be an email address")
+	}
+	if req.Password != "" {
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			return nil, BadRequest("INVALID_FIELD", err.Error())
 		}
-		res = append(res, *elem.(*db.User))
+		u.PasswordHash = hash
 	}
-	return res, nil
+	return u, nil
+}
+
+// publicUser returns what is shown of a user, without its password hash.
+func publicUser(u *db.User) db.User {
+	res := *u
+	res.PasswordHash = ""
+	return res
 }
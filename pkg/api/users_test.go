@@ -1,50 +1,130 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/uitachi123/go-plaid/pkg/auth"
 	"github.com/uitachi123/go-plaid/pkg/db"
 )
 
-func Test_List(t *testing.T) {
-	users, _ := list()
-	if !reflect.DeepEqual(len(users), 2) {
-		t.Errorf("Wrong user counts - expected 2, actual %d", len(users))
+// fakeItemRemover records the users whose items were removed, and fails for
+// the users of fail.
+type fakeItemRemover struct {
+	removed []string
+	fail    map[string]bool
+}
+
+func (f *fakeItemRemover) RemoveUserItems(ctx context.Context, user string) error {
+	if f.fail[user] {
+		return errors.New("plaid is unavailable")
+	}
+	f.removed = append(f.removed, user)
+	return nil
+}
+
+func Test_UsersHandler(t *testing.T) {
+	store, _ := db.NewEmptyStore()
+	key, _ := auth.GenerateKey()
+	sessions := auth.NewSessions(key, time.Hour)
+	items := &fakeItemRemover{fail: map[string]bool{"erin@test.com": true}}
+	store.CreateUser(&db.User{Email: "admin@test.com", Name: "Admin"})
+	h := NewUsersHandler(store, NewAuthenticator(sessions, store, []string{"admin@test.com"}), items, false)
+	do := func(as, method, path, body string) (int, string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if as != "" {
+			req.AddCookie(sessions.Cookie(as))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code, strings.TrimSpace(w.Body.String())
 	}
-	user := db.User{Email: "alice@test.com", Name: "Alice"}
-	if !reflect.DeepEqual(user, users[0]) {
-		t.Errorf("Data mismatch, expected:  %v got: %v", user, users[0])
+
+	const admin, carol = "admin@test.com", "carol@test.com"
+	tests := []struct {
+		as, method, path, body string
+		code                   int
+		expected               string
+	}{
+		{admin, "POST", "/users", `{"email":"carol@test.com","name":"Carol","password":"carol1234"}`, http.StatusCreated, `{"email":"carol@test.com","name":"Carol"}`},
+		{admin, "POST", "/users", `{"email":" al@test.com ","name":"Al","password":"al123456"}`, http.StatusCreated, `{"email":"al@test.com","name":"Al"}`},
+		{admin, "POST", "/users", `{"email":"carol@test.com","name":"Caroline","password":"carol1234"}`, http.StatusConflict, ``},
+		{admin, "POST", "/users", `{"email":"carol","name":"Carol","password":"carol1234"}`, http.StatusBadRequest, ``},
+		{admin, "POST", "/users", `{"email":"dave@test.com","name":"Dave"}`, http.StatusBadRequest, ``},
+		{admin, "POST", "/users", `{"email":"dave@test.com","name":"Dave","password":"short"}`, http.StatusBadRequest, ``},
+		{admin, "POST", "/users", `{"email":"dave@test.com","name":"Dave","password":"dave1234","password_hash":"x"}`, http.StatusBadRequest, ``},
+		{admin, "POST", "/users", `not json`, http.StatusBadRequest, ``},
+		// only admins may create users
+		{"", "POST", "/users", `{"email":"dave@test.com","name":"Dave","password":"dave1234"}`, http.StatusUnauthorized, ``},
+		{carol, "POST", "/users", `{"email":"dave@test.com","name":"Dave","password":"dave1234"}`, http.StatusForbidden, ``},
+		{"", "GET", "/users", "", http.StatusUnauthorized, ``},
+		{"", "GET", "/users/carol@test.com", "", http.StatusUnauthorized, ``},
+		{"dave@test.com", "GET", "/users", "", http.StatusUnauthorized, ``},
+		{carol, "GET", "/users", "", http.StatusOK, `[{"email":"admin@test.com","name":"Admin"},{"email":"al@test.com","name":"Al"},{"email":"carol@test.com","name":"Carol"}]`},
+		{carol, "GET", "/users/carol@test.com", "", http.StatusOK, `{"email":"carol@test.com","name":"Carol"}`},
+		{carol, "GET", "/users/dave@test.com", "", http.StatusNotFound, ``},
+		{carol, "GET", "/users?name=Ca", "", http.StatusOK, `[{"email":"carol@test.com","name":"Carol"}]`},
+		{carol, "PUT", "/users/carol@test.com", `{"email":"carol@test.com","name":"Caroline"}`, http.StatusOK, `{"email":"carol@test.com","name":"Caroline"}`},
+		{carol, "PUT", "/users/carol@test.com", `{"email":"dave@test.com","name":"Caroline"}`, http.StatusBadRequest, ``},
+		{carol, "PUT", "/users/al@test.com", `{"email":"al@test.com","name":"Alan"}`, http.StatusForbidden, ``},
+		{carol, "DELETE", "/users/al@test.com", "", http.StatusForbidden, ``},
+		{"al@test.com", "DELETE", "/users/al@test.com", "", http.StatusNoContent, ``},
+		{"al@test.com", "DELETE", "/users/al@test.com", "", http.StatusUnauthorized, ``},
+		{carol, "GET", "/users", "", http.StatusOK, `[{"email":"admin@test.com","name":"Admin"},{"email":"carol@test.com","name":"Caroline"}]`},
+		{carol, "DELETE", "/users", "", http.StatusMethodNotAllowed, ``},
+		// admins may change anyone
+		{admin, "PUT", "/users/carol@test.com", `{"email":"carol@test.com","name":"Carol"}`, http.StatusOK, `{"email":"carol@test.com","name":"Carol"}`},
+		{admin, "DELETE", "/users/dave@test.com", "", http.StatusNotFound, ``},
+		// users whose items could not be removed are kept
+		{admin, "POST", "/users", `{"email":"erin@test.com","name":"Erin","password":"erin1234"}`, http.StatusCreated, ``},
+		{admin, "DELETE", "/users/erin@test.com", "", http.StatusInternalServerError, ``},
+		{admin, "GET", "/users/erin@test.com", "", http.StatusOK, `{"email":"erin@test.com","name":"Erin"}`},
 	}
-	user = db.User{Email: "bob@test.com", Name: "Bob"}
-	if !reflect.DeepEqual(user, users[1]) {
-		t.Errorf("Data mismatch, expected:  %v got: %v", user, users[1])
+	for _, test := range tests {
+		code, body := do(test.as, test.method, test.path, test.body)
+		if code != test.code {
+			t.Errorf("%s %s: Expected %v\tGot %v: %s", test.method, test.path, test.code, code, body)
+		}
+		if test.expected != "" && body != test.expected {
+			t.Errorf("%s %s: Expected %v\tGot %v", test.method, test.path, test.expected, body)
+		}
 	}
-}
 
-func Test_Users(t *testing.T) {
-	req := httptest.NewRequest("GET", "/users", nil)
-	w := httptest.NewRecorder()
+	if !reflect.DeepEqual(items.removed, []string{"al@test.com"}) {
+		t.Errorf("Data mismatch, expected:  %v got: %v", []string{"al@test.com"}, items.removed)
+	}
 
-	expectedOutput, err := json.Marshal(
-		[]db.User{
-			db.User{Email: "alice@test.com", Name: "Alice"},
-			db.User{Email: "bob@test.com", Name: "Bob"},
-		},
-	)
-	if err != nil {
-		t.Errorf("error marshal expected return json: %v", err)
+	// deletions are audited
+	events, _ := store.ListAuditEvents("al@test.com")
+	if len(events) != 1 || events[0].Action != db.AuditUserDeleted || events[0].Actor != "al@test.com" {
+		t.Errorf("Unexpected audit events %v", events)
 	}
-	expected := string(expectedOutput)
-	h := http.HandlerFunc(Users)
 
-	h.ServeHTTP(w, req)
-	body := w.Body.String()
+	// updates without a password keep the current one
+	u, _ := store.GetUser(carol)
+	if err := auth.CheckPassword(u.PasswordHash, "carol1234"); err != nil {
+		t.Errorf("Expected the password to be kept, got %v", err)
+	}
+}
 
-	if body != expected {
-		t.Errorf("Expected %v\tGot %v", expected, body)
+func Test_UsersHandlerOpenSignup(t *testing.T) {
+	store, _ := db.NewEmptyStore()
+	key, _ := auth.GenerateKey()
+	authn := NewAuthenticator(auth.NewSessions(key, time.Hour), store, nil)
+	h := NewUsersHandler(store, authn, &fakeItemRemover{}, true)
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"email":"carol@test.com","name":"Carol","password":"carol1234"}`))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected %v\tGot %v: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if _, err := store.GetUser("carol@test.com"); err != nil {
+		t.Errorf("Expected the user to be created, got %v", err)
 	}
 }
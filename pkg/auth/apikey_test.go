@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_APIKeys(t *testing.T) {
+	key, err := GenerateAPIKey()
+	if err != nil || !strings.HasPrefix(key, APIKeyPrefix) {
+		t.Fatalf("Unexpected key %v, %v", key, err)
+	}
+	other, _ := GenerateAPIKey()
+	if key == other || HashAPIKey(key) == HashAPIKey(other) {
+		t.Errorf("Expected different keys and hashes, got %v twice", key)
+	}
+	if HashAPIKey(key) != HashAPIKey(key) || strings.Contains(HashAPIKey(key), key) {
+		t.Errorf("Unexpected hash %v", HashAPIKey(key))
+	}
+
+	for header, expected := range map[string]string{
+		"":                 "",
+		"Bearer " + key:    key,
+		"bearer  " + key:   key,
+		"Basic dXNlcjpwdw": "",
+		"Bearer":           "",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		if got := BearerAPIKey(req); got != expected {
+			t.Errorf("%q: Expected %v\tGot %v", header, expected, got)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned for an unknown email or a wrong
+// password, without telling which.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// MinPasswordLength is the minimum length of a password.
+const MinPasswordLength = 8
+
+// dummyHash is compared against when a user has no password hash, so
+// unknown users take as long to reject as wrong passwords.
+const dummyHash = "$2a$10$q4vzhJlCSQmJAeTuw1Fkm.XZXUf6.DgRimjAC/NfGcBt7wIm2EfpW"
+
+// HashPassword returns the bcrypt hash of a password.
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", errors.New("password must be at least 8 characters long")
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// CheckPassword compares a password with a hash made by HashPassword,
+// returning ErrInvalidCredentials if they do not match. An empty hash never
+// matches.
+func CheckPassword(hash, password string) error {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(password))
+		return ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package auth
+
+import "testing"
+
+func Test_Password(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+	if err := CheckPassword(hash, "correct horse"); err != nil {
+		t.Errorf("Expected the password to match, got %v", err)
+	}
+	if err := CheckPassword(hash, "battery staple"); err != ErrInvalidCredentials {
+		t.Errorf("Expected %v, got %v", ErrInvalidCredentials, err)
+	}
+	if err := CheckPassword("", ""); err != ErrInvalidCredentials {
+		t.Errorf("Expected %v, got %v", ErrInvalidCredentials, err)
+	}
+	if _, err := HashPassword("short"); err == nil {
+		t.Errorf("Expected short passwords to be rejected")
+	}
+}
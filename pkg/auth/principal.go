@@ -0,0 +1,97 @@
+package auth
+
+import "context"
+
+// Scopes granted to API keys. Each route requires one of them.
+const (
+	ScopeAccountsRead     = "accounts:read"
+	ScopeTransactionsRead = "transactions:read"
+	ScopeAssetsRead       = "assets:read"
+	ScopeAssetsWrite      = "assets:write"
+	ScopeItemsWrite       = "items:write"
+	ScopePaymentRead      = "payment:read"
+	ScopePaymentWrite     = "payment:write"
+	ScopeTransferRead     = "transfer:read"
+	ScopeTransferWrite    = "transfer:write"
+	ScopeUsersRead        = "users:read"
+	// ScopeUsersAdmin allows changing and deleting any user.
+	ScopeUsersAdmin = "users:admin"
+)
+
+// Scopes lists every scope.
+var Scopes = []string{
+	ScopeAccountsRead,
+	ScopeTransactionsRead,
+	ScopeAssetsRead,
+	ScopeAssetsWrite,
+	ScopeItemsWrite,
+	ScopePaymentRead,
+	ScopePaymentWrite,
+	ScopeTransferRead,
+	ScopeTransferWrite,
+	ScopeUsersRead,
+	ScopeUsersAdmin,
+}
+
+// UserScopes are the scopes of a user logged in with a session, which has
+// every scope but users:admin unless the user is an admin.
+func UserScopes(admin bool) []string {
+	var res []string
+	for _, scope := range Scopes {
+		if scope != ScopeUsersAdmin || admin {
+			res = append(res, scope)
+		}
+	}
+	return res
+}
+
+// ValidScope tells if scope is one of Scopes.
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Principal is who a request is made for: a user, authenticated by its
+// session or by one of its API keys, with the scopes granted to it.
+type Principal struct {
+	User string
+	// APIKeyID is the id of the API key of the request, if any.
+	APIKeyID string
+	Scopes   []string
+}
+
+// HasScope tells if the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a context carrying the principal of a request.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// PrincipalFrom returns the principal of ctx, or nil if there is none.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// UserFrom returns the email of the authenticated user of ctx, or "" if
+// there is none.
+func UserFrom(ctx context.Context) string {
+	if p := PrincipalFrom(ctx); p != nil {
+		return p.User
+	}
+	return ""
+}
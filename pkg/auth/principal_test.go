@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_Principal(t *testing.T) {
+	if UserFrom(context.Background()) != "" || PrincipalFrom(context.Background()) != nil {
+		t.Errorf("Expected no principal without one in the context")
+	}
+	p := &Principal{User: "alice@test.com", Scopes: UserScopes(false)}
+	ctx := WithPrincipal(context.Background(), p)
+	if UserFrom(ctx) != "alice@test.com" || PrincipalFrom(ctx) != p {
+		t.Errorf("Data mismatch, expected:  %v got: %v", p, PrincipalFrom(ctx))
+	}
+	if !p.HasScope(ScopeTransactionsRead) || p.HasScope(ScopeUsersAdmin) {
+		t.Errorf("Unexpected scopes %v", p.Scopes)
+	}
+	if admin := UserScopes(true); len(admin) != len(Scopes) {
+		t.Errorf("Expected %v\tGot %v", Scopes, admin)
+	}
+	if !ValidScope(ScopeTransferWrite) || ValidScope("transfer:*") {
+		t.Errorf("Unexpected scope validation")
+	}
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CookieName is the name of the session cookie.
+const CookieName = "go_plaid_session"
+
+var (
+	ErrNoSession      = errors.New("no session, log in first")
+	ErrInvalidSession = errors.New("invalid or expired session")
+)
+
+// Sessions issues and verifies session cookies. A session is the email of
+// the user and an expiry time, signed with HMAC-SHA256, so nothing is
+// stored server side and sessions survive restarts as long as the key does.
+type Sessions struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewSessions returns sessions signed with key and valid for ttl.
+func NewSessions(key []byte, ttl time.Duration) *Sessions {
+	return &Sessions{key: key, ttl: ttl, now: time.Now}
+}
+
+// GenerateKey returns a random session signing key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Cookie returns a new session cookie of a user.
+func (s *Sessions) Cookie(email string) *http.Cookie {
+	expires := s.now().Add(s.ttl)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(email)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    payload + "." + s.sign(payload),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// Issue sets the session cookie of a user on the response to r.
+func (s *Sessions) Issue(w http.ResponseWriter, r *http.Request, email string) {
+	c := s.Cookie(email)
+	c.Secure = r.TLS != nil
+	http.SetCookie(w, c)
+}
+
+// Clear removes the session cookie.
+func (s *Sessions) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// User returns the email of the user of the session cookie of r.
+func (s *Sessions) User(r *http.Request) (string, error) {
+	c, err := r.Cookie(CookieName)
+	if err != nil || c.Value == "" {
+		return "", ErrNoSession
+	}
+	i := strings.LastIndex(c.Value, ".")
+	if i < 0 {
+		return "", ErrInvalidSession
+	}
+	payload, signature := c.Value[:i], c.Value[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return "", ErrInvalidSession
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 2 {
+		return "", ErrInvalidSession
+	}
+	email, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidSession
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || s.now().Unix() >= expires {
+		return "", ErrInvalidSession
+	}
+	return string(email), nil
+}
+
+func (s *Sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Sessions(t *testing.T) {
+	key, _ := GenerateKey()
+	s := NewSessions(key, time.Hour)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	request := func(c *http.Cookie) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		if c != nil {
+			r.AddCookie(c)
+		}
+		return r
+	}
+	w := httptest.NewRecorder()
+	s.Issue(w, request(nil), "alice.smith@test.com")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("Unexpected cookies %v", cookies)
+	}
+	cookie := cookies[0]
+	if email, err := s.User(request(cookie)); err != nil || email != "alice.smith@test.com" {
+		t.Errorf("Data mismatch, expected:  %v got: %v (%v)", "alice.smith@test.com", email, err)
+	}
+
+	if _, err := s.User(request(nil)); err != ErrNoSession {
+		t.Errorf("Expected %v, got %v", ErrNoSession, err)
+	}
+	otherKey, _ := GenerateKey()
+	forged := NewSessions(otherKey, time.Hour).Cookie("alice.smith@test.com")
+	tampered := *cookie
+	tampered.Value = "Ym9iQHRlc3QuY29t" + tampered.Value[len("YWxpY2Uuc21pdGhAdGVzdC5jb20"):]
+	for _, c := range []*http.Cookie{forged, &tampered, {Name: CookieName, Value: "garbage"}} {
+		if _, err := s.User(request(c)); err != ErrInvalidSession {
+			t.Errorf("Expected %v for %v, got %v", ErrInvalidSession, c.Value, err)
+		}
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := s.User(request(cookie)); err != ErrInvalidSession {
+		t.Errorf("Expected an expired session, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	s.Clear(w)
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("Expected the cookie to be removed, got %v", cookies)
+	}
+}
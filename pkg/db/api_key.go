@@ -0,0 +1,94 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// APIKey is an API key of a user, granting some of its scopes to services
+// calling the server without a session. Only the hash of the key is stored.
+type APIKey struct {
+	ID   string `json:"id"`
+	User string `json:"user"`
+	Name string `json:"name"`
+	// Hash is the auth.HashAPIKey hash of the key.
+	Hash      string    `json:"hash,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewAPIKeyID returns a random API key id.
+func NewAPIKeyID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SaveAPIKey inserts or replaces an API key.
+func (s *Store) SaveAPIKey(k *APIKey) error {
+	txn := s.writeTxn()
+	defer txn.Abort()
+	if err := txn.Insert("api_key", k); err != nil {
+		return err
+	}
+	return s.commit(txn)
+}
+
+// GetAPIKey returns the API key with the given id.
+func (s *Store) GetAPIKey(id string) (*APIKey, error) {
+	return s.firstAPIKey("id", id)
+}
+
+// FindAPIKey returns the API key with the given hash.
+func (s *Store) FindAPIKey(hash string) (*APIKey, error) {
+	return s.firstAPIKey("hash", hash)
+}
+
+func (s *Store) firstAPIKey(index, value string) (*APIKey, error) {
+	txn := s.db.Txn(false)
+	defer txn.Abort()
+	raw, err := txn.First("api_key", index, value)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	return raw.(*APIKey), nil
+}
+
+// ListAPIKeys returns the API keys of a user.
+func (s *Store) ListAPIKeys(user string) ([]*APIKey, error) {
+	txn := s.db.Txn(false)
+	defer txn.Abort()
+	iter, err := txn.Get("api_key", "user", user)
+	if err != nil {
+		return nil, err
+	}
+	res := []*APIKey{}
+	for {
+		elem := iter.Next()
+		if elem == nil {
+			break
+		}
+		res = append(res, elem.(*APIKey))
+	}
+	return res, nil
+}
+
+// DeleteAPIKey deletes an API key, revoking it.
+func (s *Store) DeleteAPIKey(id string) error {
+	txn := s.writeTxn()
+	defer txn.Abort()
+	n, err := txn.DeleteAll("api_key", "id", id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return s.commit(txn)
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_APIKeys(t *testing.T) {
+	s, _ := NewEmptyStore()
+	key, _ := GenerateKey()
+	k, _ := NewKeyring(key)
+	s.UseKeyring(k)
+	s.SeedUsers("")
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error persisting: %v", err)
+	}
+	keys := []*APIKey{
+		{ID: "key-1", User: "alice@test.com", Name: "exports", Hash: "hash-1", Scopes: []string{"transactions:read"}},
+		{ID: "key-2", User: "alice@test.com", Name: "transfers", Hash: "hash-2", Scopes: []string{"transfer:write"}},
+		{ID: "key-3", User: "bob@test.com", Name: "exports", Hash: "hash-3"},
+	}
+	for _, k := range keys {
+		if err := s.SaveAPIKey(k); err != nil {
+			t.Fatalf("Error saving key %v: %v", k, err)
+		}
+	}
+	if k, err := s.FindAPIKey("hash-2"); err != nil || k.ID != "key-2" {
+		t.Errorf("Unexpected key %v, %v", k, err)
+	}
+	if _, err := s.FindAPIKey("hash-4"); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+	if err := s.DeleteAPIKey("key-2"); err != nil {
+		t.Fatalf("Error deleting key: %v", err)
+	}
+	if err := s.DeleteAPIKey("key-2"); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+	if err := s.DeleteUser("bob@test.com", &AuditEvent{ID: "event-1", User: "bob@test.com", Action: AuditUserDeleted}); err != nil {
+		t.Fatalf("Error deleting user: %v", err)
+	}
+
+	// reload from the file
+	s, _ = NewEmptyStore()
+	s.UseKeyring(k)
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error loading: %v", err)
+	}
+	if keys, err := s.ListAPIKeys("alice@test.com"); err != nil || len(keys) != 1 || keys[0].ID != "key-1" || keys[0].Scopes[0] != "transactions:read" {
+		t.Errorf("Unexpected keys %v, %v", keys, err)
+	}
+	if _, err := s.GetAPIKey("key-3"); err != ErrNotFound {
+		t.Errorf("Expected the keys of deleted users to be revoked, got %v", err)
+	}
+}
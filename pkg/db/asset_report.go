@@ -0,0 +1,206 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	AssetReportStatusPending = "pending"
+	AssetReportStatusReady   = "ready"
+	AssetReportStatusError   = "error"
+)
+
+// AssetReport is an asset report job of a user. The asset report token is
+// only stored sealed with the configured Keyring. Report and PDF are set
+// once the report is ready.
+type AssetReport struct {
+	ID      string   `json:"job_id"`
+	User    string   `json:"user"`
+	ItemIDs []string `json:"item_ids"`
+	// ParentID is the job refreshed or filtered into this one, if any.
+	ParentID         string          `json:"parent_job_id,omitempty"`
+	AssetReportID    string          `json:"asset_report_id"`
+	AssetReportToken *Sealed         `json:"asset_report_token"`
+	DaysRequested    int             `json:"days_requested"`
+	ClientReportID   string          `json:"client_report_id,omitempty"`
+	Status           string          `json:"status"`
+	ErrorCode        string          `json:"error_code,omitempty"`
+	Report           json.RawMessage `json:"report,omitempty"`
+	PDF              []byte          `json:"pdf,omitempty"`
+	AuditCopies      []*AuditCopy    `json:"audit_copies,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+// AuditCopy is a copy of an asset report shared with a third party auditor.
+// Its token is only stored sealed.
+type AuditCopy struct {
+	AuditorID string    `json:"auditor_id"`
+	Token     *Sealed   `json:"audit_copy_token"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewAssetReportID returns a random asset report job id.
+func NewAssetReportID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// AssetReportToken decrypts the asset report token of a job.
+func (s *Store) AssetReportToken(r *AssetReport) (string, error) {
+	if r.AssetReportToken == nil {
+		return "", errors.New("asset report has no token")
+	}
+	return s.open(r.AssetReportToken)
+}
+
+// AuditCopyToken decrypts the token of an audit copy.
+func (s *Store) AuditCopyToken(c *AuditCopy) (string, error) {
+	if c.Token == nil {
+		return "", errors.New("audit copy has no token")
+	}
+	return s.open(c.Token)
+}
+
+// SaveAssetReport inserts or replaces an asset report job.
+func (s *Store) SaveAssetReport(r *AssetReport) error {
+	txn := s.writeTxn()
+	defer txn.Abort()
+	if err := txn.Insert("asset_report", r); err != nil {
+		return err
+	}
+	return s.commit(txn)
+}
+
+// GetAssetReport returns the asset report job with the given id.
+func (s *Store) GetAssetReport(id string) (*AssetReport, error) {
+	return s.firstAssetReport("id", id)
+}
+
+// DeleteAssetReport deletes an asset report job.
+func (s *Store) DeleteAssetReport(id string) error {
+	txn := s.writeTxn()
+	defer txn.Abort()
+	n, err := txn.DeleteAll("asset_report", "id", id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return s.commit(txn)
+}
+
+// FindAssetReport returns the asset report job of a Plaid asset_report_id.
+func (s *Store) FindAssetReport(assetReportID string) (*AssetReport, error) {
+	return s.firstAssetReport("report", assetReportID)
+}
+
+func (s *Store) firstAssetReport(index, value string) (*AssetReport, error) {
+	txn := s.db.Txn(false)
+	defer txn.Abort()
+	raw, err := txn.First("asset_report", index, value)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	return raw.(*AssetReport), nil
+}
+
+// ListAssetReports returns the asset report jobs of a user, or of every user
+// when user is empty.
+func (s *Store) ListAssetReports(user string) ([]*AssetReport, error) {
+	if user == "" {
+		return s.listAssetReports("id")
+	}
+	return s.listAssetReports("user", user)
+}
+
+// ListItemAssetReports returns the asset report jobs covering an item.
+func (s *Store) ListItemAssetReports(itemID string) ([]*AssetReport, error) {
+	return s.listAssetReports("item", itemID)
+}
+
+func (s *Store) listAssetReports(index string, args ...interface{}) ([]*AssetReport, error) {
+	txn := s.db.Txn(false)
+	defer txn.Abort()
+	iter, err := txn.Get("asset_report", index, args...)
+	if err != nil {
+		return nil, err
+	}
+	res := []*AssetReport{}
+	for {
+		elem := iter.Next()
+		if elem == nil {
+			break
+		}
+		res = append(res, elem.(*AssetReport))
+	}
+	return res, nil
+}
+
+// ReencryptAssetReports re-seals the asset report and audit copy tokens that
+// are not sealed with the primary key of the keyring, like ReencryptItems,
+// and returns the number of jobs updated.
+func (s *Store) ReencryptAssetReports() (int, error) {
+	if s.keyring == nil {
+		return 0, ErrNoKeyring
+	}
+	primary := s.keyring.Primary()
+	txn := s.writeTxn()
+	defer txn.Abort()
+	stale := func(sealed *Sealed) bool {
+		return sealed != nil && sealed.KeyID != primary
+	}
+	var reports []*AssetReport
+	if err := all(txn, "asset_report", func(raw interface{}) {
+		r := raw.(*AssetReport)
+		needed := stale(r.AssetReportToken)
+		for _, c := range r.AuditCopies {
+			needed = needed || stale(c.Token)
+		}
+		if needed {
+			reports = append(reports, r)
+		}
+	}); err != nil {
+		return 0, err
+	}
+	for _, r := range reports {
+		updated := *r
+		if stale(r.AssetReportToken) {
+			sealed, err := s.reseal(r.AssetReportToken)
+			if err != nil {
+				return 0, err
+			}
+			updated.AssetReportToken = sealed
+		}
+		updated.AuditCopies = nil
+		for _, c := range r.AuditCopies {
+			copied := *c
+			if stale(c.Token) {
+				sealed, err := s.reseal(c.Token)
+				if err != nil {
+					return 0, err
+				}
+				copied.Token = sealed
+			}
+			updated.AuditCopies = append(updated.AuditCopies, &copied)
+		}
+		if err := txn.Insert("asset_report", &updated); err != nil {
+			return 0, err
+		}
+	}
+	if err := s.commit(txn); err != nil {
+		return 0, err
+	}
+	return len(reports), s.compact()
+}
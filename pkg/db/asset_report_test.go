@@ -0,0 +1,92 @@
+package db
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func Test_AssetReports(t *testing.T) {
+	s, _ := NewEmptyStore()
+	oldKey, _ := GenerateKey()
+	k, _ := NewKeyring(oldKey)
+	s.UseKeyring(k)
+	path := filepath.Join(t.TempDir(), "assets.json")
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error persisting: %v", err)
+	}
+
+	id, err := NewAssetReportID()
+	if err != nil || len(id) != 32 {
+		t.Fatalf("Unexpected job id %q, %v", id, err)
+	}
+	sealed, _ := s.SealToken("assets-sandbox-1")
+	job := &AssetReport{ID: id, User: "alice@test.com", ItemIDs: []string{"item-1"}, AssetReportID: "report-1", AssetReportToken: sealed, Status: AssetReportStatusPending}
+	if err := s.SaveAssetReport(job); err != nil {
+		t.Fatalf("Error saving asset report: %v", err)
+	}
+	if found, err := s.FindAssetReport("report-1"); err != nil || found.ID != id {
+		t.Errorf("Unexpected asset report %v, %v", found, err)
+	}
+	if _, err := s.GetAssetReport("missing"); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+	if jobs, _ := s.ListAssetReports("bob@test.com"); len(jobs) != 0 {
+		t.Errorf("Expected no jobs for bob, got %v", jobs)
+	}
+
+	ready := *job
+	ready.Status = AssetReportStatusReady
+	ready.Report = json.RawMessage(`{"asset_report_id":"report-1"}`)
+	ready.PDF = []byte("%PDF")
+	auditToken, _ := s.SealToken("a-sandbox-2")
+	ready.AuditCopies = []*AuditCopy{{AuditorID: "fannie_mae", Token: auditToken}}
+	if err := s.SaveAssetReport(&ready); err != nil {
+		t.Fatalf("Error saving asset report: %v", err)
+	}
+
+	// rotate the key and re-encrypt
+	newKey, _ := GenerateKey()
+	k.Rotate(newKey)
+	if n, err := s.ReencryptAssetReports(); err != nil || n != 1 {
+		t.Fatalf("Expected 1 asset report re-encrypted, got %d, %v", n, err)
+	}
+
+	// reload from the file with only the new key
+	s, _ = NewEmptyStore()
+	next, _ := NewKeyring(newKey)
+	s.UseKeyring(next)
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error loading: %v", err)
+	}
+	jobs, err := s.ListAssetReports("alice@test.com")
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected 1 job, got %d, %v", len(jobs), err)
+	}
+	if jobs[0].Status != AssetReportStatusReady || string(jobs[0].PDF) != "%PDF" || string(jobs[0].Report) != `{"asset_report_id":"report-1"}` {
+		t.Errorf("Unexpected job %+v", jobs[0])
+	}
+	if token, err := s.AssetReportToken(jobs[0]); token != "assets-sandbox-1" {
+		t.Errorf("Data mismatch, expected:  %s got: %s (%v)", "assets-sandbox-1", token, err)
+	}
+	if token, err := s.AuditCopyToken(jobs[0].AuditCopies[0]); token != "a-sandbox-2" {
+		t.Errorf("Data mismatch, expected:  %s got: %s (%v)", "a-sandbox-2", token, err)
+	}
+
+	// jobs are listed per item and can be deleted
+	if jobs, _ := s.ListItemAssetReports("item-1"); len(jobs) != 1 || jobs[0].ID != id {
+		t.Errorf("Expected job %s for item-1, got %v", id, jobs)
+	}
+	if jobs, _ := s.ListItemAssetReports("item-2"); len(jobs) != 0 {
+		t.Errorf("Expected no jobs for item-2, got %v", jobs)
+	}
+	if err := s.DeleteAssetReport(id); err != nil {
+		t.Fatalf("Error deleting asset report: %v", err)
+	}
+	if err := s.DeleteAssetReport(id); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+	if jobs, _ := s.ListItemAssetReports("item-1"); len(jobs) != 0 {
+		t.Errorf("Expected no jobs for item-1, got %v", jobs)
+	}
+}
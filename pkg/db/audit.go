@@ -0,0 +1,62 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"time"
+)
+
+// AuditItemRemoved is the action of audit events recording the removal of
+// an item.
+const AuditItemRemoved = "item.removed"
+
+// AuditUserDeleted is the action of audit events recording the deletion of
+// a user with all of its data.
+const AuditUserDeleted = "user.deleted"
+
+// AuditEvent records a change of a user's data that can not be undone, e.g.
+// the removal of an item. Audit events are kept once the data is gone.
+type AuditEvent struct {
+	ID   string `json:"id"`
+	User string `json:"user"`
+	// Actor is who made the change: the user with a session, which is the
+	// user itself or an admin, or "api_key:" followed by the id of the API
+	// key used.
+	Actor         string    `json:"actor"`
+	Action        string    `json:"action"`
+	ItemID        string    `json:"item_id,omitempty"`
+	InstitutionID string    `json:"institution_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NewAuditEventID returns a random audit event id.
+func NewAuditEventID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ListAuditEvents returns the audit events of a user, oldest first.
+func (s *Store) ListAuditEvents(user string) ([]*AuditEvent, error) {
+	txn := s.db.Txn(false)
+	defer txn.Abort()
+	iter, err := txn.Get("audit_event", "user", user)
+	if err != nil {
+		return nil, err
+	}
+	res := []*AuditEvent{}
+	for {
+		elem := iter.Next()
+		if elem == nil {
+			break
+		}
+		res = append(res, elem.(*AuditEvent))
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res, nil
+}
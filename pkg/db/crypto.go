@@ -0,0 +1,179 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const keySize = 32
+
+var (
+	ErrNoKeyring  = errors.New("no keyring configured for encryption at rest")
+	ErrUnknownKey = errors.New("access token sealed with an unknown key")
+)
+
+// Sealed is a value encrypted with envelope encryption: the data is
+// encrypted with a random data key, and the data key is wrapped with a key
+// encryption key of the Keyring identified by KeyID.
+type Sealed struct {
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key"`
+	Data       []byte `json:"data"`
+}
+
+// Keyring holds the key encryption keys used to seal access tokens at rest.
+// The primary key seals new values, the others are only used to open values
+// sealed before a key rotation.
+type Keyring struct {
+	mu      sync.RWMutex
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyring returns a keyring whose primary key is the first one given.
+// Keys must be 32 bytes long.
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeyring
+	}
+	k := &Keyring{keys: map[string][]byte{}}
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := k.Rotate(keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// ParseKeys decodes base64 encoded keys, one per line or comma separated.
+// Blank lines and lines starting with # are ignored.
+func ParseKeys(s string) ([][]byte, error) {
+	var keys [][]byte
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == '\n' || r == ','
+	}) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// GenerateKey returns a new random key encryption key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Rotate adds key to the keyring and makes it the primary key. Previous keys
+// are kept so values sealed with them can still be opened.
+func (k *Keyring) Rotate(key []byte) error {
+	if len(key) != keySize {
+		return fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	id := keyID(key)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = append([]byte(nil), key...)
+	k.primary = id
+	return nil
+}
+
+// Primary returns the id of the key used to seal new values.
+func (k *Keyring) Primary() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.primary
+}
+
+// Seal encrypts plaintext with a fresh data key wrapped by the primary key.
+func (k *Keyring) Seal(plaintext []byte) (*Sealed, error) {
+	k.mu.RLock()
+	id, kek := k.primary, k.keys[k.primary]
+	k.mu.RUnlock()
+
+	dek, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	data, err := encrypt(dek, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := encrypt(kek, dek)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealed{KeyID: id, WrappedKey: wrapped, Data: data}, nil
+}
+
+// Open decrypts a sealed value.
+func (k *Keyring) Open(s *Sealed) ([]byte, error) {
+	k.mu.RLock()
+	kek, ok := k.keys[s.KeyID]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	dek, err := decrypt(kek, s.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(dek, s.Data)
+}
+
+// encrypt seals plaintext with AES-GCM, prefixing the random nonce.
+func encrypt(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, data := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func Test_SealOpen(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	k, err := NewKeyring(key)
+	if err != nil {
+		t.Fatalf("Error creating keyring: %v", err)
+	}
+	sealed, err := k.Seal([]byte("access-sandbox-123"))
+	if err != nil {
+		t.Fatalf("Error sealing: %v", err)
+	}
+	if reflect.DeepEqual(sealed.Data, []byte("access-sandbox-123")) {
+		t.Errorf("Data stored in plain text")
+	}
+	b, err := k.Open(sealed)
+	if err != nil {
+		t.Fatalf("Error opening: %v", err)
+	}
+	if string(b) != "access-sandbox-123" {
+		t.Errorf("Data mismatch, expected:  %s got: %s", "access-sandbox-123", string(b))
+	}
+
+	// tampered data must not open
+	sealed.Data[len(sealed.Data)-1] ^= 1
+	if _, err := k.Open(sealed); err == nil {
+		t.Errorf("Expected error opening tampered data")
+	}
+}
+
+func Test_Rotate(t *testing.T) {
+	oldKey, _ := GenerateKey()
+	newKey, _ := GenerateKey()
+	k, _ := NewKeyring(oldKey)
+	sealed, _ := k.Seal([]byte("token"))
+
+	if err := k.Rotate(newKey); err != nil {
+		t.Fatalf("Error rotating key: %v", err)
+	}
+	if k.Primary() == sealed.KeyID {
+		t.Errorf("Primary key not rotated")
+	}
+	b, err := k.Open(sealed)
+	if err != nil || string(b) != "token" {
+		t.Errorf("Expected value sealed with old key to open, got %q, %v", string(b), err)
+	}
+
+	other, _ := NewKeyring(newKey)
+	if _, err := other.Open(sealed); err != ErrUnknownKey {
+		t.Errorf("Expected %v, got %v", ErrUnknownKey, err)
+	}
+}
+
+func Test_ParseKeys(t *testing.T) {
+	a, _ := GenerateKey()
+	b, _ := GenerateKey()
+	s := "# primary\n" + base64.StdEncoding.EncodeToString(a) + "\n\n" + base64.StdEncoding.EncodeToString(b) + "\n"
+	keys, err := ParseKeys(s)
+	if err != nil {
+		t.Fatalf("Error parsing keys: %v", err)
+	}
+	if !reflect.DeepEqual(keys, [][]byte{a, b}) {
+		t.Errorf("Data mismatch, expected:  %v got: %v", [][]byte{a, b}, keys)
+	}
+	if _, err := NewKeyring([]byte("short")); err == nil {
+		t.Errorf("Expected error for short key")
+	}
+}
@@ -1,20 +1,28 @@
 package db
 
 import (
+	"sync"
+
 	memdb "github.com/hashicorp/go-memdb"
 )
 
-type User struct {
-	Email string `json:"email"`
-	Name  string `json:"name"`
-}
+// Store holds users, their API keys, linked items, their transactions, asset
+// reports and audit events in memory, optionally persisted to a file.
+type Store struct {
+	db *memdb.MemDB
+	// keyring seals access tokens at rest
+	keyring *Keyring
 
-var d *memdb.MemDB
+	journalMu   sync.Mutex
+	journalPath string
+	// journaled is the number of records appended since the journal was
+	// last compacted, which it is again once they reach compactAt
+	journaled int
+	compactAt int
+}
 
-func Init() (*memdb.MemDB, error) {
-	if d != nil {
-		return d, nil
-	}
+// NewEmptyStore creates a store without any user.
+func NewEmptyStore() (*Store, error) {
 	// Create the DB schema
 	schema := &memdb.DBSchema{
 		Tables: map[string]*memdb.TableSchema{
@@ -33,6 +41,97 @@ func Init() (*memdb.MemDB, error) {
 					},
 				},
 			},
+			"transaction": &memdb.TableSchema{
+				Name: "transaction",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": &memdb.IndexSchema{
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "ID"},
+					},
+					"item": &memdb.IndexSchema{
+						Name:    "item",
+						Unique:  false,
+						Indexer: &memdb.StringFieldIndex{Field: "ItemID"},
+					},
+				},
+			},
+			"item": &memdb.TableSchema{
+				Name: "item",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": &memdb.IndexSchema{
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "ID"},
+					},
+					"user": &memdb.IndexSchema{
+						Name:    "user",
+						Unique:  false,
+						Indexer: &memdb.StringFieldIndex{Field: "User"},
+					},
+				},
+			},
+			"asset_report": &memdb.TableSchema{
+				Name: "asset_report",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": &memdb.IndexSchema{
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "ID"},
+					},
+					"user": &memdb.IndexSchema{
+						Name:    "user",
+						Unique:  false,
+						Indexer: &memdb.StringFieldIndex{Field: "User"},
+					},
+					"report": &memdb.IndexSchema{
+						Name:    "report",
+						Unique:  false,
+						Indexer: &memdb.StringFieldIndex{Field: "AssetReportID"},
+					},
+					"item": &memdb.IndexSchema{
+						Name:         "item",
+						Unique:       false,
+						AllowMissing: true,
+						Indexer:      &memdb.StringSliceFieldIndex{Field: "ItemIDs"},
+					},
+				},
+			},
+			"api_key": &memdb.TableSchema{
+				Name: "api_key",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": &memdb.IndexSchema{
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "ID"},
+					},
+					"user": &memdb.IndexSchema{
+						Name:    "user",
+						Unique:  false,
+						Indexer: &memdb.StringFieldIndex{Field: "User"},
+					},
+					"hash": &memdb.IndexSchema{
+						Name:    "hash",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "Hash"},
+					},
+				},
+			},
+			"audit_event": &memdb.TableSchema{
+				Name: "audit_event",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": &memdb.IndexSchema{
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "ID"},
+					},
+					"user": &memdb.IndexSchema{
+						Name:    "user",
+						Unique:  false,
+						Indexer: &memdb.StringFieldIndex{Field: "User"},
+					},
+				},
+			},
 		},
 	}
 
@@ -40,18 +139,25 @@ func Init() (*memdb.MemDB, error) {
 	if err != nil {
 		return nil, err
 	}
+	return &Store{db: d}, nil
+}
 
-	// Insert data
-	txn := d.Txn(true)
-	users := []*User{
-		&User{"bob@test.com", "Bob"},
-		&User{"alice@test.com", "Alice"},
+// DB returns the underlying database.
+func (s *Store) DB() *memdb.MemDB {
+	return s.db
+}
+
+// all calls fn with every row of a table.
+func all(txn *memdb.Txn, table string, fn func(interface{})) error {
+	iter, err := txn.Get(table, "id")
+	if err != nil {
+		return err
 	}
-	for _, u := range users {
-		if err := txn.Insert("user", u); err != nil {
-			return d, err
+	for {
+		elem := iter.Next()
+		if elem == nil {
+			return nil
 		}
+		fn(elem)
 	}
-	txn.Commit()
-	return d, nil
 }
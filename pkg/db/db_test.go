@@ -5,15 +5,15 @@ import (
 	"testing"
 )
 
-func Test_Init(t *testing.T) {
-	db, err := Init()
+func Test_NewEmptyStore(t *testing.T) {
+	s, err := NewEmptyStore()
 	if err != nil {
-		t.Errorf("Error creating database %v", err)
+		t.Fatalf("Error creating database %v", err)
 	}
-	if db == nil {
-		panic("null db pointer")
+	if err := s.SeedUsers(""); err != nil {
+		t.Fatalf("Error seeding users: %v", err)
 	}
-	txn := db.Txn(false)
+	txn := s.DB().Txn(false)
 	defer txn.Abort()
 
 	// test id indexing
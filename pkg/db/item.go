@@ -0,0 +1,239 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	memdb "github.com/hashicorp/go-memdb"
+)
+
+const (
+	ItemStatusHealthy = "healthy"
+	ItemStatusError   = "error"
+	// ItemStatusPendingExpiration is the status of items whose consent
+	// expires soon, until their user goes through Link update mode.
+	ItemStatusPendingExpiration = "pending_expiration"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Item is a Plaid item linked by a user. The access token is only stored
+// sealed with the configured Keyring.
+type Item struct {
+	ID            string    `json:"item_id"`
+	User          string    `json:"user"`
+	InstitutionID string    `json:"institution_id"`
+	AccessToken   *Sealed   `json:"access_token"`
+	Products      []string  `json:"products"`
+	CreatedAt     time.Time `json:"created_at"`
+	Status        string    `json:"status"`
+	// InstitutionName is the name of the institution, fetched once from
+	// Plaid.
+	InstitutionName string `json:"institution_name,omitempty"`
+	// Nickname is the name the user gave to the item, if any.
+	Nickname string `json:"nickname,omitempty"`
+	// ErrorCode is the Plaid error code of items in error, e.g.
+	// ITEM_LOGIN_REQUIRED.
+	ErrorCode string `json:"error_code,omitempty"`
+	// NewAccountsAvailable is set when the institution has accounts the
+	// user may add with Link update mode and account selection.
+	NewAccountsAvailable bool `json:"new_accounts_available,omitempty"`
+	// PaymentID is only relevant for the UK Payment Initiation product.
+	PaymentID string `json:"payment_id,omitempty"`
+	// TransferID is only relevant for the Transfer ACH product.
+	TransferID string `json:"transfer_id,omitempty"`
+	// TransferErrorCode is the Plaid error code of the transfer that failed
+	// to be created when the item was linked, if any.
+	TransferErrorCode string `json:"transfer_error_code,omitempty"`
+	// Cursor is the position of the last applied transactions sync page.
+	Cursor string `json:"cursor,omitempty"`
+	// LastSyncedAt is when transactions were last synced successfully.
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	// ConsentExpiresAt is when the consent of the user to share the item
+	// expires, at institutions where it does.
+	ConsentExpiresAt *time.Time `json:"consent_expires_at,omitempty"`
+	// CheckedAt is when the item was last checked with /item/get.
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// UseKeyring sets the keyring used to seal and open access tokens.
+func (s *Store) UseKeyring(k *Keyring) {
+	s.keyring = k
+}
+
+// SealToken encrypts an access token with the configured keyring.
+func (s *Store) SealToken(accessToken string) (*Sealed, error) {
+	if s.keyring == nil {
+		return nil, ErrNoKeyring
+	}
+	return s.keyring.Seal([]byte(accessToken))
+}
+
+// Token decrypts the access token of an item.
+func (s *Store) Token(i *Item) (string, error) {
+	if i.AccessToken == nil {
+		return "", errors.New("item has no access token")
+	}
+	return s.open(i.AccessToken)
+}
+
+// open decrypts a token sealed with the configured keyring.
+func (s *Store) open(sealed *Sealed) (string, error) {
+	if s.keyring == nil {
+		return "", ErrNoKeyring
+	}
+	b, err := s.keyring.Open(sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// reseal seals a token again with the primary key of the keyring.
+func (s *Store) reseal(sealed *Sealed) (*Sealed, error) {
+	token, err := s.open(sealed)
+	if err != nil {
+		return nil, err
+	}
+	return s.SealToken(token)
+}
+
+// SaveItem inserts or replaces an item.
+func (s *Store) SaveItem(item *Item) error {
+	txn := s.writeTxn()
+	defer txn.Abort()
+	if err := txn.Insert("item", item); err != nil {
+		return err
+	}
+	return s.commit(txn)
+}
+
+// UpdateItem applies fn to a copy of the item with the given item_id and
+// stores it, all in one write transaction so concurrent updates are not
+// lost. It returns the updated item.
+func (s *Store) UpdateItem(id string, fn func(*Item)) (*Item, error) {
+	txn := s.writeTxn()
+	defer txn.Abort()
+	raw, err := txn.First("item", "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	// rows are immutable once inserted, so update a copy
+	updated := *raw.(*Item)
+	fn(&updated)
+	if err := txn.Insert("item", &updated); err != nil {
+		return nil, err
+	}
+	return &updated, s.commit(txn)
+}
+
+// GetItem returns the item with the given item_id.
+func (s *Store) GetItem(id string) (*Item, error) {
+	txn := s.db.Txn(false)
+	defer txn.Abort()
+	raw, err := txn.First("item", "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	return raw.(*Item), nil
+}
+
+// ListItems returns the items linked by a user, or by every user when user
+// is empty.
+func (s *Store) ListItems(user string) ([]*Item, error) {
+	txn := s.db.Txn(false)
+	defer txn.Abort()
+	var iter memdb.ResultIterator
+	var err error
+	if user == "" {
+		iter, err = txn.Get("item", "id")
+	} else {
+		iter, err = txn.Get("item", "user", user)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := []*Item{}
+	for {
+		elem := iter.Next()
+		if elem == nil {
+			break
+		}
+		res = append(res, elem.(*Item))
+	}
+	return res, nil
+}
+
+// DeleteItem deletes an item, with its access token, cursor and
+// transactions, and records event, all in one write transaction so no item
+// is removed without a trace.
+func (s *Store) DeleteItem(id string, event *AuditEvent) error {
+	txn := s.writeTxn()
+	defer txn.Abort()
+	n, err := txn.DeleteAll("item", "id", id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	if _, err := txn.DeleteAll("transaction", "item", id); err != nil {
+		return err
+	}
+	if err := txn.Insert("audit_event", event); err != nil {
+		return err
+	}
+	return s.commit(txn)
+}
+
+// ReencryptItems re-seals the access token of every item that is not sealed
+// with the primary key of the keyring. It is run after a key rotation and
+// returns the number of items updated.
+func (s *Store) ReencryptItems() (int, error) {
+	if s.keyring == nil {
+		return 0, ErrNoKeyring
+	}
+	primary := s.keyring.Primary()
+	txn := s.writeTxn()
+	defer txn.Abort()
+	iter, err := txn.Get("item", "id")
+	if err != nil {
+		return 0, err
+	}
+	var stale []*Item
+	for {
+		elem := iter.Next()
+		if elem == nil {
+			break
+		}
+		if item := elem.(*Item); item.AccessToken != nil && item.AccessToken.KeyID != primary {
+			stale = append(stale, item)
+		}
+	}
+	for _, item := range stale {
+		token, err := s.Token(item)
+		if err != nil {
+			return 0, err
+		}
+		sealed, err := s.SealToken(token)
+		if err != nil {
+			return 0, err
+		}
+		// rows are immutable once inserted, so update a copy
+		updated := *item
+		updated.AccessToken = sealed
+		if err := txn.Insert("item", &updated); err != nil {
+			return 0, err
+		}
+	}
+	if err := s.commit(txn); err != nil {
+		return 0, err
+	}
+	return len(stale), s.compact()
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_Items(t *testing.T) {
+	s, _ := NewEmptyStore()
+	oldKey, _ := GenerateKey()
+	k, _ := NewKeyring(oldKey)
+	s.UseKeyring(k)
+	path := filepath.Join(t.TempDir(), "items.json")
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error persisting: %v", err)
+	}
+
+	sealed, err := s.SealToken("access-sandbox-1")
+	if err != nil {
+		t.Fatalf("Error sealing: %v", err)
+	}
+	if err := s.SaveItem(&Item{ID: "item-1", User: "alice@test.com", AccessToken: sealed}); err != nil {
+		t.Fatalf("Error saving item: %v", err)
+	}
+
+	items, err := s.ListItems("alice@test.com")
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Expected 1 item, got %d, %v", len(items), err)
+	}
+	if token, _ := s.Token(items[0]); token != "access-sandbox-1" {
+		t.Errorf("Data mismatch, expected:  %s got: %s", "access-sandbox-1", token)
+	}
+	if _, err := s.GetItem("missing"); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+
+	// rotate the key and re-encrypt
+	newKey, _ := GenerateKey()
+	k.Rotate(newKey)
+	n, err := s.ReencryptItems()
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 item re-encrypted, got %d, %v", n, err)
+	}
+
+	// reload from the file with only the new key
+	s, _ = NewEmptyStore()
+	next, _ := NewKeyring(newKey)
+	s.UseKeyring(next)
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error loading: %v", err)
+	}
+	item, err := s.GetItem("item-1")
+	if err != nil {
+		t.Fatalf("Error fetching item-1: %v", err)
+	}
+	if token, err := s.Token(item); token != "access-sandbox-1" {
+		t.Errorf("Data mismatch, expected:  %s got: %s (%v)", "access-sandbox-1", token, err)
+	}
+}
+
+func Test_UpdateItem(t *testing.T) {
+	s, _ := NewEmptyStore()
+	s.SaveItem(&Item{ID: "item-1", User: "alice@test.com", Status: ItemStatusHealthy, Cursor: "cursor-1"})
+	stored, _ := s.GetItem("item-1")
+
+	updated, err := s.UpdateItem("item-1", func(item *Item) {
+		item.Status = ItemStatusError
+		item.ErrorCode = "ITEM_LOGIN_REQUIRED"
+	})
+	if err != nil || updated.Status != ItemStatusError || updated.Cursor != "cursor-1" {
+		t.Fatalf("Unexpected item %v, %v", updated, err)
+	}
+	if item, _ := s.GetItem("item-1"); item.ErrorCode != "ITEM_LOGIN_REQUIRED" {
+		t.Errorf("Data mismatch, expected:  %v got: %v", "ITEM_LOGIN_REQUIRED", item.ErrorCode)
+	}
+	// stored rows are left untouched
+	if stored.Status != ItemStatusHealthy {
+		t.Errorf("Expected the previous row to be unchanged, got %v", stored)
+	}
+	if _, err := s.UpdateItem("missing", func(*Item) {}); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+
+	// items of every user are listed without a user
+	s.SaveItem(&Item{ID: "item-2", User: "bob@test.com"})
+	if items, _ := s.ListItems(""); len(items) != 2 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 2, len(items))
+	}
+}
+
+func Test_DeleteItem(t *testing.T) {
+	s, _ := NewEmptyStore()
+	key, _ := GenerateKey()
+	k, _ := NewKeyring(key)
+	s.UseKeyring(k)
+	path := filepath.Join(t.TempDir(), "items.json")
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error persisting: %v", err)
+	}
+	s.SaveItem(&Item{ID: "item-1", User: "alice@test.com"})
+	s.SaveItem(&Item{ID: "item-2", User: "alice@test.com"})
+	s.ApplyTransactionsSync("item-1", []*Transaction{{ID: "t1"}, {ID: "t2"}}, nil, nil, "cursor-1")
+	s.ApplyTransactionsSync("item-2", []*Transaction{{ID: "t3"}}, nil, nil, "cursor-2")
+
+	event := &AuditEvent{ID: "event-1", User: "alice@test.com", Actor: "alice@test.com", Action: AuditItemRemoved, ItemID: "item-1"}
+	if err := s.DeleteItem("item-1", event); err != nil {
+		t.Fatalf("Error deleting item: %v", err)
+	}
+	if _, err := s.GetItem("item-1"); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+	if transactions, _ := s.ListTransactions("item-1"); len(transactions) != 0 {
+		t.Errorf("Expected the transactions to be deleted, got %v", transactions)
+	}
+	if transactions, _ := s.ListTransactions("item-2"); len(transactions) != 1 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 1, len(transactions))
+	}
+	if err := s.DeleteItem("item-1", &AuditEvent{ID: "event-2", User: "alice@test.com"}); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+
+	// the audit event outlives the item
+	s, _ = NewEmptyStore()
+	s.UseKeyring(k)
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error loading: %v", err)
+	}
+	events, err := s.ListAuditEvents("alice@test.com")
+	if err != nil || len(events) != 1 || events[0].ItemID != "item-1" || events[0].Action != AuditItemRemoved {
+		t.Errorf("Unexpected audit events %v, %v", events, err)
+	}
+	if events, _ := s.ListAuditEvents("bob@test.com"); len(events) != 0 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 0, len(events))
+	}
+}
@@ -0,0 +1,241 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	memdb "github.com/hashicorp/go-memdb"
+)
+
+// minCompaction is the number of records appended to the journal before it
+// is compacted, unless the store holds more rows than that.
+const minCompaction = 10000
+
+// persisted are the tables written to the journal, in the order they are
+// compacted, with a function returning an empty row of the table.
+var persisted = []struct {
+	table string
+	row   func() interface{}
+}{
+	{"user", func() interface{} { return &User{} }},
+	{"api_key", func() interface{} { return &APIKey{} }},
+	{"item", func() interface{} { return &Item{} }},
+	{"transaction", func() interface{} { return &Transaction{} }},
+	{"asset_report", func() interface{} { return &AssetReport{} }},
+	{"audit_event", func() interface{} { return &AuditEvent{} }},
+}
+
+// record is a line of the journal: a row inserted in or deleted from a
+// table. The row is sealed with the keyring, so the file holds no user data
+// in plaintext.
+type record struct {
+	Table  string  `json:"table"`
+	Delete bool    `json:"delete,omitempty"`
+	Row    *Sealed `json:"row"`
+}
+
+// Persist loads the users, API keys, items, transactions, asset reports and
+// audit events journaled in the file at path, if it exists, and appends
+// every later change of those tables to it. Rows are sealed with the keyring
+// set with UseKeyring. The journal is compacted on load and once it grows
+// past the number of rows stored.
+func (s *Store) Persist(path string) error {
+	if s.keyring == nil {
+		return ErrNoKeyring
+	}
+	s.journalMu.Lock()
+	defer s.journalMu.Unlock()
+	if err := s.replay(path); err != nil {
+		return err
+	}
+	s.journalPath = path
+	return s.compactLocked()
+}
+
+// replay applies the records of the journal at path, if it exists.
+func (s *Store) replay(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rows := map[string]func() interface{}{}
+	for _, p := range persisted {
+		rows[p.table] = p.row
+	}
+	txn := s.db.Txn(true)
+	defer txn.Abort()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		row, ok := rows[rec.Table]
+		if !ok || rec.Row == nil {
+			return fmt.Errorf("%s:%d: invalid record", path, line)
+		}
+		b, err := s.keyring.Open(rec.Row)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		obj := row()
+		if err := json.Unmarshal(b, obj); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if rec.Delete {
+			err = txn.Delete(rec.Table, obj)
+			if errors.Is(err, memdb.ErrNotFound) {
+				err = nil
+			}
+		} else {
+			err = txn.Insert(rec.Table, obj)
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+// writeTxn starts a write transaction whose changes are journaled by commit.
+func (s *Store) writeTxn() *memdb.Txn {
+	txn := s.db.Txn(true)
+	txn.TrackChanges()
+	return txn
+}
+
+// commit commits a transaction started with writeTxn and appends its changes
+// to the journal, if any. The journal lock is taken before the commit so the
+// journal holds the changes in the order they were made.
+func (s *Store) commit(txn *memdb.Txn) error {
+	changes := txn.Changes()
+	s.journalMu.Lock()
+	defer s.journalMu.Unlock()
+	txn.Commit()
+	if s.journalPath == "" || len(changes) == 0 {
+		return nil
+	}
+	var b []byte
+	for _, c := range changes {
+		row := c.After
+		if c.Deleted() {
+			row = c.Before
+		} else if row == nil {
+			// inserted and deleted in the same transaction
+			continue
+		}
+		rec, err := s.seal(c.Table, row, c.Deleted())
+		if err != nil {
+			return err
+		}
+		b = append(b, rec...)
+	}
+	f, err := os.OpenFile(s.journalPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.journaled += len(changes)
+	if s.journaled < s.compactAt {
+		return nil
+	}
+	return s.compactLocked()
+}
+
+// compact rewrites the journal with one record per row, sealed with the
+// primary key of the keyring. It is run after a key rotation so the journal
+// no longer needs the previous keys.
+func (s *Store) compact() error {
+	s.journalMu.Lock()
+	defer s.journalMu.Unlock()
+	if s.journalPath == "" {
+		return nil
+	}
+	return s.compactLocked()
+}
+
+func (s *Store) compactLocked() error {
+	txn := s.db.Txn(false)
+	defer txn.Abort()
+	tmp, err := os.CreateTemp(filepath.Dir(s.journalPath), filepath.Base(s.journalPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	rows := 0
+	for _, p := range persisted {
+		table := p.table
+		if err := all(txn, table, func(raw interface{}) {
+			if err != nil {
+				return
+			}
+			var rec []byte
+			if rec, err = s.seal(table, raw, false); err == nil {
+				_, err = w.Write(rec)
+				rows++
+			}
+		}); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.journalPath); err != nil {
+		return err
+	}
+	s.journaled = 0
+	s.compactAt = minCompaction
+	if rows > s.compactAt {
+		s.compactAt = rows
+	}
+	return nil
+}
+
+// seal returns the journal line of a row inserted in or deleted from a
+// table.
+func (s *Store) seal(table string, row interface{}, deleted bool) ([]byte, error) {
+	b, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.keyring.Seal(b)
+	if err != nil {
+		return nil, err
+	}
+	b, err = json.Marshal(record{Table: table, Delete: deleted, Row: sealed})
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func lines(t *testing.T, path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v", path, err)
+	}
+	return bytes.Count(b, []byte("\n"))
+}
+
+func Test_Persist(t *testing.T) {
+	s, _ := NewEmptyStore()
+	path := filepath.Join(t.TempDir(), "db.json")
+	if err := s.Persist(path); err != ErrNoKeyring {
+		t.Errorf("Expected %v, got %v", ErrNoKeyring, err)
+	}
+	key, _ := GenerateKey()
+	k, _ := NewKeyring(key)
+	s.UseKeyring(k)
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error persisting: %v", err)
+	}
+	s.CreateUser(&User{Email: "carol@test.com", Name: "Carol"})
+	s.SaveItem(&Item{ID: "item-1", User: "carol@test.com"})
+	if n := lines(t, path); n != 2 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 2, n)
+	}
+
+	// a write appends its changes only
+	err := s.ApplyTransactionsSync("item-1", []*Transaction{
+		{ID: "t1", Amount: 12.5, Name: "Coffee"},
+		{ID: "t2", Amount: 40, Name: "Groceries"},
+	}, nil, nil, "cursor-1")
+	if err != nil {
+		t.Fatalf("Error applying transactions: %v", err)
+	}
+	if n := lines(t, path); n != 5 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 5, n)
+	}
+	if err := s.ApplyTransactionsSync("item-1", nil, nil, []string{"t1"}, "cursor-2"); err != nil {
+		t.Fatalf("Error applying transactions: %v", err)
+	}
+	if n := lines(t, path); n != 7 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 7, n)
+	}
+	b, _ := os.ReadFile(path)
+	for _, plain := range []string{"carol@test.com", "Groceries", "cursor-1"} {
+		if bytes.Contains(b, []byte(plain)) {
+			t.Errorf("Expected %q to be sealed in the file", plain)
+		}
+	}
+
+	// reload and compact the file
+	s, _ = NewEmptyStore()
+	s.UseKeyring(k)
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error loading: %v", err)
+	}
+	transactions, _ := s.ListTransactions("item-1")
+	if len(transactions) != 1 || transactions[0].Name != "Groceries" {
+		t.Errorf("Unexpected transactions %v", transactions)
+	}
+	if item, err := s.GetItem("item-1"); err != nil || item.Cursor != "cursor-2" {
+		t.Errorf("Unexpected item %v, %v", item, err)
+	}
+	if n := lines(t, path); n != 3 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 3, n)
+	}
+
+	// the file is compacted again once it has grown enough
+	s.compactAt = 2
+	s.UpdateItem("item-1", func(item *Item) { item.Cursor = "cursor-3" })
+	if n := lines(t, path); n != 4 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 4, n)
+	}
+	s.UpdateItem("item-1", func(item *Item) { item.Cursor = "cursor-4" })
+	if n := lines(t, path); n != 3 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 3, n)
+	}
+
+	// a key unknown to the keyring can not read the file
+	other, _ := GenerateKey()
+	k, _ = NewKeyring(other)
+	s, _ = NewEmptyStore()
+	s.UseKeyring(k)
+	if err := s.Persist(path); err == nil {
+		t.Errorf("Expected an error loading with another key")
+	}
+}
@@ -0,0 +1,236 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Transaction is a transaction of a linked item, kept up to date through
+// /transactions/sync.
+type Transaction struct {
+	ID              string   `json:"transaction_id"`
+	ItemID          string   `json:"item_id"`
+	AccountID       string   `json:"account_id"`
+	Amount          float64  `json:"amount"`
+	IsoCurrencyCode string   `json:"iso_currency_code"`
+	Date            string   `json:"date"`
+	Name            string   `json:"name"`
+	MerchantName    string   `json:"merchant_name,omitempty"`
+	Category        []string `json:"category"`
+	Pending         bool     `json:"pending"`
+}
+
+// ApplyTransactionsSync applies /transactions/sync updates to the
+// transactions of an item and stores the cursor following them, all in one
+// write transaction so the cursor never gets ahead of the stored data. The
+// item is marked synced now.
+func (s *Store) ApplyTransactionsSync(itemID string, added, modified []*Transaction, removed []string, cursor string) error {
+	txn := s.writeTxn()
+	defer txn.Abort()
+
+	raw, err := txn.First("item", "id", itemID)
+	if err != nil {
+		return err
+	}
+	if raw == nil {
+		return ErrNotFound
+	}
+	for _, t := range append(added, modified...) {
+		t.ItemID = itemID
+		if err := txn.Insert("transaction", t); err != nil {
+			return err
+		}
+	}
+	for _, id := range removed {
+		if _, err := txn.DeleteAll("transaction", "id", id); err != nil {
+			return err
+		}
+	}
+	item := *raw.(*Item)
+	item.Cursor = cursor
+	now := time.Now()
+	item.LastSyncedAt = &now
+	if err := txn.Insert("item", &item); err != nil {
+		return err
+	}
+	return s.commit(txn)
+}
+
+// ListTransactions returns the stored transactions of an item.
+func (s *Store) ListTransactions(itemID string) ([]*Transaction, error) {
+	txn := s.db.Txn(false)
+	defer txn.Abort()
+	iter, err := txn.Get("transaction", "item", itemID)
+	if err != nil {
+		return nil, err
+	}
+	res := []*Transaction{}
+	for {
+		elem := iter.Next()
+		if elem == nil {
+			break
+		}
+		res = append(res, elem.(*Transaction))
+	}
+	return res, nil
+}
+
+// TransactionQuery selects and orders the stored transactions of an item.
+// Zero values leave a filter unset.
+type TransactionQuery struct {
+	ItemID     string
+	StartDate  string // inclusive, YYYY-MM-DD
+	EndDate    string // inclusive, YYYY-MM-DD
+	AccountIDs []string
+	MinAmount  *float64
+	MaxAmount  *float64
+	// Category matches any level of the category hierarchy, ignoring case.
+	Category string
+	// Merchant matches part of the merchant name or the transaction name,
+	// ignoring case.
+	Merchant string
+	// Ascending orders by oldest date first, otherwise latest first.
+	Ascending bool
+	// Cursor is the next page token returned by the previous page.
+	Cursor string
+	Limit  int
+}
+
+const (
+	DefaultPageSize = 25
+	MaxPageSize     = 500
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// pageKey is the position of the last transaction of a page. Pages continue
+// after it, so they stay stable when transactions are added or removed.
+type pageKey struct {
+	Date string `json:"d"`
+	ID   string `json:"i"`
+}
+
+// QueryTransactions returns one page of the transactions matching q, the
+// total count of matching transactions and the token of the next page, which
+// is empty on the last page.
+func (s *Store) QueryTransactions(q TransactionQuery) ([]*Transaction, int, string, error) {
+	var after *pageKey
+	if q.Cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil {
+			return nil, 0, "", ErrInvalidCursor
+		}
+		after = &pageKey{}
+		if err := json.Unmarshal(b, after); err != nil {
+			return nil, 0, "", ErrInvalidCursor
+		}
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	transactions, err := s.ListTransactions(q.ItemID)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	matches := []*Transaction{}
+	for _, t := range transactions {
+		if q.matches(t) {
+			matches = append(matches, t)
+		}
+	}
+	less := func(a, b pageKey) bool {
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		return a.ID < b.ID
+	}
+	if !q.Ascending {
+		asc := less
+		less = func(a, b pageKey) bool { return asc(b, a) }
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return less(keyOf(matches[i]), keyOf(matches[j]))
+	})
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(matches), func(i int) bool {
+			return less(*after, keyOf(matches[i]))
+		})
+	}
+	end := start + limit
+	if end > len(matches) {
+		end = len(matches)
+	}
+	page := matches[start:end]
+
+	next := ""
+	if end < len(matches) {
+		b, err := json.Marshal(keyOf(page[len(page)-1]))
+		if err != nil {
+			return nil, 0, "", err
+		}
+		next = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return page, len(matches), next, nil
+}
+
+func keyOf(t *Transaction) pageKey {
+	return pageKey{Date: t.Date, ID: t.ID}
+}
+
+func (q TransactionQuery) matches(t *Transaction) bool {
+	if q.StartDate != "" && t.Date < q.StartDate {
+		return false
+	}
+	if q.EndDate != "" && t.Date > q.EndDate {
+		return false
+	}
+	if len(q.AccountIDs) > 0 && !contains(q.AccountIDs, t.AccountID) {
+		return false
+	}
+	if q.MinAmount != nil && t.Amount < *q.MinAmount {
+		return false
+	}
+	if q.MaxAmount != nil && t.Amount > *q.MaxAmount {
+		return false
+	}
+	if q.Category != "" {
+		found := false
+		for _, c := range t.Category {
+			if strings.EqualFold(c, q.Category) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Merchant != "" {
+		merchant := strings.ToLower(q.Merchant)
+		if !strings.Contains(strings.ToLower(t.MerchantName), merchant) &&
+			!strings.Contains(strings.ToLower(t.Name), merchant) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
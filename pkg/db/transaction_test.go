@@ -0,0 +1,134 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ApplyTransactionsSync(t *testing.T) {
+	s, _ := NewEmptyStore()
+	if err := s.SaveItem(&Item{ID: "item-sync", User: "bob@test.com"}); err != nil {
+		t.Fatalf("Error saving item: %v", err)
+	}
+
+	err := s.ApplyTransactionsSync("item-sync", []*Transaction{
+		{ID: "t1", AccountID: "a1", Amount: 12.5, Date: "2022-01-01", Name: "Coffee"},
+		{ID: "t2", AccountID: "a1", Amount: 40, Date: "2022-01-02", Name: "Groceries"},
+	}, nil, nil, "cursor-1")
+	if err != nil {
+		t.Fatalf("Error applying first page: %v", err)
+	}
+	err = s.ApplyTransactionsSync("item-sync", nil, []*Transaction{
+		{ID: "t2", AccountID: "a1", Amount: 42, Date: "2022-01-02", Name: "Groceries"},
+	}, []string{"t1"}, "cursor-2")
+	if err != nil {
+		t.Fatalf("Error applying second page: %v", err)
+	}
+
+	transactions, err := s.ListTransactions("item-sync")
+	if err != nil {
+		t.Fatalf("Error listing transactions: %v", err)
+	}
+	if len(transactions) != 1 {
+		t.Fatalf("Wrong transaction counts - expected 1, actual %d", len(transactions))
+	}
+	if transactions[0].ID != "t2" || transactions[0].Amount != 42 || transactions[0].ItemID != "item-sync" {
+		t.Errorf("Data mismatch, got: %v", transactions[0])
+	}
+	item, err := s.GetItem("item-sync")
+	if err != nil {
+		t.Fatalf("Error fetching item: %v", err)
+	}
+	if item.Cursor != "cursor-2" {
+		t.Errorf("Data mismatch, expected:  %s got: %s", "cursor-2", item.Cursor)
+	}
+	if item.LastSyncedAt == nil {
+		t.Errorf("Expected the item to be marked synced")
+	}
+
+	if err := s.ApplyTransactionsSync("missing", nil, nil, nil, "c"); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+}
+
+func Test_QueryTransactions(t *testing.T) {
+	s, _ := NewEmptyStore()
+	if err := s.SaveItem(&Item{ID: "item-query", User: "bob@test.com"}); err != nil {
+		t.Fatalf("Error saving item: %v", err)
+	}
+	err := s.ApplyTransactionsSync("item-query", []*Transaction{
+		{ID: "t1", AccountID: "a1", Amount: 5, Date: "2022-01-01", Name: "Starbucks", Category: []string{"Food and Drink", "Coffee Shop"}},
+		{ID: "t2", AccountID: "a1", Amount: 80, Date: "2022-01-02", Name: "Whole Foods", MerchantName: "Whole Foods Market", Category: []string{"Shops", "Supermarkets"}},
+		{ID: "t3", AccountID: "a2", Amount: 1200, Date: "2022-01-02", Name: "Rent", Category: []string{"Payment", "Rent"}},
+		{ID: "t4", AccountID: "a2", Amount: 4.5, Date: "2022-01-05", Name: "Starbucks", Category: []string{"Food and Drink", "Coffee Shop"}},
+		{ID: "t5", AccountID: "a1", Amount: 30, Date: "2022-02-01", Name: "Uber", Category: []string{"Travel", "Taxi"}},
+	}, nil, nil, "cursor")
+	if err != nil {
+		t.Fatalf("Error applying transactions: %v", err)
+	}
+
+	ids := func(transactions []*Transaction) []string {
+		var res []string
+		for _, t := range transactions {
+			res = append(res, t.ID)
+		}
+		return res
+	}
+	min, max := 5.0, 100.0
+	tests := []struct {
+		name  string
+		query TransactionQuery
+		want  []string
+	}{
+		{"latest first", TransactionQuery{}, []string{"t5", "t4", "t3", "t2", "t1"}},
+		{"oldest first", TransactionQuery{Ascending: true}, []string{"t1", "t2", "t3", "t4", "t5"}},
+		{"date range", TransactionQuery{StartDate: "2022-01-02", EndDate: "2022-01-05"}, []string{"t4", "t3", "t2"}},
+		{"account", TransactionQuery{AccountIDs: []string{"a2"}}, []string{"t4", "t3"}},
+		{"amount", TransactionQuery{MinAmount: &min, MaxAmount: &max}, []string{"t5", "t2", "t1"}},
+		{"category", TransactionQuery{Category: "coffee shop"}, []string{"t4", "t1"}},
+		{"merchant", TransactionQuery{Merchant: "market"}, []string{"t2"}},
+		{"name", TransactionQuery{Merchant: "starbucks", Ascending: true}, []string{"t1", "t4"}},
+	}
+	for _, tt := range tests {
+		tt.query.ItemID = "item-query"
+		page, total, next, err := s.QueryTransactions(tt.query)
+		if err != nil {
+			t.Errorf("%s: error querying: %v", tt.name, err)
+			continue
+		}
+		if got := ids(page); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v got %v", tt.name, tt.want, got)
+		}
+		if total != len(tt.want) || next != "" {
+			t.Errorf("%s: expected total %d and no next page, got %d %q", tt.name, len(tt.want), total, next)
+		}
+	}
+
+	// walk the pages, removing a transaction between pages
+	var got []string
+	q := TransactionQuery{ItemID: "item-query", Limit: 2}
+	for i := 0; ; i++ {
+		page, total, next, err := s.QueryTransactions(q)
+		if err != nil {
+			t.Fatalf("Error querying page %d: %v", i, err)
+		}
+		got = append(got, ids(page)...)
+		if i == 0 {
+			if total != 5 {
+				t.Errorf("Expected total 5, got %d", total)
+			}
+			s.ApplyTransactionsSync("item-query", nil, nil, []string{"t5"}, "cursor")
+		}
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+	if want := []string{"t5", "t4", "t3", "t2", "t1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected pages %v got %v", want, got)
+	}
+
+	if _, _, _, err := s.QueryTransactions(TransactionQuery{ItemID: "item-query", Cursor: "%%%"}); err != ErrInvalidCursor {
+		t.Errorf("Expected %v, got %v", ErrInvalidCursor, err)
+	}
+}
@@ -0,0 +1,156 @@
+package db
+
+import "errors"
+
+// ErrUserExists is returned when creating a user with the email of an
+// existing user.
+var ErrUserExists = errors.New("user already exists")
+
+type User struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	// PasswordHash is the bcrypt hash of the password of the user. Users
+	// without one can not log in.
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// SeedUsers inserts the test users with the given bcrypt password hash,
+// replacing users with the same email. With an empty hash nobody can log in
+// as them until a password is set.
+func (s *Store) SeedUsers(passwordHash string) error {
+	txn := s.writeTxn()
+	defer txn.Abort()
+	users := []*User{
+		&User{"bob@test.com", "Bob", passwordHash},
+		&User{"alice@test.com", "Alice", passwordHash},
+	}
+	for _, u := range users {
+		if err := txn.Insert("user", u); err != nil {
+			return err
+		}
+	}
+	return s.commit(txn)
+}
+
+// GetUser returns the user with the given email.
+func (s *Store) GetUser(email string) (*User, error) {
+	txn := s.db.Txn(false)
+	defer txn.Abort()
+	raw, err := txn.First("user", "id", email)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	return raw.(*User), nil
+}
+
+// CreateUser inserts a new user, failing with ErrUserExists if its email is
+// taken.
+func (s *Store) CreateUser(u *User) error {
+	txn := s.writeTxn()
+	defer txn.Abort()
+	raw, err := txn.First("user", "id", u.Email)
+	if err != nil {
+		return err
+	}
+	if raw != nil {
+		return ErrUserExists
+	}
+	if err := txn.Insert("user", u); err != nil {
+		return err
+	}
+	return s.commit(txn)
+}
+
+// UpdateUser replaces the user with the email of u, failing with
+// ErrNotFound if there is none.
+func (s *Store) UpdateUser(u *User) error {
+	txn := s.writeTxn()
+	defer txn.Abort()
+	raw, err := txn.First("user", "id", u.Email)
+	if err != nil {
+		return err
+	}
+	if raw == nil {
+		return ErrNotFound
+	}
+	if err := txn.Insert("user", u); err != nil {
+		return err
+	}
+	return s.commit(txn)
+}
+
+// DeleteUser deletes the user with the given email, revoking its API keys
+// and deleting its items, their transactions and its asset reports, and
+// records event in the same write transaction. Items should be removed at
+// Plaid first.
+func (s *Store) DeleteUser(email string, event *AuditEvent) error {
+	txn := s.writeTxn()
+	defer txn.Abort()
+	n, err := txn.DeleteAll("user", "id", email)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	if _, err := txn.DeleteAll("api_key", "user", email); err != nil {
+		return err
+	}
+	// the items are keyed by email, so whoever signs up with it next must
+	// not find them
+	iter, err := txn.Get("item", "user", email)
+	if err != nil {
+		return err
+	}
+	var itemIDs []string
+	for elem := iter.Next(); elem != nil; elem = iter.Next() {
+		itemIDs = append(itemIDs, elem.(*Item).ID)
+	}
+	for _, id := range itemIDs {
+		if _, err := txn.DeleteAll("item", "id", id); err != nil {
+			return err
+		}
+		if _, err := txn.DeleteAll("transaction", "item", id); err != nil {
+			return err
+		}
+	}
+	if _, err := txn.DeleteAll("asset_report", "user", email); err != nil {
+		return err
+	}
+	if err := txn.Insert("audit_event", event); err != nil {
+		return err
+	}
+	return s.commit(txn)
+}
+
+// ListUsers returns every user, ordered by email.
+func (s *Store) ListUsers() ([]*User, error) {
+	return s.listUsers("id")
+}
+
+// SearchUsers returns the users whose name starts with prefix, ordered by
+// name.
+func (s *Store) SearchUsers(prefix string) ([]*User, error) {
+	return s.listUsers("name_prefix", prefix)
+}
+
+func (s *Store) listUsers(index string, args ...interface{}) ([]*User, error) {
+	txn := s.db.Txn(false)
+	defer txn.Abort()
+	iter, err := txn.Get("user", index, args...)
+	if err != nil {
+		return nil, err
+	}
+	res := []*User{}
+	for {
+		elem := iter.Next()
+		if elem == nil {
+			break
+		}
+		res = append(res, elem.(*User))
+	}
+	return res, nil
+}
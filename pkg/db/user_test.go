@@ -0,0 +1,88 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_Users(t *testing.T) {
+	s, _ := NewEmptyStore()
+	key, _ := GenerateKey()
+	k, _ := NewKeyring(key)
+	s.UseKeyring(k)
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error persisting: %v", err)
+	}
+	if users, _ := s.ListUsers(); len(users) != 0 {
+		t.Errorf("Expected no users, got %v", users)
+	}
+
+	for _, u := range []*User{{Email: "carol@test.com", Name: "Carol"}, {Email: "alice@test.com", Name: "Alice"}, {Email: "al@test.com", Name: "Al"}} {
+		if err := s.CreateUser(u); err != nil {
+			t.Fatalf("Error creating user %v: %v", u, err)
+		}
+	}
+	if err := s.CreateUser(&User{Email: "alice@test.com", Name: "Other Alice"}); err != ErrUserExists {
+		t.Errorf("Expected %v, got %v", ErrUserExists, err)
+	}
+	if users, _ := s.ListUsers(); len(users) != 3 || users[0].Email != "al@test.com" {
+		t.Errorf("Unexpected users %v", users)
+	}
+	users, err := s.SearchUsers("Al")
+	if err != nil || len(users) != 2 || users[0].Name != "Al" || users[1].Name != "Alice" {
+		t.Errorf("Unexpected users %v, %v", users, err)
+	}
+
+	if err := s.UpdateUser(&User{Email: "carol@test.com", Name: "Caroline"}); err != nil {
+		t.Fatalf("Error updating user: %v", err)
+	}
+	if err := s.UpdateUser(&User{Email: "dave@test.com", Name: "Dave"}); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+	if users, _ := s.SearchUsers("Carol"); len(users) != 1 || users[0].Name != "Caroline" {
+		t.Errorf("Unexpected users %v", users)
+	}
+	s.SaveItem(&Item{ID: "item-al", User: "al@test.com"})
+	s.SaveItem(&Item{ID: "item-carol", User: "carol@test.com"})
+	s.ApplyTransactionsSync("item-al", []*Transaction{{ID: "t1"}}, nil, nil, "cursor")
+	s.SaveAssetReport(&AssetReport{ID: "job-al", User: "al@test.com", ItemIDs: []string{"item-al"}})
+	event := &AuditEvent{ID: "event-1", User: "al@test.com", Actor: "admin@test.com", Action: AuditUserDeleted}
+	if err := s.DeleteUser("al@test.com", event); err != nil {
+		t.Fatalf("Error deleting user: %v", err)
+	}
+	// nothing of the user is left for whoever signs up with the email next
+	if items, _ := s.ListItems("al@test.com"); len(items) != 0 {
+		t.Errorf("Expected the items to be deleted, got %v", items)
+	}
+	if transactions, _ := s.ListTransactions("item-al"); len(transactions) != 0 {
+		t.Errorf("Expected the transactions to be deleted, got %v", transactions)
+	}
+	if jobs, _ := s.ListAssetReports("al@test.com"); len(jobs) != 0 {
+		t.Errorf("Expected the asset reports to be deleted, got %v", jobs)
+	}
+	if _, err := s.GetItem("item-carol"); err != nil {
+		t.Errorf("Expected the items of other users to be kept, got %v", err)
+	}
+	if err := s.DeleteUser("al@test.com", &AuditEvent{ID: "event-2", User: "al@test.com"}); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+
+	// reload from the file
+	s, _ = NewEmptyStore()
+	s.UseKeyring(k)
+	if err := s.Persist(path); err != nil {
+		t.Fatalf("Error loading: %v", err)
+	}
+	if u, err := s.GetUser("carol@test.com"); err != nil || u.Name != "Caroline" {
+		t.Errorf("Unexpected user %v, %v", u, err)
+	}
+	if _, err := s.GetUser("al@test.com"); err != ErrNotFound {
+		t.Errorf("Expected %v, got %v", ErrNotFound, err)
+	}
+	// the deletion outlives the user
+	events, err := s.ListAuditEvents("al@test.com")
+	if err != nil || len(events) != 1 || events[0].Action != AuditUserDeleted || events[0].Actor != "admin@test.com" {
+		t.Errorf("Unexpected audit events %v, %v", events, err)
+	}
+}
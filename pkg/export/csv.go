@@ -0,0 +1,81 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+// DefaultColumns are the CSV columns written when none are requested.
+var DefaultColumns = []string{
+	"date", "name", "merchant_name", "amount", "iso_currency_code",
+	"category", "account_id", "transaction_id", "pending",
+}
+
+// csvColumns maps a column name to the value it takes from a transaction.
+var csvColumns = map[string]func(t *db.Transaction) string{
+	"transaction_id":    func(t *db.Transaction) string { return t.ID },
+	"item_id":           func(t *db.Transaction) string { return t.ItemID },
+	"account_id":        func(t *db.Transaction) string { return t.AccountID },
+	"date":              func(t *db.Transaction) string { return t.Date },
+	"name":              func(t *db.Transaction) string { return cell(t.Name) },
+	"merchant_name":     func(t *db.Transaction) string { return cell(t.MerchantName) },
+	"amount":            func(t *db.Transaction) string { return strconv.FormatFloat(t.Amount, 'f', 2, 64) },
+	"iso_currency_code": func(t *db.Transaction) string { return t.IsoCurrencyCode },
+	"category":          func(t *db.Transaction) string { return cell(strings.Join(t.Category, " > ")) },
+	"pending":           func(t *db.Transaction) string { return strconv.FormatBool(t.Pending) },
+}
+
+// cell quotes text that spreadsheets would run as a formula, such as a
+// transaction named "=HYPERLINK(...)", with a leading single quote.
+func cell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// CheckColumns returns an error naming the first unknown CSV column.
+func CheckColumns(columns []string) error {
+	for _, column := range columns {
+		if _, ok := csvColumns[column]; !ok {
+			return fmt.Errorf("unknown column %q", column)
+		}
+	}
+	return nil
+}
+
+// CSV writes transactions as CSV with a header row. Amounts keep the Plaid
+// sign convention: positive amounts are money moving out of the account.
+func CSV(w io.Writer, transactions []*db.Transaction, columns []string) error {
+	if len(columns) == 0 {
+		columns = DefaultColumns
+	}
+	if err := CheckColumns(columns); err != nil {
+		return err
+	}
+	values := make([]func(t *db.Transaction) string, len(columns))
+	for i, column := range columns {
+		values[i] = csvColumns[column]
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, t := range transactions {
+		for i, value := range values {
+			record[i] = value(t)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
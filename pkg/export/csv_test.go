@@ -0,0 +1,44 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+var transactions = []*db.Transaction{
+	{ID: "t2", AccountID: "a1", Amount: 80, IsoCurrencyCode: "USD", Date: "2022-01-02", Name: "Whole Foods", MerchantName: "Whole Foods Market", Category: []string{"Shops", "Supermarkets"}},
+	{ID: "t1", AccountID: "a1", Amount: -500, IsoCurrencyCode: "USD", Date: "2022-01-01", Name: "Payroll, \"ACME\"", Category: []string{"Transfer", "Payroll"}},
+	{ID: "t3", AccountID: "a2", Amount: 4.5, IsoCurrencyCode: "USD", Date: "2022-01-05", Name: "Starbucks", Category: []string{"Food and Drink", "Coffee Shop"}},
+}
+
+func Test_CSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := CSV(&b, transactions, []string{"date", "name", "amount", "category"}); err != nil {
+		t.Fatalf("Error writing csv: %v", err)
+	}
+	expected := "date,name,amount,category\n" +
+		"2022-01-02,Whole Foods,80.00,Shops > Supermarkets\n" +
+		"2022-01-01,\"Payroll, \"\"ACME\"\"\",-500.00,Transfer > Payroll\n" +
+		"2022-01-05,Starbucks,4.50,Food and Drink > Coffee Shop\n"
+	if b.String() != expected {
+		t.Errorf("Expected %v\tGot %v", expected, b.String())
+	}
+
+	// text spreadsheets would run as a formula is quoted, amounts are not
+	b.Reset()
+	formula := []*db.Transaction{{ID: "t4", Amount: -1, Name: "=HYPERLINK(\"http://evil\")", MerchantName: "@SUM(A1)", Category: []string{"-1+1"}}}
+	if err := CSV(&b, formula, []string{"name", "merchant_name", "amount", "category"}); err != nil {
+		t.Fatalf("Error writing csv: %v", err)
+	}
+	expected = "name,merchant_name,amount,category\n" +
+		"\"'=HYPERLINK(\"\"http://evil\"\")\",'@SUM(A1),-1.00,'-1+1\n"
+	if b.String() != expected {
+		t.Errorf("Expected %v\tGot %v", expected, b.String())
+	}
+
+	if err := CSV(&b, transactions, []string{"date", "password"}); err == nil {
+		t.Errorf("Expected error for unknown column")
+	}
+}
@@ -0,0 +1,341 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+// Account is a Plaid account to book transactions against.
+type Account struct {
+	ID       string
+	Name     string
+	Type     string // depository, credit, loan, investment, ...
+	Subtype  string
+	Currency string
+	// Balance is the current balance used for balance assertions, if known.
+	Balance *float64
+}
+
+// openingBalances is the account balancing the opening balance of accounts
+// whose transactions do not add up to their known balance.
+const openingBalances = "Equity:Opening-Balances"
+
+// Mapping maps Plaid accounts and categories to plain-text accounting account
+// names. It is meant to be kept in a user-edited JSON file.
+type Mapping struct {
+	// Accounts maps a Plaid account_id to a ledger account such as
+	// "Assets:Bank:Checking".
+	Accounts map[string]string `json:"accounts"`
+	// Categories maps a Plaid category, either the top level such as
+	// "Travel" or a full path such as "Food and Drink:Coffee Shop", to a
+	// ledger account. The most specific match wins.
+	Categories map[string]string `json:"categories"`
+	// DefaultExpense and DefaultIncome are used for uncategorized
+	// transactions.
+	DefaultExpense string `json:"default_expense"`
+	DefaultIncome  string `json:"default_income"`
+}
+
+// LoadMapping reads a JSON mapping.
+func LoadMapping(r io.Reader) (*Mapping, error) {
+	m := &Mapping{}
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// account returns the ledger account of a Plaid account.
+func (m *Mapping) account(a Account) string {
+	if name, ok := m.Accounts[a.ID]; ok {
+		return name
+	}
+	root := "Assets"
+	switch a.Type {
+	case "credit", "loan":
+		root = "Liabilities"
+	}
+	name := a.Name
+	if name == "" {
+		name = a.ID
+	}
+	return root + ":" + component(name)
+}
+
+// counterAccount returns the account balancing a transaction, derived from
+// its category.
+func (m *Mapping) counterAccount(t *db.Transaction) string {
+	for i := len(t.Category); i > 0; i-- {
+		if name, ok := m.Categories[strings.Join(t.Category[:i], ":")]; ok {
+			return name
+		}
+	}
+	// positive amounts are money moving out of the account
+	root, fallback := "Expenses", m.DefaultExpense
+	if t.Amount < 0 {
+		root, fallback = "Income", m.DefaultIncome
+	}
+	if len(t.Category) == 0 {
+		if fallback != "" {
+			return fallback
+		}
+		return root + ":Uncategorized"
+	}
+	parts := []string{root}
+	for _, c := range t.Category {
+		parts = append(parts, component(c))
+	}
+	return strings.Join(parts, ":")
+}
+
+// component turns a name into a valid account name component: words are
+// capitalized and joined, dropping anything but letters and digits.
+func component(s string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		r := []rune(word)
+		b.WriteString(strings.ToUpper(string(r[0])) + string(r[1:]))
+	}
+	if b.Len() == 0 {
+		return "Unknown"
+	}
+	return b.String()
+}
+
+// Beancount writes transactions as a beancount journal: open directives for
+// every account used, a balanced entry per transaction and balance assertions
+// for accounts with a known balance as of asOf. Accounts whose transactions do
+// not add up to their balance are padded from Equity:Opening-Balances before
+// the first transaction.
+func Beancount(w io.Writer, accounts []Account, transactions []*db.Transaction, m *Mapping, asOf time.Time) error {
+	j, err := newJournal(accounts, transactions, m, asOf)
+	if err != nil {
+		return err
+	}
+	for _, name := range j.accountNames() {
+		if _, err := fmt.Fprintf(w, "%s open %s\n", j.opened[name], name); err != nil {
+			return err
+		}
+	}
+	for _, o := range j.openings {
+		if _, err := fmt.Fprintf(w, "\n%s pad %s %s\n", j.openedOn, o.account, openingBalances); err != nil {
+			return err
+		}
+	}
+	for _, e := range j.entries {
+		flag := "*"
+		if e.t.Pending {
+			flag = "!"
+		}
+		if _, err := fmt.Fprintf(w, "\n%s %s %s %s\n  %s  %s %s\n  %s  %s %s\n",
+			e.t.Date, flag, quote(e.t.MerchantName), quote(e.t.Name),
+			e.counter, amount(e.t.Amount), e.currency,
+			e.account, amount(-e.t.Amount), e.currency,
+		); err != nil {
+			return err
+		}
+	}
+	// beancount checks balances at the beginning of the day
+	date := asOf.AddDate(0, 0, 1).Format("2006-01-02")
+	for _, a := range j.assertions {
+		if _, err := fmt.Fprintf(w, "\n%s balance %s  %s %s\n", date, a.account, amount(a.balance), a.currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LedgerCLI writes transactions as a ledger-cli journal with a balanced entry
+// per transaction and balance assertions for accounts with a known balance as
+// of asOf. Accounts whose transactions do not add up to their balance get an
+// opening entry from Equity:Opening-Balances before the first transaction.
+func LedgerCLI(w io.Writer, accounts []Account, transactions []*db.Transaction, m *Mapping, asOf time.Time) error {
+	j, err := newJournal(accounts, transactions, m, asOf)
+	if err != nil {
+		return err
+	}
+	for _, o := range j.openings {
+		if _, err := fmt.Fprintf(w, "%s * Opening balance\n    %s  %s %s\n    %s  %s %s\n\n",
+			strings.ReplaceAll(j.openedOn, "-", "/"),
+			o.account, amount(o.balance), o.currency,
+			openingBalances, amount(-o.balance), o.currency,
+		); err != nil {
+			return err
+		}
+	}
+	for _, e := range j.entries {
+		flag := "*"
+		if e.t.Pending {
+			flag = "!"
+		}
+		payee := e.t.Name
+		if e.t.MerchantName != "" {
+			payee = e.t.MerchantName
+		}
+		if _, err := fmt.Fprintf(w, "%s %s %s  ; %s\n    %s  %s %s\n    %s  %s %s\n\n",
+			strings.ReplaceAll(e.t.Date, "-", "/"), flag, qifLine(payee), e.t.ID,
+			e.counter, amount(e.t.Amount), e.currency,
+			e.account, amount(-e.t.Amount), e.currency,
+		); err != nil {
+			return err
+		}
+	}
+	date := asOf.Format("2006/01/02")
+	for _, a := range j.assertions {
+		if _, err := fmt.Fprintf(w, "%s * Balance assertion\n    %s  0 %s = %s %s\n\n", date, a.account, a.currency, amount(a.balance), a.currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type entry struct {
+	t        *db.Transaction
+	account  string
+	counter  string
+	currency string
+}
+
+type assertion struct {
+	account  string
+	balance  float64
+	currency string
+}
+
+// journal holds transactions resolved to ledger accounts, oldest first.
+type journal struct {
+	entries    []entry
+	assertions []assertion
+	// openings hold the balance of asserted accounts before the first
+	// transaction, when it is not zero, booked on openedOn.
+	openings []assertion
+	openedOn string
+	// opened holds the first date each account is used on.
+	opened map[string]string
+}
+
+func newJournal(accounts []Account, transactions []*db.Transaction, m *Mapping, asOf time.Time) (*journal, error) {
+	if m == nil {
+		m = &Mapping{}
+	}
+	byID := map[string]Account{}
+	for _, a := range accounts {
+		byID[a.ID] = a
+	}
+	sorted := append([]*db.Transaction(nil), transactions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date < sorted[j].Date
+	})
+
+	// every posting, assertion and opening of an account is in one currency:
+	// the account's, else that of its first transaction with one, else USD
+	currencies := map[string]string{}
+	for _, a := range accounts {
+		currencies[a.ID] = a.Currency
+	}
+	for _, t := range sorted {
+		if currencies[t.AccountID] == "" {
+			currencies[t.AccountID] = t.IsoCurrencyCode
+		}
+	}
+	currency := func(accountID string) string {
+		if c := currencies[accountID]; c != "" {
+			return c
+		}
+		return "USD"
+	}
+
+	j := &journal{opened: map[string]string{}}
+	open := func(name, date string) {
+		if first, ok := j.opened[name]; !ok || date < first {
+			j.opened[name] = date
+		}
+	}
+	for _, t := range sorted {
+		a, ok := byID[t.AccountID]
+		if !ok {
+			return nil, fmt.Errorf("unknown account %s for transaction %s", t.AccountID, t.ID)
+		}
+		e := entry{t: t, account: m.account(a), counter: m.counterAccount(t), currency: currency(a.ID)}
+		open(e.account, t.Date)
+		open(e.counter, t.Date)
+		j.entries = append(j.entries, e)
+	}
+	for _, a := range accounts {
+		if a.Balance == nil {
+			continue
+		}
+		balance := *a.Balance
+		// Plaid reports what is owed on credit and loan accounts as a
+		// positive balance
+		if a.Type == "credit" || a.Type == "loan" {
+			balance = -balance
+		}
+		name := m.account(a)
+		if _, ok := j.opened[name]; !ok {
+			j.opened[name] = "1970-01-01"
+		}
+		j.assertions = append(j.assertions, assertion{account: name, balance: balance, currency: currency(a.ID)})
+	}
+	j.addOpenings(asOf)
+	return j, nil
+}
+
+// addOpenings books the difference between the balance of asserted accounts
+// and the sum of their postings as their opening balance, the day before the
+// first transaction or on asOf without transactions.
+func (j *journal) addOpenings(asOf time.Time) {
+	j.openedOn = asOf.Format("2006-01-02")
+	if len(j.entries) > 0 {
+		first, err := time.Parse("2006-01-02", j.entries[0].t.Date)
+		if err == nil {
+			j.openedOn = first.AddDate(0, 0, -1).Format("2006-01-02")
+		}
+	}
+	// sums of the postings by account and currency
+	posted := map[[2]string]float64{}
+	for _, e := range j.entries {
+		posted[[2]string{e.account, e.currency}] -= e.t.Amount
+		posted[[2]string{e.counter, e.currency}] += e.t.Amount
+	}
+	for _, a := range j.assertions {
+		opening := a.balance - posted[[2]string{a.account, a.currency}]
+		if math.Round(opening*100) == 0 {
+			continue
+		}
+		j.openings = append(j.openings, assertion{account: a.account, balance: opening, currency: a.currency})
+		for _, name := range []string{a.account, openingBalances} {
+			if first, ok := j.opened[name]; !ok || j.openedOn < first {
+				j.opened[name] = j.openedOn
+			}
+		}
+	}
+}
+
+func (j *journal) accountNames() []string {
+	var names []string
+	for name := range j.opened {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func amount(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+func quote(s string) string {
+	return strconv.Quote(qifLine(s))
+}
@@ -0,0 +1,141 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+var (
+	checkingBalance = 1420.0
+	creditBalance   = 4.5
+	accounts        = []Account{
+		{ID: "a1", Name: "Plaid Checking", Type: "depository", Subtype: "checking", Currency: "USD", Balance: &checkingBalance},
+		{ID: "a2", Name: "Plaid Credit Card", Type: "credit", Subtype: "credit card", Currency: "USD", Balance: &creditBalance},
+	}
+	asOf = time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)
+)
+
+func Test_Beancount(t *testing.T) {
+	m, err := LoadMapping(strings.NewReader(`{
+		"accounts": {"a1": "Assets:Bank:Checking"},
+		"categories": {"Food and Drink:Coffee Shop": "Expenses:Coffee", "Transfer": "Income:Salary"}
+	}`))
+	if err != nil {
+		t.Fatalf("Error loading mapping: %v", err)
+	}
+	var b bytes.Buffer
+	if err := Beancount(&b, accounts, transactions, m, asOf); err != nil {
+		t.Fatalf("Error writing beancount: %v", err)
+	}
+	// the credit card transactions add up to its balance, the checking
+	// account is padded with its opening balance
+	expected := `2021-12-31 open Assets:Bank:Checking
+2021-12-31 open Equity:Opening-Balances
+2022-01-05 open Expenses:Coffee
+2022-01-02 open Expenses:Shops:Supermarkets
+2022-01-01 open Income:Salary
+2022-01-05 open Liabilities:PlaidCreditCard
+
+2021-12-31 pad Assets:Bank:Checking Equity:Opening-Balances
+
+2022-01-01 * "" "Payroll, \"ACME\""
+  Income:Salary  -500.00 USD
+  Assets:Bank:Checking  500.00 USD
+
+2022-01-02 * "Whole Foods Market" "Whole Foods"
+  Expenses:Shops:Supermarkets  80.00 USD
+  Assets:Bank:Checking  -80.00 USD
+
+2022-01-05 * "" "Starbucks"
+  Expenses:Coffee  4.50 USD
+  Liabilities:PlaidCreditCard  -4.50 USD
+
+2022-02-01 balance Assets:Bank:Checking  1420.00 USD
+
+2022-02-01 balance Liabilities:PlaidCreditCard  -4.50 USD
+`
+	if b.String() != expected {
+		t.Errorf("Expected %v\tGot %v", expected, b.String())
+	}
+}
+
+func Test_LedgerCLI(t *testing.T) {
+	var b bytes.Buffer
+	if err := LedgerCLI(&b, accounts, transactions[:1], nil, asOf); err != nil {
+		t.Fatalf("Error writing ledger: %v", err)
+	}
+	// opening balances make the postings add up to the asserted balances:
+	// 1500 - 80 on checking
+	expected := `2022/01/01 * Opening balance
+    Assets:PlaidChecking  1500.00 USD
+    Equity:Opening-Balances  -1500.00 USD
+
+2022/01/01 * Opening balance
+    Liabilities:PlaidCreditCard  -4.50 USD
+    Equity:Opening-Balances  4.50 USD
+
+2022/01/02 * Whole Foods Market  ; t2
+    Expenses:Shops:Supermarkets  80.00 USD
+    Assets:PlaidChecking  -80.00 USD
+
+2022/01/31 * Balance assertion
+    Assets:PlaidChecking  0 USD = 1420.00 USD
+
+2022/01/31 * Balance assertion
+    Liabilities:PlaidCreditCard  0 USD = -4.50 USD
+
+`
+	if b.String() != expected {
+		t.Errorf("Expected %v\tGot %v", expected, b.String())
+	}
+
+	if err := LedgerCLI(&b, nil, transactions, nil, asOf); err == nil {
+		t.Errorf("Expected error for unknown account")
+	}
+}
+
+func Test_LedgerCurrencies(t *testing.T) {
+	balance := 100.0
+	accounts := []Account{
+		{ID: "eur", Name: "Euro Checking", Type: "depository", Balance: &balance},
+		{ID: "cad", Name: "Loonie Checking", Type: "depository", Currency: "CAD"},
+	}
+	transactions := []*db.Transaction{
+		{ID: "t1", AccountID: "eur", Amount: 10, IsoCurrencyCode: "EUR", Date: "2022-01-01", Name: "Bakery"},
+		{ID: "t2", AccountID: "eur", Amount: 20, Date: "2022-01-02", Name: "Market"},
+		{ID: "t3", AccountID: "cad", Amount: 5, IsoCurrencyCode: "USD", Date: "2022-01-03", Name: "Coffee"},
+	}
+	var b bytes.Buffer
+	if err := LedgerCLI(&b, accounts, transactions, nil, asOf); err != nil {
+		t.Fatalf("Error writing ledger: %v", err)
+	}
+	// the accounts keep one currency, so the opening balance of the euro
+	// account adds up with its postings: 100 + 10 + 20
+	expected := `2021/12/31 * Opening balance
+    Assets:EuroChecking  130.00 EUR
+    Equity:Opening-Balances  -130.00 EUR
+
+2022/01/01 * Bakery  ; t1
+    Expenses:Uncategorized  10.00 EUR
+    Assets:EuroChecking  -10.00 EUR
+
+2022/01/02 * Market  ; t2
+    Expenses:Uncategorized  20.00 EUR
+    Assets:EuroChecking  -20.00 EUR
+
+2022/01/03 * Coffee  ; t3
+    Expenses:Uncategorized  5.00 CAD
+    Assets:LoonieChecking  -5.00 CAD
+
+2022/01/31 * Balance assertion
+    Assets:EuroChecking  0 EUR = 100.00 EUR
+
+`
+	if b.String() != expected {
+		t.Errorf("Expected %v\tGot %v", expected, b.String())
+	}
+}
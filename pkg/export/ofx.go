@@ -0,0 +1,191 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+const ofxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="202" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`
+
+// OFX writes transactions as an OFX 2.x document with one statement per
+// account: a credit card statement for credit accounts and a bank statement
+// for the others, with the balance of the account as of asOf when it is
+// known. Amounts are signed from the account's point of view, so money moving
+// out of the account is negative.
+func OFX(w io.Writer, accounts []Account, transactions []*db.Transaction, asOf time.Time) error {
+	now := asOf.UTC().Format("20060102150405")
+	if _, err := io.WriteString(w, ofxHeader); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "<OFX>\n<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS><DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>\n", now); err != nil {
+		return err
+	}
+	byID := map[string]Account{}
+	for _, a := range accounts {
+		byID[a.ID] = a
+	}
+	var bank, credit []ofxStatement
+	for _, group := range byAccount(transactions) {
+		a, ok := byID[group.id]
+		if !ok {
+			a = Account{ID: group.id}
+		}
+		statement := ofxStatement{account: a, transactions: group.transactions}
+		if a.Type == "credit" {
+			credit = append(credit, statement)
+		} else {
+			bank = append(bank, statement)
+		}
+	}
+	uid := 0
+	for _, messages := range []struct {
+		set        string
+		statements []ofxStatement
+	}{
+		{"BANKMSGSRSV1", bank},
+		{"CREDITCARDMSGSRSV1", credit},
+	} {
+		if len(messages.statements) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "<%s>\n", messages.set); err != nil {
+			return err
+		}
+		for _, statement := range messages.statements {
+			uid++
+			if err := statement.write(w, uid, now); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "</%s>\n", messages.set); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</OFX>\n")
+	return err
+}
+
+// ofxAccountTypes maps Plaid account subtypes to OFX bank account types.
+// Other accounts are CHECKING, and loans CREDITLINE.
+var ofxAccountTypes = map[string]string{
+	"checking":       "CHECKING",
+	"savings":        "SAVINGS",
+	"money market":   "MONEYMRKT",
+	"cd":             "CD",
+	"line of credit": "CREDITLINE",
+}
+
+type ofxStatement struct {
+	account      Account
+	transactions []*db.Transaction
+}
+
+// write writes the statement in a STMTTRNRS, or a CCSTMTTRNRS for credit
+// accounts.
+func (s ofxStatement) write(w io.Writer, uid int, asOf string) error {
+	currency := "USD"
+	if s.account.Currency != "" {
+		currency = s.account.Currency
+	}
+	if s.transactions[0].IsoCurrencyCode != "" {
+		currency = s.transactions[0].IsoCurrencyCode
+	}
+	start, end := s.transactions[0].Date, s.transactions[len(s.transactions)-1].Date
+	prefix, from := "", ""
+	if s.account.Type == "credit" {
+		prefix = "CC"
+		from = fmt.Sprintf("<CCACCTFROM><ACCTID>%s</ACCTID></CCACCTFROM>", escape(s.account.ID))
+	} else {
+		accountType, ok := ofxAccountTypes[s.account.Subtype]
+		switch {
+		case s.account.Type == "loan":
+			accountType = "CREDITLINE"
+		case !ok:
+			accountType = "CHECKING"
+		}
+		from = fmt.Sprintf("<BANKACCTFROM><BANKID>PLAID</BANKID><ACCTID>%s</ACCTID><ACCTTYPE>%s</ACCTTYPE></BANKACCTFROM>", escape(s.account.ID), accountType)
+	}
+	if _, err := fmt.Fprintf(w, "<%sSTMTTRNRS><TRNUID>%d</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n<%sSTMTRS><CURDEF>%s</CURDEF>\n%s\n<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n",
+		prefix, uid, prefix, escape(currency), from, ofxDate(start), ofxDate(end)); err != nil {
+		return err
+	}
+	for _, t := range s.transactions {
+		trnType := "DEBIT"
+		if t.Amount < 0 {
+			trnType = "CREDIT"
+		}
+		if _, err := fmt.Fprintf(w, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%s</FITID><NAME>%s</NAME><MEMO>%s</MEMO></STMTTRN>\n",
+			trnType, ofxDate(t.Date), strconv.FormatFloat(-t.Amount, 'f', 2, 64), escape(t.ID), escape(truncate(t.Name, 32)), escape(strings.Join(t.Category, " > "))); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w, "</BANKTRANLIST>\n"); err != nil {
+		return err
+	}
+	if s.account.Balance != nil {
+		balance := *s.account.Balance
+		// Plaid reports what is owed on credit and loan accounts as a
+		// positive balance
+		if s.account.Type == "credit" || s.account.Type == "loan" {
+			balance = -balance
+		}
+		if _, err := fmt.Fprintf(w, "<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\n", strconv.FormatFloat(balance, 'f', 2, 64), asOf); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "</%sSTMTRS></%sSTMTTRNRS>\n", prefix, prefix)
+	return err
+}
+
+type accountTransactions struct {
+	id           string
+	transactions []*db.Transaction
+}
+
+// byAccount groups transactions per account, ordered by account id and
+// oldest transaction first.
+func byAccount(transactions []*db.Transaction) []accountTransactions {
+	grouped := map[string][]*db.Transaction{}
+	for _, t := range transactions {
+		grouped[t.AccountID] = append(grouped[t.AccountID], t)
+	}
+	res := []accountTransactions{}
+	for id, ts := range grouped {
+		sort.SliceStable(ts, func(i, j int) bool {
+			return ts[i].Date < ts[j].Date
+		})
+		res = append(res, accountTransactions{id: id, transactions: ts})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].id < res[j].id
+	})
+	return res
+}
+
+// ofxDate converts a YYYY-MM-DD date to the OFX date format.
+func ofxDate(date string) string {
+	return strings.ReplaceAll(date, "-", "")
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
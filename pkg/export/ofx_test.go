@@ -0,0 +1,48 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+func Test_OFX(t *testing.T) {
+	var b bytes.Buffer
+	savingsBalance := 250.0
+	accounts := append(accounts, Account{ID: "a3", Type: "depository", Subtype: "savings", Balance: &savingsBalance})
+	transactions := append(transactions, &db.Transaction{ID: "t4", AccountID: "a3", Amount: -250, Date: "2022-01-03", Name: "Transfer"})
+	if err := OFX(&b, accounts, transactions, asOf); err != nil {
+		t.Fatalf("Error writing ofx: %v", err)
+	}
+	out := b.String()
+	if !strings.HasPrefix(out, `<?xml version="1.0"`) || !strings.Contains(out, `VERSION="202"`) {
+		t.Errorf("Missing OFX 2.x header in %v", out)
+	}
+	if n := strings.Count(out, "<STMTRS>"); n != 2 {
+		t.Errorf("Expected 2 bank statements, got %d", n)
+	}
+	if n := strings.Count(out, "<CCSTMTRS>"); n != 1 {
+		t.Errorf("Expected 1 credit card statement, got %d", n)
+	}
+	for _, s := range []string{
+		"<BANKACCTFROM><BANKID>PLAID</BANKID><ACCTID>a1</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>",
+		"<ACCTID>a3</ACCTID><ACCTTYPE>SAVINGS</ACCTTYPE>",
+		"<LEDGERBAL><BALAMT>1420.00</BALAMT><DTASOF>20220131000000</DTASOF></LEDGERBAL>",
+		"</BANKMSGSRSV1>\n<CREDITCARDMSGSRSV1>\n<CCSTMTTRNRS><TRNUID>3</TRNUID>",
+		"<CCACCTFROM><ACCTID>a2</ACCTID></CCACCTFROM>",
+		"<LEDGERBAL><BALAMT>-4.50</BALAMT><DTASOF>20220131000000</DTASOF></LEDGERBAL>\n</CCSTMTRS></CCSTMTTRNRS>",
+		"<DTSTART>20220101</DTSTART><DTEND>20220102</DTEND>",
+		"<TRNTYPE>CREDIT</TRNTYPE><DTPOSTED>20220101</DTPOSTED><TRNAMT>500.00</TRNAMT><FITID>t1</FITID><NAME>Payroll, &#34;ACME&#34;</NAME>",
+		"<TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20220102</DTPOSTED><TRNAMT>-80.00</TRNAMT>",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %v in %v", s, out)
+		}
+	}
+	// statements list transactions oldest first
+	if strings.Index(out, "<FITID>t1</FITID>") > strings.Index(out, "<FITID>t2</FITID>") {
+		t.Errorf("Expected t1 before t2 in %v", out)
+	}
+}
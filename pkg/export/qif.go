@@ -0,0 +1,49 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+// QIF writes transactions in the Quicken Interchange Format, one bank account
+// block per account. Amounts are signed from the account's point of view, so
+// money moving out of the account is negative.
+func QIF(w io.Writer, transactions []*db.Transaction) error {
+	for _, account := range byAccount(transactions) {
+		if _, err := fmt.Fprintf(w, "!Account\nN%s\nTBank\n^\n!Type:Bank\n", qifLine(account.id)); err != nil {
+			return err
+		}
+		for _, t := range account.transactions {
+			if _, err := fmt.Fprintf(w, "D%s\nT%s\nP%s\n", qifDate(t.Date), strconv.FormatFloat(-t.Amount, 'f', 2, 64), qifLine(t.Name)); err != nil {
+				return err
+			}
+			if len(t.Category) > 0 {
+				if _, err := fmt.Fprintf(w, "L%s\n", qifLine(strings.Join(t.Category, ":"))); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "N%s\n^\n", qifLine(t.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// qifDate converts a YYYY-MM-DD date to the MM/DD/YYYY QIF date format.
+func qifDate(date string) string {
+	parts := strings.Split(date, "-")
+	if len(parts) != 3 {
+		return date
+	}
+	return parts[1] + "/" + parts[2] + "/" + parts[0]
+}
+
+// qifLine keeps a value on a single line, since QIF fields are line based.
+func qifLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,21 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_QIF(t *testing.T) {
+	var b bytes.Buffer
+	if err := QIF(&b, transactions); err != nil {
+		t.Fatalf("Error writing qif: %v", err)
+	}
+	expected := "!Account\nNa1\nTBank\n^\n!Type:Bank\n" +
+		"D01/01/2022\nT500.00\nPPayroll, \"ACME\"\nLTransfer:Payroll\nNt1\n^\n" +
+		"D01/02/2022\nT-80.00\nPWhole Foods\nLShops:Supermarkets\nNt2\n^\n" +
+		"!Account\nNa2\nTBank\n^\n!Type:Bank\n" +
+		"D01/05/2022\nT-4.50\nPStarbucks\nLFood and Drink:Coffee Shop\nNt3\n^\n"
+	if b.String() != expected {
+		t.Errorf("Expected %v\tGot %v", expected, b.String())
+	}
+}
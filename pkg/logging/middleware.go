@@ -0,0 +1,85 @@
+// Package logging provides HTTP access logging and keeps secrets out of the
+// logs of the app.
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the id of a request, set by the caller or
+// generated by AccessLog, and is echoed in the response.
+const RequestIDHeader = "X-Request-Id"
+
+// AccessLog logs the method, path, status, latency and request id of every
+// request served by next. Query strings are not logged as they may hold
+// tokens.
+func AccessLog(logger *zap.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		rec := NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		fields := []zap.Field{
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", rec.Status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("request_id", requestID),
+		}
+		if rec.Status >= http.StatusInternalServerError {
+			logger.Error("request", fields...)
+		} else {
+			logger.Info("request", fields...)
+		}
+	})
+}
+
+// StatusRecorder remembers the status code written to a response, for
+// middleware reporting on responses.
+type StatusRecorder struct {
+	http.ResponseWriter
+	// Status is the status code of the response, 200 until one is written.
+	Status      int
+	wroteHeader bool
+}
+
+// NewStatusRecorder returns a StatusRecorder writing to w.
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *StatusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.Status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *StatusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_AccessLog(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	handler := AccessLog(zap.New(core), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		io.WriteString(w, "OK")
+	}))
+
+	req := httptest.NewRequest("GET", "/api/accounts?access_token=access-sandbox-1", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if id := w.Header().Get(RequestIDHeader); id != "req-1" {
+		t.Errorf("Data mismatch, expected:  %v got: %v", "req-1", id)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/fail", nil))
+
+	entries := logs.AllUntimed()
+	if len(entries) != 2 {
+		t.Fatalf("Data mismatch, expected:  %v got: %v", 2, len(entries))
+	}
+	fields := entries[0].ContextMap()
+	for key, expected := range map[string]interface{}{
+		"method":     "GET",
+		"path":       "/api/accounts",
+		"status":     int64(http.StatusOK),
+		"request_id": "req-1",
+	} {
+		if fields[key] != expected {
+			t.Errorf("Data mismatch, expected:  %v got: %v", expected, fields[key])
+		}
+	}
+	if _, ok := fields["latency"]; !ok {
+		t.Errorf("Expected a latency")
+	}
+	fields = entries[1].ContextMap()
+	if entries[1].Level != zapcore.ErrorLevel || fields["status"] != int64(http.StatusBadGateway) {
+		t.Errorf("Unexpected entry %v %v", entries[1].Level, fields)
+	}
+	if id, _ := fields["request_id"].(string); len(id) != 16 {
+		t.Errorf("Expected a generated request id, got %q", id)
+	}
+}
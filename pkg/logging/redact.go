@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces the values scrubbed from logs.
+const Redacted = "[REDACTED]"
+
+var (
+	// tokens matches Plaid access, public, link, asset report and audit copy
+	// tokens, keeping their prefix so the kind of token still shows up.
+	tokens = regexp.MustCompile(`\b(access|public|link|assets|a)-(sandbox|development|production)-[A-Za-z0-9-]+`)
+	// jsonFields matches the JSON fields holding credentials or account
+	// numbers, e.g. in Plaid request and response bodies.
+	jsonFields = regexp.MustCompile(`("(?:secret|access_token|public_token|link_token|asset_report_token|audit_copy_token|account|routing|wire_routing|iban|bic|sort_code)"\s*:\s*)"[^"]*"`)
+	// headers matches the HTTP header lines holding credentials, e.g. in
+	// dumps of Plaid requests.
+	headers = regexp.MustCompile(`(?im)^((?:plaid-secret|authorization|cookie|set-cookie|x-api-key):)[^\r\n]*`)
+)
+
+// Redactor scrubs access tokens, public tokens, account numbers and secrets
+// from log lines.
+type Redactor struct {
+	secrets []string
+}
+
+// NewRedactor returns a redactor also scrubbing the given secrets, e.g. the
+// Plaid secret, wherever they appear. Empty secrets are ignored.
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{}
+	for _, s := range secrets {
+		if s != "" {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+	return r
+}
+
+// String returns s with everything sensitive replaced by Redacted.
+func (r *Redactor) String(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	s = tokens.ReplaceAllString(s, "$1-$2-"+Redacted)
+	s = jsonFields.ReplaceAllString(s, `$1"`+Redacted+`"`)
+	s = headers.ReplaceAllString(s, "$1 "+Redacted)
+	return s
+}
+
+// Core wraps core so the message and fields of every entry are redacted.
+// It is meant for zap.WrapCore.
+func (r *Redactor) Core(core zapcore.Core) zapcore.Core {
+	return &redactingCore{Core: core, redactor: r}
+}
+
+type redactingCore struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.fields(fields)), redactor: c.redactor}
+}
+
+func (c *redactingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.redactor.String(ent.Message)
+	return c.Core.Write(ent, c.fields(fields))
+}
+
+// fields returns a redacted copy of fields. Values other than strings are
+// redacted through their string or JSON representation.
+func (c *redactingCore) fields(fields []zapcore.Field) []zapcore.Field {
+	res := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = c.redactor.String(f.String)
+		case zapcore.ByteStringType:
+			f = zap.String(f.Key, c.redactor.String(string(f.Interface.([]byte))))
+		case zapcore.ErrorType:
+			f = zap.String(f.Key, c.redactor.String(f.Interface.(error).Error()))
+		case zapcore.StringerType:
+			f = zap.String(f.Key, c.redactor.String(f.Interface.(fmt.Stringer).String()))
+		case zapcore.ReflectType:
+			if b, err := json.Marshal(f.Interface); err == nil {
+				f = zap.Reflect(f.Key, json.RawMessage(c.redactor.String(string(b))))
+			}
+		}
+		res[i] = f
+	}
+	return res
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_Redact(t *testing.T) {
+	r := NewRedactor("s3cr3t", "")
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"access token: access-sandbox-de3ce8ef-33f8-452c-a685-8671031fc0f6", "access token: access-sandbox-[REDACTED]"},
+		{"public-production-1 and link-development-2a", "public-production-[REDACTED] and link-development-[REDACTED]"},
+		{`{"account": "1111222233330000", "account_id": "acc-1", "routing":"011401533"}`, `{"account": "[REDACTED]", "account_id": "acc-1", "routing":"[REDACTED]"}`},
+		{`{"client_id":"client","secret":"anything"}`, `{"client_id":"client","secret":"[REDACTED]"}`},
+		{"POST /accounts/get HTTP/1.1\r\nPlaid-Client-Id: client\r\nPlaid-Secret: anything\r\n", "POST /accounts/get HTTP/1.1\r\nPlaid-Client-Id: client\r\nPlaid-Secret: [REDACTED]\r\n"},
+		{"the secret is s3cr3t", "the secret is [REDACTED]"},
+		{"assets-sandbox-6 a-sandbox-7", "assets-sandbox-[REDACTED] a-sandbox-[REDACTED]"},
+		{"item-sandbox-1", "item-sandbox-1"},
+	}
+	for _, test := range tests {
+		if got := r.String(test.in); got != test.expected {
+			t.Errorf("Data mismatch, expected:  %q got: %q", test.expected, got)
+		}
+	}
+}
+
+func Test_RedactCore(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zap.New(core, zap.WrapCore(NewRedactor("s3cr3t").Core))
+
+	logger.With(zap.String("token", "access-sandbox-1")).Info("exchanged public-sandbox-2",
+		zap.Error(errors.New("bad secret s3cr3t")),
+		zap.ByteString("dump", []byte(`{"access_token":"whatever"}`)),
+		zap.Any("body", map[string]string{"iban": "GB33BUKB20201555555555"}),
+		zap.Int("count", 1),
+	)
+	entries := logs.AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("Data mismatch, expected:  %v got: %v", 1, len(entries))
+	}
+	if entries[0].Message != "exchanged public-sandbox-[REDACTED]" {
+		t.Errorf("Unexpected message %q", entries[0].Message)
+	}
+	for key, value := range entries[0].ContextMap() {
+		if s, ok := value.(string); ok && !strings.Contains(s, Redacted) {
+			t.Errorf("Expected %v to be redacted, got %q", key, s)
+		}
+	}
+	if body := entries[0].ContextMap()["body"]; !strings.Contains(fmt.Sprint(body), Redacted) {
+		t.Errorf("Expected body to be redacted, got %s", body)
+	}
+}
@@ -0,0 +1,32 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httputil"
+
+	"go.uber.org/zap"
+)
+
+// Transport logs dumps of the requests sent through next and of their
+// responses at debug level. Use it with a redacting logger.
+func Transport(logger *zap.Logger, next http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+			logger.Debug("http request", zap.ByteString("dump", dump))
+		}
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if dump, err := httputil.DumpResponse(resp, true); err == nil {
+			logger.Debug("http response", zap.ByteString("dump", dump))
+		}
+		return resp, nil
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_Transport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"access_token":"access-sandbox-1","item_id":"item-1"}`)
+	}))
+	defer server.Close()
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zap.New(core, zap.WrapCore(NewRedactor().Core))
+	client := &http.Client{Transport: Transport(logger, http.DefaultTransport)}
+
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader(`{"secret":"s"}`))
+	req.Header.Set("Plaid-Secret", "s")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("error sending request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "access-sandbox-1") {
+		t.Errorf("Expected the response body to be left untouched, got %s", body)
+	}
+
+	entries := logs.AllUntimed()
+	if len(entries) != 2 {
+		t.Fatalf("Data mismatch, expected:  %v got: %v", 2, len(entries))
+	}
+	for _, e := range entries {
+		dump := e.ContextMap()["dump"].(string)
+		if strings.Contains(dump, `"s"`) || strings.Contains(dump, "Secret: s") || strings.Contains(dump, "access-sandbox-1") {
+			t.Errorf("Expected the dump to be redacted, got %s", dump)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Package metrics exposes Prometheus metrics of the HTTP endpoints of the app
+// and of its Plaid API calls.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds the collectors of the app. A Metrics registers its
+// collectors in its own registerer, so servers with separate registries can
+// run in one process.
+type Metrics struct {
+	httpRequests     *prometheus.CounterVec
+	httpDuration     *prometheus.HistogramVec
+	plaidRequests    *prometheus.CounterVec
+	plaidDuration    *prometheus.HistogramVec
+	syncPages        prometheus.Counter
+	assetReportPolls *prometheus.CounterVec
+}
+
+// New creates the collectors and registers them in reg.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests served, by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of the HTTP requests served, by route and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		plaidRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "plaid_api_requests_total",
+			Help: "Plaid API calls, by endpoint and Plaid error code, empty on success.",
+		}, []string{"endpoint", "error_code"}),
+		plaidDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "plaid_api_request_duration_seconds",
+			Help:    "Latency of the Plaid API calls, by endpoint.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		syncPages: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "plaid_transactions_sync_pages_total",
+			Help: "Pages of transaction updates applied by transaction syncs.",
+		}),
+		assetReportPolls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "plaid_asset_report_poll_attempts_total",
+			Help: "Asset report polls, by result: ready, not_ready or error.",
+		}, []string{"result"}),
+	}
+	reg.MustRegister(
+		m.httpRequests,
+		m.httpDuration,
+		m.plaidRequests,
+		m.plaidDuration,
+		m.syncPages,
+		m.assetReportPolls,
+	)
+	return m
+}
+
+// SyncPage counts a page of transaction updates applied by a sync.
+func (m *Metrics) SyncPage() {
+	m.syncPages.Inc()
+}
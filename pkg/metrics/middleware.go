@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/uitachi123/go-plaid/pkg/logging"
+)
+
+// Middleware counts and times the requests served by mux, labelled by the
+// pattern of the route matching them so paths with ids do not create new
+// series. Routes of a nested *http.ServeMux are resolved too. Methods
+// outside of the standard ones are labelled "other" for the same reason.
+func (m *Metrics) Middleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := logging.NewStatusRecorder(w)
+		mux.ServeHTTP(rec, r)
+
+		route, method := route(mux, r), method(r)
+		m.httpRequests.WithLabelValues(route, method, strconv.Itoa(rec.Status)).Inc()
+		m.httpDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// standardMethods are the HTTP methods used as labels as is.
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// method returns the method label of r.
+func method(r *http.Request) string {
+	if standardMethods[r.Method] {
+		return r.Method
+	}
+	return "other"
+}
+
+// route returns the pattern of the route of mux serving r.
+func route(mux *http.ServeMux, r *http.Request) string {
+	h, pattern := mux.Handler(r)
+	if nested, ok := h.(*http.ServeMux); ok {
+		if _, p := nested.Handler(r); p != "" {
+			return p
+		}
+	}
+	if pattern == "" {
+		return "unmatched"
+	}
+	return pattern
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_Middleware(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+	nested := http.NewServeMux()
+	nested.HandleFunc("/api/accounts", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "OK")
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/api/", nested)
+	mux.HandleFunc("/echo/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := m.Middleware(mux)
+
+	for _, path := range []string{"/api/accounts", "/api/accounts", "/echo/1", "/echo/2", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	tests := []struct {
+		route    string
+		code     string
+		expected float64
+	}{
+		{"/api/accounts", "200", 2},
+		{"/echo/", "418", 2},
+		{"unmatched", "404", 1},
+	}
+	for _, test := range tests {
+		if got := testutil.ToFloat64(m.httpRequests.WithLabelValues(test.route, "GET", test.code)); got != test.expected {
+			t.Errorf("Data mismatch for %v, expected:  %v got: %v", test.route, test.expected, got)
+		}
+	}
+	if count := testutil.CollectAndCount(m.httpDuration); count != 3 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 3, count)
+	}
+
+	// any method is accepted, so others share one label
+	for _, method := range []string{"FOO", "BAR", "get"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/echo/1", nil))
+	}
+	if got := testutil.ToFloat64(m.httpRequests.WithLabelValues("/echo/", "other", "418")); got != 3 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 3, got)
+	}
+	if count := testutil.CollectAndCount(m.httpDuration); count != 4 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 4, count)
+	}
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Transport counts and times the Plaid API calls sent through next, by
+// endpoint and error code, and counts /asset_report/get calls as asset report
+// polls. The error code is read from the body of error responses, which is
+// left for the caller to read again.
+func (m *Metrics) Transport(next http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		endpoint := req.URL.Path
+		m.plaidDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+		if err != nil {
+			m.plaidRequests.WithLabelValues(endpoint, "TRANSPORT_ERROR").Inc()
+			return nil, err
+		}
+		errorCode := ""
+		if resp.StatusCode >= http.StatusBadRequest {
+			errorCode = "UNKNOWN"
+			body, readErr := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			var plaidErr struct {
+				ErrorCode string `json:"error_code"`
+			}
+			if readErr == nil && json.Unmarshal(body, &plaidErr) == nil && plaidErr.ErrorCode != "" {
+				errorCode = plaidErr.ErrorCode
+			}
+		}
+		m.plaidRequests.WithLabelValues(endpoint, errorCode).Inc()
+		if endpoint == "/asset_report/get" {
+			switch errorCode {
+			case "":
+				m.assetReportPolls.WithLabelValues("ready").Inc()
+			case "PRODUCT_NOT_READY":
+				m.assetReportPolls.WithLabelValues("not_ready").Inc()
+			default:
+				m.assetReportPolls.WithLabelValues("error").Inc()
+			}
+		}
+		return resp, nil
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
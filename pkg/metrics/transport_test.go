@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_Transport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/accounts/get" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error_type":"ITEM_ERROR","error_code":"ITEM_LOGIN_REQUIRED"}`)
+			return
+		}
+		io.WriteString(w, `{}`)
+	}))
+	defer server.Close()
+	m := New(prometheus.NewRegistry())
+	client := &http.Client{Transport: m.Transport(http.DefaultTransport)}
+
+	for _, path := range []string{"/item/get", "/accounts/get"} {
+		resp, err := client.Post(server.URL+path, "application/json", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("error sending request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if path == "/accounts/get" && !strings.Contains(string(body), "ITEM_LOGIN_REQUIRED") {
+			t.Errorf("Expected the error body to be readable, got %s", body)
+		}
+	}
+	if got := testutil.ToFloat64(m.plaidRequests.WithLabelValues("/item/get", "")); got != 1 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 1, got)
+	}
+	if got := testutil.ToFloat64(m.plaidRequests.WithLabelValues("/accounts/get", "ITEM_LOGIN_REQUIRED")); got != 1 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 1, got)
+	}
+
+	client.Post("http://127.0.0.1:1/item/get", "application/json", strings.NewReader("{}"))
+	if got := testutil.ToFloat64(m.plaidRequests.WithLabelValues("/item/get", "TRANSPORT_ERROR")); got != 1 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 1, got)
+	}
+}
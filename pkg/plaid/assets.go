@@ -0,0 +1,773 @@
+package plaid
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"github.com/uitachi123/go-plaid/pkg/api"
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDaysRequested = 10
+	maxDaysRequested     = 731
+	// assetReportTimeout is how long a job polls Plaid before giving up on
+	// its report.
+	assetReportTimeout = 10 * time.Minute
+	// defaultAssetReportFallback is how often jobs are polled when Plaid
+	// sends a webhook once their report is ready.
+	defaultAssetReportFallback = time.Minute
+)
+
+var errAssetReportNotFound = api.NotFound("ASSET_REPORT_NOT_FOUND", "asset report job not found")
+
+// Assets starts an asset report job on POST and returns the status of a
+// job, or of every job of the user or of one of its items, on GET. The
+// report is fetched once Plaid sends the ASSETS PRODUCT_READY webhook when a
+// webhook URL is configured, by polling in the background otherwise. Jobs
+// waiting for a webhook are still polled every minute in case it is lost.
+//
+// POST takes the items to report on as "item_id" parameters, defaulting to
+// the user's only item, and the days_requested, client_report_id,
+// include_fast_report, client_user_id, first_name, middle_name, last_name,
+// phone_number and email options of /asset_report/create.
+func (s *Server) Assets(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		s.assetReportStatus(w, r)
+	case "POST":
+		s.createAssetReport(w, r)
+	default:
+		api.WriteError(w, api.MethodNotAllowed)
+	}
+}
+
+func (s *Server) createAssetReport(w http.ResponseWriter, r *http.Request) {
+	user, err := s.requestUser(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		api.WriteError(w, api.BadRequest("INVALID_BODY", "Failed to parse POST form"))
+		return
+	}
+	var items []*linkedItem
+	if ids := r.Form["item_id"]; len(ids) > 0 {
+		for _, id := range ids {
+			item, err := s.items.get(user, id)
+			if err != nil {
+				api.WriteError(w, err)
+				return
+			}
+			items = append(items, item)
+		}
+	} else {
+		item, err := s.items.get(user, "")
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		items = append(items, item)
+	}
+	request, err := s.assetReportCreateRequest(r, items)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	resp, _, err := s.client.PlaidApi.AssetReportCreate(ctx).AssetReportCreateRequest(*request).Execute()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	job := &db.AssetReport{
+		User:          user,
+		AssetReportID: resp.GetAssetReportId(),
+		DaysRequested: int(request.DaysRequested),
+	}
+	for _, item := range items {
+		job.ItemIDs = append(job.ItemIDs, item.ID)
+	}
+	if request.Options != nil {
+		job.ClientReportID = request.Options.GetClientReportId()
+	}
+	if err := s.startAssetReport(job, resp.GetAssetReportToken(), s.config.WebhookURL != ""); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusAccepted, assetReportStatus(job))
+}
+
+// startAssetReport saves job as pending with the asset report token of the
+// report Plaid is generating for it, and polls the report in the background,
+// slowly if Plaid delivers it by webhook.
+func (s *Server) startAssetReport(job *db.AssetReport, token string, byWebhook bool) error {
+	id, err := db.NewAssetReportID()
+	if err != nil {
+		return err
+	}
+	sealed, err := s.store.SealToken(token)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	job.ID = id
+	job.AssetReportToken = sealed
+	job.Status = db.AssetReportStatusPending
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if err := s.store.SaveAssetReport(job); err != nil {
+		return err
+	}
+	go s.pollAssetReport(job.ID, byWebhook)
+	return nil
+}
+
+// updateAssetReport applies update to the stored job with the given id and
+// saves it. A job deleted in the meantime stays deleted and db.ErrNotFound
+// is returned.
+func (s *Server) updateAssetReport(id string, update func(job *db.AssetReport)) (*db.AssetReport, error) {
+	s.assetReports.Lock()
+	defer s.assetReports.Unlock()
+	job, err := s.store.GetAssetReport(id)
+	if err != nil {
+		return nil, err
+	}
+	// rows are immutable once inserted, so update a copy
+	updated := *job
+	update(&updated)
+	updated.UpdatedAt = time.Now()
+	return &updated, s.store.SaveAssetReport(&updated)
+}
+
+// assetReportCreateRequest builds the /asset_report/create request of the
+// items from the options of r.
+func (s *Server) assetReportCreateRequest(r *http.Request, items []*linkedItem) (*plaid.AssetReportCreateRequest, error) {
+	days, err := requestDaysRequested(r, defaultDaysRequested)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []string
+	for _, item := range items {
+		tokens = append(tokens, item.token)
+	}
+	request := plaid.NewAssetReportCreateRequest(tokens, int32(days))
+
+	options := plaid.NewAssetReportCreateRequestOptions()
+	hasOptions := false
+	if v := r.FormValue("client_report_id"); v != "" {
+		options.SetClientReportId(v)
+		hasOptions = true
+	}
+	if v := r.FormValue("include_fast_report"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, api.BadRequest("INVALID_FIELD", "include_fast_report must be a boolean")
+		}
+		options.SetIncludeFastReport(include)
+		hasOptions = true
+	}
+	if s.config.WebhookURL != "" {
+		options.SetWebhook(s.config.WebhookURL)
+		hasOptions = true
+	}
+	reportUser := plaid.NewAssetReportUser()
+	hasUser := false
+	for name, set := range map[string]func(string){
+		"client_user_id": reportUser.SetClientUserId,
+		"first_name":     reportUser.SetFirstName,
+		"middle_name":    reportUser.SetMiddleName,
+		"last_name":      reportUser.SetLastName,
+		"phone_number":   reportUser.SetPhoneNumber,
+		"email":          reportUser.SetEmail,
+	} {
+		if v := r.FormValue(name); v != "" {
+			set(v)
+			hasUser = true
+		}
+	}
+	if hasUser {
+		options.SetUser(*reportUser)
+		hasOptions = true
+	}
+	if hasOptions {
+		request.SetOptions(*options)
+	}
+	return request, nil
+}
+
+// requestDaysRequested returns the "days_requested" parameter of the request,
+// or def if it is not set.
+func requestDaysRequested(r *http.Request, def int) (int, error) {
+	v := r.FormValue("days_requested")
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > maxDaysRequested {
+		return 0, api.BadRequest("INVALID_FIELD", "days_requested must be between 0 and 731")
+	}
+	return n, nil
+}
+
+// assetReportStatus returns what is shown of a job, without its report.
+func assetReportStatus(job *db.AssetReport) map[string]interface{} {
+	status := map[string]interface{}{
+		"job_id":          job.ID,
+		"status":          job.Status,
+		"item_ids":        job.ItemIDs,
+		"asset_report_id": job.AssetReportID,
+		"days_requested":  job.DaysRequested,
+		"created_at":      job.CreatedAt,
+		"updated_at":      job.UpdatedAt,
+	}
+	if job.ClientReportID != "" {
+		status["client_report_id"] = job.ClientReportID
+	}
+	if job.ErrorCode != "" {
+		status["error_code"] = job.ErrorCode
+	}
+	if job.ParentID != "" {
+		status["parent_job_id"] = job.ParentID
+	}
+	if len(job.AuditCopies) > 0 {
+		copies := []map[string]interface{}{}
+		for _, c := range job.AuditCopies {
+			copies = append(copies, map[string]interface{}{
+				"auditor_id": c.AuditorID,
+				"created_at": c.CreatedAt,
+			})
+		}
+		status["audit_copies"] = copies
+	}
+	return status
+}
+
+func (s *Server) assetReportStatus(w http.ResponseWriter, r *http.Request) {
+	var res interface{}
+	if r.FormValue("job_id") != "" {
+		job, err := s.requestAssetReport(r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		res = assetReportStatus(job)
+	} else {
+		user, err := s.requestUser(r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		jobs, err := s.userAssetReports(user, r.FormValue("item_id"))
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		statuses := []map[string]interface{}{}
+		for _, job := range jobs {
+			statuses = append(statuses, assetReportStatus(job))
+		}
+		res = map[string]interface{}{"jobs": statuses}
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	io.WriteString(w, string(b))
+}
+
+// userAssetReports returns the jobs of a user, only those covering the item
+// with the given item_id if it is set.
+func (s *Server) userAssetReports(user, itemID string) ([]*db.AssetReport, error) {
+	if itemID == "" {
+		return s.store.ListAssetReports(user)
+	}
+	if _, err := s.items.get(user, itemID); err != nil {
+		return nil, err
+	}
+	jobs, err := s.store.ListItemAssetReports(itemID)
+	if err != nil {
+		return nil, err
+	}
+	res := []*db.AssetReport{}
+	for _, job := range jobs {
+		if job.User == user {
+			res = append(res, job)
+		}
+	}
+	return res, nil
+}
+
+// AssetReportJSON returns the JSON asset report of a ready job.
+func (s *Server) AssetReportJSON(w http.ResponseWriter, r *http.Request) {
+	job, err := s.readyAssetReport(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(job.Report)
+}
+
+// AssetReportPDF returns the PDF asset report of a ready job.
+func (s *Server) AssetReportPDF(w http.ResponseWriter, r *http.Request) {
+	job, err := s.readyAssetReport(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="asset-report-`+job.ID+`.pdf"`)
+	w.Write(job.PDF)
+}
+
+// RefreshAssetReport starts a job for a new asset report with up to date
+// data of the items of the job selected by "job_id", over the same number of
+// days unless days_requested is given.
+func (s *Server) RefreshAssetReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	parent, err := s.requestAssetReport(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	days, err := requestDaysRequested(r, parent.DaysRequested)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	token, err := s.store.AssetReportToken(parent)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	request := plaid.NewAssetReportRefreshRequest(token)
+	request.SetDaysRequested(int32(days))
+	if s.config.WebhookURL != "" {
+		options := plaid.NewAssetReportRefreshRequestOptions()
+		options.SetWebhook(s.config.WebhookURL)
+		request.SetOptions(*options)
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	resp, _, err := s.client.PlaidApi.AssetReportRefresh(ctx).AssetReportRefreshRequest(*request).Execute()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	job := &db.AssetReport{
+		User:           parent.User,
+		ItemIDs:        parent.ItemIDs,
+		ParentID:       parent.ID,
+		AssetReportID:  resp.GetAssetReportId(),
+		DaysRequested:  days,
+		ClientReportID: parent.ClientReportID,
+	}
+	if err := s.startAssetReport(job, resp.GetAssetReportToken(), s.config.WebhookURL != ""); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusAccepted, assetReportStatus(job))
+}
+
+// FilterAssetReport starts a job for a copy of the ready job selected by
+// "job_id" without the accounts given as "account_id" parameters. Plaid
+// sends no webhook for filtered reports, so they are always polled.
+func (s *Server) FilterAssetReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	parent, err := s.readyAssetReport(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	exclude := requestAccountIDs(r)
+	if len(exclude) == 0 {
+		api.WriteError(w, api.BadRequest("MISSING_FIELDS", "account_id is required"))
+		return
+	}
+	token, err := s.store.AssetReportToken(parent)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	resp, _, err := s.client.PlaidApi.AssetReportFilter(ctx).AssetReportFilterRequest(
+		*plaid.NewAssetReportFilterRequest(token, exclude),
+	).Execute()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	job := &db.AssetReport{
+		User:           parent.User,
+		ItemIDs:        parent.ItemIDs,
+		ParentID:       parent.ID,
+		AssetReportID:  resp.GetAssetReportId(),
+		DaysRequested:  parent.DaysRequested,
+		ClientReportID: parent.ClientReportID,
+	}
+	if err := s.startAssetReport(job, resp.GetAssetReportToken(), false); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusAccepted, assetReportStatus(job))
+}
+
+// CreateAuditCopy shares the ready job selected by "job_id" with the third
+// party auditor given as "auditor_id" and returns the audit copy token to
+// hand over to the auditor. A job has at most one audit copy per auditor.
+func (s *Server) CreateAuditCopy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	job, err := s.readyAssetReport(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	auditor := r.FormValue("auditor_id")
+	if auditor == "" {
+		api.WriteError(w, api.BadRequest("MISSING_FIELDS", "auditor_id is required"))
+		return
+	}
+	if findAuditCopy(job, auditor) != nil {
+		api.WriteError(w, api.NewError(http.StatusConflict, "ASSET_REPORT_ERROR", "AUDIT_COPY_EXISTS", "the asset report is already shared with "+auditor))
+		return
+	}
+	token, err := s.store.AssetReportToken(job)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	resp, _, err := s.client.PlaidApi.AssetReportAuditCopyCreate(ctx).AssetReportAuditCopyCreateRequest(
+		*plaid.NewAssetReportAuditCopyCreateRequest(token, auditor),
+	).Execute()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	sealed, err := s.store.SealToken(resp.GetAuditCopyToken())
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	auditCopy := &db.AuditCopy{AuditorID: auditor, Token: sealed, CreatedAt: time.Now()}
+	_, err = s.updateAssetReport(job.ID, func(job *db.AssetReport) {
+		job.AuditCopies = append(append([]*db.AuditCopy{}, job.AuditCopies...), auditCopy)
+	})
+	if err == db.ErrNotFound {
+		err = errAssetReportNotFound
+	}
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"job_id":           job.ID,
+		"auditor_id":       auditor,
+		"audit_copy_token": resp.GetAuditCopyToken(),
+	})
+}
+
+// RemoveAuditCopy revokes the audit copy of the job selected by "job_id"
+// shared with the auditor given as "auditor_id".
+func (s *Server) RemoveAuditCopy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	job, err := s.requestAssetReport(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	auditor := r.FormValue("auditor_id")
+	if auditor == "" {
+		api.WriteError(w, api.BadRequest("MISSING_FIELDS", "auditor_id is required"))
+		return
+	}
+	auditCopy := findAuditCopy(job, auditor)
+	if auditCopy == nil {
+		api.WriteError(w, api.NotFound("AUDIT_COPY_NOT_FOUND", "the asset report is not shared with "+auditor))
+		return
+	}
+	token, err := s.store.AuditCopyToken(auditCopy)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	_, _, err = s.client.PlaidApi.AssetReportAuditCopyRemove(ctx).AssetReportAuditCopyRemoveRequest(
+		*plaid.NewAssetReportAuditCopyRemoveRequest(token),
+	).Execute()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	updated, err := s.updateAssetReport(job.ID, func(job *db.AssetReport) {
+		var kept []*db.AuditCopy
+		for _, c := range job.AuditCopies {
+			if c.AuditorID != auditor {
+				kept = append(kept, c)
+			}
+		}
+		job.AuditCopies = kept
+	})
+	if err == db.ErrNotFound {
+		err = errAssetReportNotFound
+	}
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, assetReportStatus(updated))
+}
+
+func findAuditCopy(job *db.AssetReport, auditor string) *db.AuditCopy {
+	for _, c := range job.AuditCopies {
+		if c.AuditorID == auditor {
+			return c
+		}
+	}
+	return nil
+}
+
+// RemoveAssetReports removes the job selected by "job_id", or every job of
+// the user covering the item selected by "item_id", at Plaid and from the
+// store. Removing a report at Plaid also invalidates its audit copies.
+func (s *Server) RemoveAssetReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	var jobs []*db.AssetReport
+	switch {
+	case r.FormValue("job_id") != "":
+		job, err := s.requestAssetReport(r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		jobs = append(jobs, job)
+	case r.FormValue("item_id") != "":
+		user, err := s.requestUser(r)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		if jobs, err = s.userAssetReports(user, r.FormValue("item_id")); err != nil {
+			api.WriteError(w, err)
+			return
+		}
+	default:
+		api.WriteError(w, api.BadRequest("MISSING_FIELDS", "job_id or item_id is required"))
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	removed := []string{}
+	for _, job := range jobs {
+		if err := s.removeAssetReport(ctx, job); err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		removed = append(removed, job.ID)
+	}
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{"removed": removed})
+}
+
+// removeAssetReport removes the report of a job at Plaid, then deletes the
+// job. A report Plaid no longer knows is only deleted from the store.
+func (s *Server) removeAssetReport(ctx context.Context, job *db.AssetReport) error {
+	token, err := s.store.AssetReportToken(job)
+	if err != nil {
+		return err
+	}
+	_, _, err = s.client.PlaidApi.AssetReportRemove(ctx).AssetReportRemoveRequest(
+		*plaid.NewAssetReportRemoveRequest(token),
+	).Execute()
+	if err != nil {
+		if plaidErr, perr := plaid.ToPlaidError(err); perr != nil || plaidErr.ErrorCode != "INVALID_ASSET_REPORT_TOKEN" {
+			return err
+		}
+	}
+	s.assetReports.Lock()
+	defer s.assetReports.Unlock()
+	if err := s.store.DeleteAssetReport(job.ID); err != nil && err != db.ErrNotFound {
+		return err
+	}
+	s.logger.Info("removed asset report", zap.String("job_id", job.ID), zap.String("asset_report_id", job.AssetReportID))
+	return nil
+}
+
+// requestAssetReport returns the job selected by the "job_id" parameter of
+// the request, which must belong to the calling user.
+func (s *Server) requestAssetReport(r *http.Request) (*db.AssetReport, error) {
+	user, err := s.requestUser(r)
+	if err != nil {
+		return nil, err
+	}
+	id := r.FormValue("job_id")
+	if id == "" {
+		return nil, api.BadRequest("MISSING_FIELDS", "job_id is required")
+	}
+	job, err := s.store.GetAssetReport(id)
+	if err == db.ErrNotFound || (err == nil && job.User != user) {
+		return nil, errAssetReportNotFound
+	}
+	return job, err
+}
+
+func (s *Server) readyAssetReport(r *http.Request) (*db.AssetReport, error) {
+	job, err := s.requestAssetReport(r)
+	if err != nil {
+		return nil, err
+	}
+	switch job.Status {
+	case db.AssetReportStatusReady:
+		return job, nil
+	case db.AssetReportStatusError:
+		return nil, api.NewError(http.StatusConflict, "ASSET_REPORT_ERROR", job.ErrorCode, "the asset report failed")
+	default:
+		return nil, api.NewError(http.StatusConflict, "ASSET_REPORT_ERROR", "PRODUCT_NOT_READY", "the asset report is not ready yet")
+	}
+}
+
+// pollAssetReport fetches the report of a pending job until it is ready, it
+// fails, the job times out or the server is closed. Each poll is retried
+// following the retry policy of /asset_report/get, or every
+// assetReportFallback for jobs whose report is delivered by webhook, so a
+// lost webhook does not leave them pending.
+func (s *Server) pollAssetReport(id string, byWebhook bool) {
+	policy := s.config.retryPolicy("/asset_report/get")
+	var wait time.Duration
+	if byWebhook {
+		wait = s.assetReportFallback
+	}
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(wait):
+		case <-s.ctx.Done():
+			return
+		}
+		job, err := s.store.GetAssetReport(id)
+		if err != nil || job.Status != db.AssetReportStatusPending {
+			return
+		}
+		err = s.fetchAssetReport(s.ctx, job)
+		if err == nil || s.ctx.Err() != nil {
+			return
+		}
+		if plaidErr, perr := plaid.ToPlaidError(err); perr == nil && plaidErr.ErrorCode == "PRODUCT_NOT_READY" &&
+			time.Since(job.CreatedAt) < assetReportTimeout {
+			if !byWebhook {
+				wait = policy.delay(attempt)
+			}
+			continue
+		}
+		s.failAssetReport(job, err)
+		return
+	}
+}
+
+// resumeAssetReports polls the jobs left pending by a previous run.
+func (s *Server) resumeAssetReports() error {
+	jobs, err := s.store.ListAssetReports("")
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.Status == db.AssetReportStatusPending {
+			go s.pollAssetReport(job.ID, s.config.WebhookURL != "")
+		}
+	}
+	return nil
+}
+
+// fetchAssetReport gets the JSON and PDF report of a job from Plaid and
+// stores them, marking the job ready.
+func (s *Server) fetchAssetReport(ctx context.Context, job *db.AssetReport) error {
+	token, err := s.store.AssetReportToken(job)
+	if err != nil {
+		return err
+	}
+	reportResp, _, err := s.client.PlaidApi.AssetReportGet(ctx).AssetReportGetRequest(
+		*plaid.NewAssetReportGetRequest(token),
+	).Execute()
+	if err != nil {
+		return err
+	}
+	report, err := json.Marshal(reportResp.GetReport())
+	if err != nil {
+		return err
+	}
+	pdfFile, _, err := s.client.PlaidApi.AssetReportPdfGet(ctx).AssetReportPDFGetRequest(
+		*plaid.NewAssetReportPDFGetRequest(token),
+	).Execute()
+	if err != nil {
+		return err
+	}
+	// the client buffers the PDF in a temporary file
+	defer os.Remove(pdfFile.Name())
+	defer pdfFile.Close()
+	pdf, err := io.ReadAll(pdfFile)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.updateAssetReport(job.ID, func(job *db.AssetReport) {
+		job.Status = db.AssetReportStatusReady
+		job.ErrorCode = ""
+		job.Report = report
+		job.PDF = pdf
+	})
+	if err == db.ErrNotFound {
+		// removed while it was being fetched
+		return nil
+	} else if err != nil {
+		return err
+	}
+	s.logger.Info("asset report is ready", zap.String("job_id", job.ID), zap.String("asset_report_id", job.AssetReportID))
+	return nil
+}
+
+// failAssetReport marks a job as failed with the Plaid error code of err.
+func (s *Server) failAssetReport(job *db.AssetReport, err error) {
+	s.logger.Warn("asset report failed", zap.String("job_id", job.ID), zap.Error(err))
+	code := api.ToError(err).ErrorCode
+	_, err = s.updateAssetReport(job.ID, func(job *db.AssetReport) {
+		job.Status = db.AssetReportStatusError
+		job.ErrorCode = code
+	})
+	// a job removed meanwhile has nothing left to fail
+	if err != nil && err != db.ErrNotFound {
+		s.logger.Error("error saving asset report", zap.String("job_id", job.ID), zap.Error(err))
+	}
+}
@@ -0,0 +1,209 @@
+package plaid
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/uitachi123/go-plaid/pkg/plaidfake"
+)
+
+// waitForAssetReport polls the status of a job until it is not pending.
+func waitForAssetReport(t *testing.T, s *Server, jobID string) map[string]interface{} {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(20 * time.Millisecond) {
+		_, resp := do(t, s, "GET", "/api/assets", url.Values{"user": {"alice@test.com"}, "job_id": {jobID}})
+		if resp["status"] != "pending" {
+			return resp
+		}
+	}
+	t.Fatalf("asset report job %v is still pending", jobID)
+	return nil
+}
+
+func Test_Assets(t *testing.T) {
+	s, fake := newTestServer(t)
+	itemID := link(t, s, fake, "alice@test.com")
+
+	code, resp := do(t, s, "POST", "/api/assets", url.Values{
+		"user":             {"alice@test.com"},
+		"days_requested":   {"30"},
+		"client_report_id": {"loan-1"},
+		"first_name":       {"Alice"},
+	})
+	if code != http.StatusAccepted || resp["status"] != "pending" {
+		t.Fatalf("Expected a pending job, got %v %v", code, resp)
+	}
+	jobID := resp["job_id"].(string)
+	if resp["days_requested"] != float64(30) || resp["client_report_id"] != "loan-1" || resp["item_ids"].([]interface{})[0] != itemID {
+		t.Errorf("Unexpected job %v", resp)
+	}
+	code, resp = do(t, s, "GET", "/api/assets/report", url.Values{"user": {"alice@test.com"}, "job_id": {jobID}})
+	if code != http.StatusConflict {
+		t.Errorf("Expected %v\tGot %v: %v", http.StatusConflict, code, resp)
+	}
+
+	if resp = waitForAssetReport(t, s, jobID); resp["status"] != "ready" {
+		t.Fatalf("Data mismatch, expected:  %v got: %v", "ready", resp)
+	}
+	code, resp = do(t, s, "GET", "/api/assets/report", url.Values{"user": {"alice@test.com"}, "job_id": {jobID}})
+	if code != http.StatusOK || resp["asset_report_id"] == nil {
+		t.Errorf("Unexpected report %v %v", code, resp)
+	}
+	req := httptest.NewRequest("GET", "/api/assets/pdf?job_id="+jobID, nil)
+	req.AddCookie(s.Sessions().Cookie("alice@test.com"))
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF")) {
+		t.Errorf("Unexpected PDF %v %v %q", w.Code, w.Header(), w.Body.String())
+	}
+
+	_, resp = do(t, s, "GET", "/api/assets", url.Values{"user": {"alice@test.com"}})
+	if jobs := resp["jobs"].([]interface{}); len(jobs) != 1 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 1, len(jobs))
+	}
+	if code, _ := do(t, s, "GET", "/api/assets", url.Values{"user": {"bob@test.com"}, "job_id": {jobID}}); code != http.StatusNotFound {
+		t.Errorf("Expected %v\tGot %v", http.StatusNotFound, code)
+	}
+	if code, _ := do(t, s, "POST", "/api/assets", url.Values{"user": {"alice@test.com"}, "days_requested": {"1000"}}); code != http.StatusBadRequest {
+		t.Errorf("Expected %v\tGot %v", http.StatusBadRequest, code)
+	}
+}
+
+func Test_AssetsWebhook(t *testing.T) {
+	s, fake := newTestServer(t, func(c *Config) {
+		c.WebhookURL = "https://example.com/api/webhook"
+	})
+	link(t, s, fake, "alice@test.com")
+	fake.Update(func(f *plaidfake.Fixtures) { f.AssetReportPolls = 0 })
+
+	_, resp := do(t, s, "POST", "/api/assets", url.Values{"user": {"alice@test.com"}})
+	jobID := resp["job_id"].(string)
+	time.Sleep(100 * time.Millisecond)
+	if calls := fake.Calls("/asset_report/get"); calls != 0 {
+		t.Errorf("Expected no polling with a webhook, got %v calls", calls)
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"webhook_type":    "ASSETS",
+		"webhook_code":    "PRODUCT_READY",
+		"asset_report_id": resp["asset_report_id"].(string),
+	})
+	req := httptest.NewRequest("POST", "/api/webhook", bytes.NewReader(body))
+	req.Header.Set("Plaid-Verification", fake.SignWebhook(body))
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if resp = waitForAssetReport(t, s, jobID); resp["status"] != "ready" {
+		t.Errorf("Data mismatch, expected:  %v got: %v", "ready", resp)
+	}
+}
+
+func Test_AssetsWebhookLost(t *testing.T) {
+	s, fake := newTestServer(t, func(c *Config) {
+		c.WebhookURL = "https://example.com/api/webhook"
+	})
+	s.assetReportFallback = 20 * time.Millisecond
+	link(t, s, fake, "alice@test.com")
+
+	// without a webhook the job is still polled, slowly
+	code, resp := do(t, s, "POST", "/api/assets", url.Values{"user": {"alice@test.com"}})
+	if code != http.StatusAccepted || resp["status"] != "pending" {
+		t.Fatalf("Expected a pending job, got %v %v", code, resp)
+	}
+	if resp = waitForAssetReport(t, s, resp["job_id"].(string)); resp["status"] != "ready" {
+		t.Errorf("Data mismatch, expected:  %v got: %v", "ready", resp)
+	}
+}
+
+func Test_AssetReportLifecycle(t *testing.T) {
+	s, fake := newTestServer(t)
+	itemID := link(t, s, fake, "alice@test.com")
+	alice := func(v url.Values) url.Values {
+		v.Set("user", "alice@test.com")
+		return v
+	}
+
+	_, resp := do(t, s, "POST", "/api/assets", alice(url.Values{"days_requested": {"30"}}))
+	jobID := resp["job_id"].(string)
+	if code, _ := do(t, s, "POST", "/api/assets/filter", alice(url.Values{"job_id": {jobID}, "account_id": {"acc-1"}})); code != http.StatusConflict {
+		t.Errorf("Expected %v\tGot %v", http.StatusConflict, code)
+	}
+	waitForAssetReport(t, s, jobID)
+
+	// refresh keeps the days requested unless given
+	code, resp := do(t, s, "POST", "/api/assets/refresh", alice(url.Values{"job_id": {jobID}}))
+	if code != http.StatusAccepted || resp["parent_job_id"] != jobID || resp["days_requested"] != float64(30) {
+		t.Fatalf("Unexpected refreshed job %v %v", code, resp)
+	}
+	refreshedID := resp["job_id"].(string)
+	if resp = waitForAssetReport(t, s, refreshedID); resp["status"] != "ready" {
+		t.Errorf("Data mismatch, expected:  %v got: %v", "ready", resp)
+	}
+
+	code, resp = do(t, s, "POST", "/api/assets/filter", alice(url.Values{"job_id": {jobID}, "account_id": {"acc-1,acc-2"}}))
+	if code != http.StatusAccepted || resp["parent_job_id"] != jobID {
+		t.Fatalf("Unexpected filtered job %v %v", code, resp)
+	}
+	filteredID := resp["job_id"].(string)
+	if resp = waitForAssetReport(t, s, filteredID); resp["status"] != "ready" {
+		t.Errorf("Data mismatch, expected:  %v got: %v", "ready", resp)
+	}
+	if code, _ := do(t, s, "POST", "/api/assets/filter", alice(url.Values{"job_id": {jobID}})); code != http.StatusBadRequest {
+		t.Errorf("Expected %v\tGot %v", http.StatusBadRequest, code)
+	}
+
+	// audit copies are shared once per auditor and their token only returned
+	// on creation
+	code, resp = do(t, s, "POST", "/api/assets/audit_copy", alice(url.Values{"job_id": {jobID}, "auditor_id": {"fannie_mae"}}))
+	if code != http.StatusOK || resp["audit_copy_token"] == nil {
+		t.Fatalf("Unexpected audit copy %v %v", code, resp)
+	}
+	if code, _ := do(t, s, "POST", "/api/assets/audit_copy", alice(url.Values{"job_id": {jobID}, "auditor_id": {"fannie_mae"}})); code != http.StatusConflict {
+		t.Errorf("Expected %v\tGot %v", http.StatusConflict, code)
+	}
+	_, resp = do(t, s, "GET", "/api/assets", alice(url.Values{"job_id": {jobID}}))
+	if copies, _ := resp["audit_copies"].([]interface{}); len(copies) != 1 || copies[0].(map[string]interface{})["auditor_id"] != "fannie_mae" {
+		t.Errorf("Unexpected audit copies %v", resp)
+	}
+	code, resp = do(t, s, "POST", "/api/assets/audit_copy/remove", alice(url.Values{"job_id": {jobID}, "auditor_id": {"fannie_mae"}}))
+	if code != http.StatusOK || resp["audit_copies"] != nil {
+		t.Errorf("Unexpected job %v %v", code, resp)
+	}
+	if fake.Calls("/asset_report/audit_copy/remove") != 1 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 1, fake.Calls("/asset_report/audit_copy/remove"))
+	}
+	if code, _ := do(t, s, "POST", "/api/assets/audit_copy/remove", alice(url.Values{"job_id": {jobID}, "auditor_id": {"fannie_mae"}})); code != http.StatusNotFound {
+		t.Errorf("Expected %v\tGot %v", http.StatusNotFound, code)
+	}
+
+	// every report of the item is listed and removed
+	_, resp = do(t, s, "GET", "/api/assets", alice(url.Values{"item_id": {itemID}}))
+	if jobs := resp["jobs"].([]interface{}); len(jobs) != 3 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 3, len(jobs))
+	}
+	code, resp = do(t, s, "POST", "/api/assets/remove", alice(url.Values{"job_id": {refreshedID}}))
+	if removed := resp["removed"].([]interface{}); code != http.StatusOK || len(removed) != 1 || removed[0] != refreshedID {
+		t.Errorf("Unexpected removal %v %v", code, resp)
+	}
+	code, resp = do(t, s, "POST", "/api/assets/remove", alice(url.Values{"item_id": {itemID}}))
+	if removed := resp["removed"].([]interface{}); code != http.StatusOK || len(removed) != 2 {
+		t.Errorf("Unexpected removal %v %v", code, resp)
+	}
+	if fake.Calls("/asset_report/remove") != 3 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 3, fake.Calls("/asset_report/remove"))
+	}
+	_, resp = do(t, s, "GET", "/api/assets", alice(url.Values{}))
+	if jobs := resp["jobs"].([]interface{}); len(jobs) != 0 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 0, len(jobs))
+	}
+	if code, _ := do(t, s, "POST", "/api/assets/remove", alice(url.Values{})); code != http.StatusBadRequest {
+		t.Errorf("Expected %v\tGot %v", http.StatusBadRequest, code)
+	}
+}
@@ -0,0 +1,333 @@
+package plaid
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"gopkg.in/yaml.v2"
+)
+
+// Config configures the Plaid endpoints of the server. It is loaded from
+// defaults, then an optional YAML or JSON file, then PLAID_* env vars, then
+// command line flags, each overriding the previous one.
+type Config struct {
+	ClientID string `json:"client_id" yaml:"client_id"`
+	Secret   string `json:"secret" yaml:"secret"`
+	// Env is the Plaid environment: sandbox, development or production.
+	Env string `json:"env" yaml:"env"`
+	// APIURL overrides the URL of the Plaid environment, e.g. to use a
+	// plaidfake server.
+	APIURL       string   `json:"api_url" yaml:"api_url"`
+	Products     []string `json:"products" yaml:"products"`
+	CountryCodes []string `json:"country_codes" yaml:"country_codes"`
+	// RedirectURI is where OAuth institutions send users back to, served by
+	// /api/oauth/redirect.
+	RedirectURI string `json:"redirect_uri" yaml:"redirect_uri"`
+	WebhookURL  string `json:"webhook_url" yaml:"webhook_url"`
+	// TokenKey and TokenKeyFile hold the base64 keys encrypting access
+	// tokens at rest, the first one being used for new tokens.
+	TokenKey     string `json:"token_key" yaml:"token_key"`
+	TokenKeyFile string `json:"token_key_file" yaml:"token_key_file"`
+	// SessionKey is the base64 key signing session cookies. Sessions do not
+	// survive restarts when it is not set.
+	SessionKey string `json:"session_key" yaml:"session_key"`
+	// SessionTTL is how long a session lasts after logging in.
+	SessionTTL Duration `json:"session_ttl" yaml:"session_ttl"`
+	// ItemCheckInterval is how often every item is checked with /item/get
+	// to catch the state changes whose webhook was missed. Zero disables
+	// the checks.
+	ItemCheckInterval Duration `json:"item_check_interval" yaml:"item_check_interval"`
+	// Admins are the emails of the users with the users:admin scope.
+	Admins []string `json:"admins" yaml:"admins"`
+	// DBFile is the encrypted journal where users, items, transactions and
+	// asset reports are persisted, if set.
+	DBFile string `json:"db_file" yaml:"db_file"`
+	// LedgerMapping is the default account mapping file of ledger exports.
+	LedgerMapping string `json:"ledger_mapping" yaml:"ledger_mapping"`
+	Port          string `json:"port" yaml:"port"`
+	// Retry holds the retry policies of Plaid endpoints by path, e.g.
+	// /transactions/sync, and the policy of the other endpoints as
+	// "default".
+	Retry map[string]RetryPolicy `json:"retry" yaml:"retry"`
+}
+
+// DefaultConfig returns the configuration used for anything left unset.
+func DefaultConfig() *Config {
+	return &Config{
+		Env:          "sandbox",
+		Products:     []string{"transactions"},
+		CountryCodes: []string{"US"},
+		Port:         "8080",
+		SessionTTL:   Duration(24 * time.Hour),
+		// items are checked a few times a day, webhooks reporting most
+		// changes as they happen
+		ItemCheckInterval: Duration(6 * time.Hour),
+		Retry:             map[string]RetryPolicy{},
+	}
+}
+
+// LoadConfig registers the configuration flags on fs, parses args and
+// returns the resulting configuration. The file given by --config or
+// PLAID_CONFIG is read first if set. The configuration is not validated.
+func LoadConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	configFile := fs.String("config", "", "YAML or JSON configuration file (env PLAID_CONFIG)")
+	values := make([]*string, len(configFlags))
+	for i, f := range configFlags {
+		if f.name != "" {
+			values[i] = fs.String(f.name, "", f.usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := DefaultConfig()
+	path := *configFile
+	if path == "" {
+		path = os.Getenv("PLAID_CONFIG")
+	}
+	if path != "" {
+		if err := c.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	c.LoadEnv(os.Getenv)
+	fs.Visit(func(f *flag.Flag) {
+		for i, cf := range configFlags {
+			if cf.name == f.Name {
+				cf.set(c, *values[i])
+			}
+		}
+	})
+	return c, nil
+}
+
+// configFlags are the flags and env vars setting each configuration field.
+// Secrets have no flag so they do not show up in process lists.
+var configFlags = []struct {
+	name  string
+	env   string
+	usage string
+	set   func(c *Config, v string)
+}{
+	{"client-id", "PLAID_CLIENT_ID", "Plaid client id", func(c *Config, v string) { c.ClientID = v }},
+	{"", "PLAID_SECRET", "", func(c *Config, v string) { c.Secret = v }},
+	{"env", "PLAID_ENV", "Plaid environment: sandbox, development or production", func(c *Config, v string) { c.Env = v }},
+	{"plaid-api-url", "PLAID_API_URL", "URL of the Plaid API, overriding the environment", func(c *Config, v string) { c.APIURL = v }},
+	{"products", "PLAID_PRODUCTS", "comma separated Plaid products", func(c *Config, v string) { c.Products = splitList(v) }},
+	{"country-codes", "PLAID_COUNTRY_CODES", "comma separated country codes", func(c *Config, v string) { c.CountryCodes = splitList(v) }},
+	{"redirect-uri", "PLAID_REDIRECT_URI", "OAuth redirect URI, e.g. https://host/api/oauth/redirect", func(c *Config, v string) { c.RedirectURI = v }},
+	{"webhook-url", "PLAID_WEBHOOK_URL", "URL Plaid sends webhooks to", func(c *Config, v string) { c.WebhookURL = v }},
+	{"", "PLAID_TOKEN_KEY", "", func(c *Config, v string) { c.TokenKey = v }},
+	{"token-key-file", "PLAID_TOKEN_KEY_FILE", "file holding the keys encrypting access tokens", func(c *Config, v string) { c.TokenKeyFile = v }},
+	{"", "PLAID_SESSION_KEY", "", func(c *Config, v string) { c.SessionKey = v }},
+	{"session-ttl", "PLAID_SESSION_TTL", "how long a session lasts after logging in, e.g. 12h", func(c *Config, v string) { c.SessionTTL = parseDuration(v) }},
+	{"item-check-interval", "PLAID_ITEM_CHECK_INTERVAL", "how often items are checked with /item/get, e.g. 6h, or 0 to disable", func(c *Config, v string) { c.ItemCheckInterval = parseDuration(v) }},
+	{"admins", "PLAID_ADMINS", "comma separated emails of the users allowed to manage every user", func(c *Config, v string) { c.Admins = splitList(v) }},
+	{"db-file", "PLAID_DB_FILE", "file persisting users, items, transactions and asset reports", func(c *Config, v string) { c.DBFile = v }},
+	{"ledger-mapping", "PLAID_LEDGER_MAPPING", "default account mapping file of ledger exports", func(c *Config, v string) { c.LedgerMapping = v }},
+	{"port", "APP_PORT", "listening port", func(c *Config, v string) { c.Port = v }},
+}
+
+// LoadFile reads a YAML or JSON configuration file, chosen by its extension.
+func (c *Config) LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(b, c)
+	default:
+		return fmt.Errorf("unsupported configuration file %s, expected .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadEnv overrides the configuration with the env vars that are set.
+func (c *Config) LoadEnv(getenv func(string) string) {
+	for _, f := range configFlags {
+		if v := getenv(f.env); v != "" {
+			f.set(c, v)
+		}
+	}
+}
+
+// Secrets returns the configured secrets to redact from logs, including the
+// keys of TokenKeyFile.
+func (c *Config) Secrets() []string {
+	secrets := append([]string{c.Secret, c.SessionKey}, splitKeys(c.TokenKey)...)
+	if c.TokenKeyFile != "" {
+		// a file that can not be read fails NewServer, leaving nothing to
+		// redact it from
+		if b, err := os.ReadFile(c.TokenKeyFile); err == nil {
+			secrets = append(secrets, splitKeys(string(b))...)
+		}
+	}
+	return secrets
+}
+
+// Validate checks the configuration.
+func (c *Config) Validate() error {
+	var errs []string
+	if c.ClientID == "" {
+		errs = append(errs, "PLAID_CLIENT_ID is not set")
+	}
+	if c.Secret == "" {
+		errs = append(errs, "PLAID_SECRET is not set")
+	}
+	if _, ok := environments[c.Env]; !ok {
+		errs = append(errs, fmt.Sprintf("unknown environment %q, expected sandbox, development or production", c.Env))
+	}
+	if len(c.Products) == 0 {
+		errs = append(errs, "no products configured")
+	}
+	for _, p := range c.Products {
+		if !plaid.Products(p).IsValid() {
+			errs = append(errs, fmt.Sprintf("unknown product %q", p))
+		}
+	}
+	if len(c.CountryCodes) == 0 {
+		errs = append(errs, "no country codes configured")
+	}
+	for _, cc := range c.CountryCodes {
+		if !plaid.CountryCode(cc).IsValid() {
+			errs = append(errs, fmt.Sprintf("unknown country code %q", cc))
+		}
+	}
+	for _, u := range []struct{ name, value string }{
+		{"api url", c.APIURL},
+		{"redirect uri", c.RedirectURI},
+		{"webhook url", c.WebhookURL},
+	} {
+		if u.value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u.value); err != nil || !parsed.IsAbs() || parsed.Host == "" {
+			errs = append(errs, fmt.Sprintf("invalid %s %q", u.name, u.value))
+		}
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port <= 0 || port > 65535 {
+		errs = append(errs, fmt.Sprintf("invalid port %q", c.Port))
+	}
+	for path, p := range c.Retry {
+		if p.MaxAttempts < 0 || p.BaseDelay < 0 || p.MaxDelay < 0 {
+			errs = append(errs, fmt.Sprintf("invalid retry policy %q", path))
+		}
+	}
+	if c.SessionTTL <= 0 {
+		errs = append(errs, "invalid session ttl")
+	}
+	if c.ItemCheckInterval < 0 {
+		errs = append(errs, "invalid item check interval")
+	}
+	if c.SessionKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(c.SessionKey); err != nil || len(key) < 32 {
+			errs = append(errs, "PLAID_SESSION_KEY must be a base64 key of at least 32 bytes")
+		}
+	}
+	if c.DBFile != "" && c.TokenKey == "" && c.TokenKeyFile == "" {
+		errs = append(errs, "PLAID_TOKEN_KEY or PLAID_TOKEN_KEY_FILE must be set to persist items")
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Duration is a time.Duration read from configuration files as a string
+// such as "1h30m", or as a number of nanoseconds in JSON.
+type Duration time.Duration
+
+// UnmarshalJSON reads a duration string or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case float64:
+		*d = Duration(v)
+	default:
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	return nil
+}
+
+// UnmarshalYAML reads a duration string or a number of nanoseconds.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var ns int64
+	if err := unmarshal(&ns); err == nil {
+		*d = Duration(ns)
+		return nil
+	}
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// parseDuration parses a duration, returning -1 for invalid ones so they
+// fail validation.
+func parseDuration(s string) Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return -1
+	}
+	return Duration(d)
+}
+
+// splitKeys splits keys like db.ParseKeys does, one per line or comma
+// separated, dropping blank lines and lines starting with #.
+func splitKeys(s string) []string {
+	var res []string
+	for _, v := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == '\n' || r == ','
+	}) {
+		if v = strings.TrimSpace(v); v != "" && !strings.HasPrefix(v, "#") {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// splitList splits a comma separated list, dropping empty elements.
+func splitList(s string) []string {
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
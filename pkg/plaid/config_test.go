@@ -0,0 +1,162 @@
+package plaid
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_LoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	yaml := `client_id: file-client
+secret: file-secret
+env: development
+products: [transactions, auth]
+port: "9000"
+retry:
+  default: {max_attempts: 5}
+  /transactions/sync: {base_delay: 1s}
+`
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PLAID_CONFIG", "")
+	t.Setenv("PLAID_CLIENT_ID", "")
+	t.Setenv("PLAID_ENV", "")
+	t.Setenv("PLAID_PRODUCTS", "")
+	t.Setenv("APP_PORT", "")
+	t.Setenv("PLAID_SECRET", "env-secret")
+	t.Setenv("PLAID_COUNTRY_CODES", "US, CA")
+	t.Setenv("PLAID_ADMINS", "alice@test.com")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c, err := LoadConfig(fs, []string{"--config", path, "--port", "9090", "--session-ttl", "12h", "--item-check-interval", "1h"})
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	expected := &Config{
+		ClientID:          "file-client",
+		Secret:            "env-secret",
+		Env:               "development",
+		Products:          []string{"transactions", "auth"},
+		CountryCodes:      []string{"US", "CA"},
+		Port:              "9090",
+		SessionTTL:        Duration(12 * time.Hour),
+		Admins:            []string{"alice@test.com"},
+		Retry:             DefaultConfig().Retry,
+		ItemCheckInterval: Duration(time.Hour),
+	}
+	expected.Retry["default"] = RetryPolicy{MaxAttempts: 5}
+	expected.Retry["/transactions/sync"] = RetryPolicy{BaseDelay: Duration(time.Second)}
+	if !reflect.DeepEqual(expected, c) {
+		t.Errorf("Data mismatch, expected:  %+v got: %+v", expected, c)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+}
+
+func Test_LoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	json := `{"client_id": "json-client", "webhook_url": "https://example.com/api/webhook",
+"session_ttl": "12h", "item_check_interval": 60000000000, "retry": {"default": {"base_delay": "1s"}}}`
+	if err := os.WriteFile(path, []byte(json), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := DefaultConfig()
+	if err := c.LoadFile(path); err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	if c.ClientID != "json-client" || c.WebhookURL != "https://example.com/api/webhook" || c.Env != "sandbox" {
+		t.Errorf("Unexpected config %+v", c)
+	}
+	if c.SessionTTL != Duration(12*time.Hour) || c.ItemCheckInterval != Duration(time.Minute) || c.Retry["default"].BaseDelay != Duration(time.Second) {
+		t.Errorf("Unexpected durations %+v", c)
+	}
+	for _, invalid := range []string{`{"client_idd": "typo"}`, `{"session_ttl": "12 hours"}`, `{"session_ttl": true}`} {
+		if err := os.WriteFile(path, []byte(invalid), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := DefaultConfig().LoadFile(path); err == nil {
+			t.Errorf("Expected %s to be rejected", invalid)
+		}
+	}
+
+	path = filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("session_ttl: 90m\nitem_check_interval: 60000000000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c = DefaultConfig()
+	if err := c.LoadFile(path); err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	if c.SessionTTL != Duration(90*time.Minute) || c.ItemCheckInterval != Duration(time.Minute) {
+		t.Errorf("Unexpected durations %+v", c)
+	}
+	if err := os.WriteFile(path, []byte("client_idd: typo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := DefaultConfig().LoadFile(path); err == nil {
+		t.Errorf("Expected unknown fields to be rejected")
+	}
+	if err := DefaultConfig().LoadFile(filepath.Join(dir, "config.toml")); err == nil {
+		t.Errorf("Expected missing file to be rejected")
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	c := &Config{
+		Env:               "staging",
+		Products:          []string{"transactions", "bogus"},
+		CountryCodes:      []string{"XX"},
+		WebhookURL:        "/api/webhook",
+		Port:              "http",
+		DBFile:            "plaid.json",
+		SessionKey:        "c2hvcnQ=",
+		ItemCheckInterval: -1,
+	}
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("Expected invalid config")
+	}
+	for _, expected := range []string{
+		"PLAID_CLIENT_ID is not set",
+		"PLAID_SECRET is not set",
+		`unknown environment "staging"`,
+		`unknown product "bogus"`,
+		`unknown country code "XX"`,
+		`invalid webhook url "/api/webhook"`,
+		`invalid port "http"`,
+		"PLAID_TOKEN_KEY or PLAID_TOKEN_KEY_FILE must be set",
+		"invalid session ttl",
+		"invalid item check interval",
+		"PLAID_SESSION_KEY must be a base64 key of at least 32 bytes",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %v\tGot %v", expected, err)
+		}
+	}
+}
+
+func Test_Secrets(t *testing.T) {
+	c := &Config{Secret: "secret", SessionKey: "session-key", TokenKey: "new-key,old-key"}
+	expected := []string{"secret", "session-key", "new-key", "old-key"}
+	if secrets := c.Secrets(); !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("Data mismatch, expected:  %v got: %v", expected, secrets)
+	}
+
+	c.TokenKeyFile = filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(c.TokenKeyFile, []byte("# rotated 2022-01-01\nfile-key\n\nfile-old-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expected = append(expected, "file-key", "file-old-key")
+	if secrets := c.Secrets(); !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("Data mismatch, expected:  %v got: %v", expected, secrets)
+	}
+}
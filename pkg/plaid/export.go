@@ -0,0 +1,234 @@
+package plaid
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"github.com/uitachi123/go-plaid/pkg/api"
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"github.com/uitachi123/go-plaid/pkg/export"
+	"go.uber.org/zap"
+)
+
+// ExportTransactions streams the transactions of an item as CSV, OFX or QIF.
+// It takes the same filters as Transactions, and for CSV a comma separated
+// "columns" parameter.
+func (s *Server) ExportTransactions(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		format = "csv"
+	}
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "ofx":
+		contentType = "application/x-ofx"
+	case "qif":
+		contentType = "application/qif"
+	default:
+		api.WriteError(w, api.BadRequest("INVALID_FIELD", fmt.Sprintf("unsupported format %q, expected csv, ofx or qif", format)))
+		return
+	}
+	var columns []string
+	if v := r.FormValue("columns"); v != "" {
+		columns = strings.Split(v, ",")
+		if err := export.CheckColumns(columns); err != nil {
+			api.WriteError(w, api.BadRequest("INVALID_FIELD", err.Error()))
+			return
+		}
+	}
+
+	query, err := transactionQuery(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	query.ItemID = item.ID
+	query.Ascending = r.FormValue("sort") != "desc"
+
+	if err := s.syncTransactions(ctx, item.ID, item.token); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	transactions, err := s.queryAllTransactions(query)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	// OFX statements are typed after their account and end with its balance
+	var accounts []export.Account
+	if format == "ofx" {
+		accountsGetResp, _, err := s.client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(
+			*plaid.NewAccountsGetRequest(item.token),
+		).Execute()
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		for _, a := range accountsGetResp.GetAccounts() {
+			accounts = append(accounts, exportAccount(a, a.GetBalances()))
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="transactions-%s.%s"`, item.ID, format))
+	switch format {
+	case "csv":
+		err = export.CSV(w, transactions, columns)
+	case "ofx":
+		err = export.OFX(w, accounts, transactions, time.Now())
+	case "qif":
+		err = export.QIF(w, transactions)
+	}
+	if err != nil {
+		// the response is already committed
+		s.logger.Error("error exporting transactions", zap.String("item_id", item.ID), zap.Error(err))
+	}
+}
+
+// queryAllTransactions returns every transaction matching q, following the
+// pages of the local store.
+func (s *Server) queryAllTransactions(q db.TransactionQuery) ([]*db.Transaction, error) {
+	var res []*db.Transaction
+	q.Limit = db.MaxPageSize
+	for {
+		page, _, next, err := s.store.QueryTransactions(q)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, page...)
+		if next == "" {
+			return res, nil
+		}
+		q.Cursor = next
+	}
+}
+
+// ExportLedger streams the transactions of an item as a beancount or
+// ledger-cli journal with balance assertions. The account mapping is read
+// from the JSON body of a POST request, or else from the file at
+// the configured ledger mapping.
+func (s *Server) ExportLedger(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		format = "beancount"
+	}
+	if format != "beancount" && format != "ledger" {
+		api.WriteError(w, api.BadRequest("INVALID_FIELD", fmt.Sprintf("unsupported format %q, expected beancount or ledger", format)))
+		return
+	}
+	mapping, err := s.ledgerMapping(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	query, err := transactionQuery(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	query.ItemID = item.ID
+
+	// Map accounts from /accounts/get and assert the real-time balances
+	// from /accounts/balance/get
+	accountsGetResp, _, err := s.client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(
+		*plaid.NewAccountsGetRequest(item.token),
+	).Execute()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	balancesGetResp, _, err := s.client.PlaidApi.AccountsBalanceGet(ctx).AccountsBalanceGetRequest(
+		*plaid.NewAccountsBalanceGetRequest(item.token),
+	).Execute()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	balances := map[string]plaid.AccountBalance{}
+	for _, a := range balancesGetResp.GetAccounts() {
+		balances[a.GetAccountId()] = a.GetBalances()
+	}
+	var accounts []export.Account
+	for _, a := range accountsGetResp.GetAccounts() {
+		accounts = append(accounts, exportAccount(a, balances[a.GetAccountId()]))
+	}
+
+	if err := s.syncTransactions(ctx, item.ID, item.token); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	transactions, err := s.queryAllTransactions(query)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="transactions-%s.%s"`, item.ID, format))
+	if format == "beancount" {
+		err = export.Beancount(w, accounts, transactions, mapping, time.Now())
+	} else {
+		err = export.LedgerCLI(w, accounts, transactions, mapping, time.Now())
+	}
+	if err != nil {
+		// the response is already committed
+		s.logger.Error("error exporting transactions", zap.String("item_id", item.ID), zap.Error(err))
+	}
+}
+
+// exportAccount converts a Plaid account and its balance, which may be the
+// zero balance when it is unknown.
+func exportAccount(a plaid.AccountBase, balance plaid.AccountBalance) export.Account {
+	account := export.Account{
+		ID:       a.GetAccountId(),
+		Name:     a.GetName(),
+		Type:     string(a.GetType()),
+		Subtype:  string(a.GetSubtype()),
+		Currency: balance.GetIsoCurrencyCode(),
+	}
+	if current, ok := balance.GetCurrentOk(); ok {
+		account.Balance = current
+	}
+	return account
+}
+
+func (s *Server) ledgerMapping(r *http.Request) (*export.Mapping, error) {
+	if r.Method == "POST" && r.Header.Get("Content-Type") == "application/json" {
+		m, err := export.LoadMapping(r.Body)
+		if err != nil {
+			return nil, api.BadRequest("INVALID_BODY", err.Error())
+		}
+		return m, nil
+	}
+	if s.config.LedgerMapping == "" {
+		return &export.Mapping{}, nil
+	}
+	f, err := os.Open(s.config.LedgerMapping)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return export.LoadMapping(f)
+}
@@ -0,0 +1,142 @@
+package plaid
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"github.com/uitachi123/go-plaid/pkg/api"
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"go.uber.org/zap"
+)
+
+// consentExpiryWarning is how long before their consent expires items are
+// marked pending expiration, as Plaid does with its PENDING_EXPIRATION
+// webhook.
+const consentExpiryWarning = 7 * 24 * time.Hour
+
+// needsAttention tells if the user of an item should be shown a banner for
+// it: to reconnect it, or to add the accounts the institution now has.
+func needsAttention(item *db.Item) bool {
+	return item.Status != db.ItemStatusHealthy || item.NewAccountsAvailable
+}
+
+// ItemsHealth lists the items of the calling user that need their attention,
+// with their status, so the UI can show reconnect banners. Items with
+// "needs_update" set are repaired with Link update mode.
+func (s *Server) ItemsHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	user, err := s.requestUser(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	userItems, err := s.store.ListItems(user)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	sort.Slice(userItems, func(i, j int) bool { return userItems[i].ID < userItems[j].ID })
+	res := []itemSummary{}
+	for _, item := range userItems {
+		if needsAttention(item) {
+			res = append(res, summarizeItem(item))
+		}
+	}
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{"items": res})
+}
+
+// checkItemsEvery checks every item at startup then each interval, until the
+// server is closed.
+func (s *Server) checkItemsEvery(interval time.Duration) {
+	s.checkItems(s.ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkItems(s.ctx)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// checkItems checks every item with /item/get. Failures are logged, so one
+// item failing does not keep the others from being checked.
+func (s *Server) checkItems(ctx context.Context) {
+	items, err := s.store.ListItems("")
+	if err != nil {
+		s.logger.Warn("error listing items to check", zap.Error(err))
+		return
+	}
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.checkItem(ctx, item); err != nil {
+			s.logger.Warn("error checking item", zap.String("item_id", item.ID), zap.Error(err))
+		}
+	}
+}
+
+// checkItem updates the status, consent expiration and products of an item
+// from /item/get. An item in error that Plaid no longer reports broken is
+// repaired, and an item whose consent expires soon is marked pending
+// expiration, in case their webhook was missed.
+func (s *Server) checkItem(ctx context.Context, item *db.Item) error {
+	accessToken, err := s.store.Token(item)
+	if err != nil {
+		return err
+	}
+	resp, _, err := s.client.PlaidApi.ItemGet(ctx).ItemGetRequest(
+		*plaid.NewItemGetRequest(accessToken),
+	).Execute()
+	var itemErr *plaid.Error
+	consentExpiresAt, products := item.ConsentExpiresAt, item.Products
+	switch plaidErr, perr := plaid.ToPlaidError(err); {
+	case err == nil:
+		itemErr = resp.GetItem().Error.Get()
+		consentExpiresAt = resp.GetItem().ConsentExpirationTime.Get()
+		products = itemProducts(resp.GetItem())
+	case perr == nil && plaidErr.ErrorType == "ITEM_ERROR":
+		// the item itself is broken, e.g. removed at the institution
+		itemErr = &plaidErr
+	default:
+		return err
+	}
+	now := time.Now()
+	repaired := false
+	updated, err := s.store.UpdateItem(item.ID, func(item *db.Item) {
+		item.CheckedAt = &now
+		item.ConsentExpiresAt = consentExpiresAt
+		item.Products = products
+		switch {
+		case itemErr != nil:
+			item.Status = db.ItemStatusError
+			item.ErrorCode = itemErr.ErrorCode
+		case item.Status == db.ItemStatusError:
+			repaired = true
+		case item.ConsentExpiresAt != nil && item.ConsentExpiresAt.Sub(now) < consentExpiryWarning:
+			item.Status = db.ItemStatusPendingExpiration
+		case item.ConsentExpiresAt != nil && item.Status == db.ItemStatusPendingExpiration:
+			// the consent was renewed outside of this app
+			item.Status = db.ItemStatusHealthy
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if updated.Status != item.Status {
+		s.logger.Info("item status changed", zap.String("item_id", item.ID), zap.String("status", updated.Status), zap.String("error_code", updated.ErrorCode))
+	}
+	if repaired {
+		return s.repairItem(ctx, item.ID, false)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package plaid
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"github.com/uitachi123/go-plaid/pkg/plaidfake"
+)
+
+func Test_ItemsHealth(t *testing.T) {
+	s, fake := newTestServer(t)
+	broken := link(t, s, fake, "alice@test.com")
+	expiring := link(t, s, fake, "alice@test.com")
+	alice := url.Values{"user": {"alice@test.com"}}
+	health := func() []interface{} {
+		t.Helper()
+		code, resp := do(t, s, "GET", "/api/items/health", alice)
+		if code != http.StatusOK {
+			t.Fatalf("Expected %v\tGot %v: %v", http.StatusOK, code, resp)
+		}
+		return resp["items"].([]interface{})
+	}
+	if items := health(); len(items) != 0 {
+		t.Errorf("Expected healthy items, got %v", items)
+	}
+
+	fake.BreakItem(broken, "ITEM_LOGIN_REQUIRED")
+	s.checkItems(context.Background())
+	items := health()
+	if len(items) != 1 {
+		t.Fatalf("Data mismatch, expected:  %v got: %v", 1, len(items))
+	}
+	if item := items[0].(map[string]interface{}); item["item_id"] != broken || item["status"] != db.ItemStatusError ||
+		item["error_code"] != "ITEM_LOGIN_REQUIRED" || item["needs_update"] != true || item["checked_at"] == nil {
+		t.Errorf("Unexpected item %v", item)
+	}
+
+	// consents expiring soon are caught, and items repaired outside of the
+	// app synced again
+	fake.RepairItem(broken)
+	fake.Update(func(f *plaidfake.Fixtures) {
+		f.ConsentExpiration = time.Now().Add(72 * time.Hour)
+		f.BilledProducts = []string{"transactions", "identity"}
+	})
+	s.checkItems(context.Background())
+	if item, _ := s.store.GetItem(broken); item.Status != db.ItemStatusHealthy || item.ErrorCode != "" || item.LastSyncedAt == nil {
+		t.Errorf("Expected a repaired item, got %v", item)
+	}
+	if item, _ := s.store.GetItem(expiring); item.Status != db.ItemStatusPendingExpiration || item.ConsentExpiresAt == nil {
+		t.Errorf("Expected an item pending expiration, got %v", item)
+	}
+	if item, _ := s.store.GetItem(expiring); !reflect.DeepEqual(item.Products, []string{"transactions", "identity"}) {
+		t.Errorf("Data mismatch, expected:  %v got: %v", []string{"transactions", "identity"}, item.Products)
+	}
+
+	// consents renewed outside of the app are healthy again
+	fake.Update(func(f *plaidfake.Fixtures) { f.ConsentExpiration = time.Now().Add(90 * 24 * time.Hour) })
+	s.checkItems(context.Background())
+	if items := health(); len(items) != 0 {
+		t.Errorf("Expected healthy items, got %v", items)
+	}
+	if _, resp := do(t, s, "GET", "/api/items", alice); resp["items"].([]interface{})[0].(map[string]interface{})["consent_expires_at"] == nil {
+		t.Errorf("Expected the consent expiration to be listed, got %v", resp)
+	}
+}
+
+func Test_ItemsHealthWebhooks(t *testing.T) {
+	s, fake := newTestServer(t)
+	itemID := link(t, s, fake, "alice@test.com")
+
+	expiration := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	sendWebhook(t, s, fake, map[string]interface{}{
+		"webhook_type":            "ITEM",
+		"webhook_code":            "PENDING_EXPIRATION",
+		"item_id":                 itemID,
+		"consent_expiration_time": expiration.Format(time.RFC3339),
+	})
+	if item, _ := s.store.GetItem(itemID); item.Status != db.ItemStatusPendingExpiration || item.ConsentExpiresAt == nil || !item.ConsentExpiresAt.Equal(expiration) {
+		t.Errorf("Unexpected item %v", item)
+	}
+
+	sendWebhook(t, s, fake, map[string]interface{}{"webhook_type": "ITEM", "webhook_code": "USER_PERMISSION_REVOKED", "item_id": itemID})
+	_, resp := do(t, s, "GET", "/api/items/health", url.Values{"user": {"alice@test.com"}})
+	items := resp["items"].([]interface{})
+	if len(items) != 1 || items[0].(map[string]interface{})["error_code"] != "USER_PERMISSION_REVOKED" || items[0].(map[string]interface{})["needs_update"] != false {
+		t.Errorf("Unexpected items %v", items)
+	}
+	if _, resp := do(t, s, "GET", "/api/items/health", url.Values{"user": {"bob@test.com"}}); len(resp["items"].([]interface{})) != 0 {
+		t.Errorf("Unexpected items of bob %v", resp)
+	}
+}
+
+func Test_ItemChecksAtStartup(t *testing.T) {
+	s, fake := newTestServer(t)
+	itemID := link(t, s, fake, "alice@test.com")
+	fake.BreakItem(itemID, "ITEM_LOGIN_REQUIRED")
+
+	// items are checked right away, not once the first interval has passed
+	go s.checkItemsEvery(time.Hour)
+	defer s.Close()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if item, _ := s.store.GetItem(itemID); item.Status == db.ItemStatusError {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Expected the item to be checked at startup")
+		}
+	}
+}
+
+func Test_ItemChecks(t *testing.T) {
+	s, fake := newTestServer(t, func(c *Config) {
+		c.ItemCheckInterval = Duration(20 * time.Millisecond)
+	})
+	itemID := link(t, s, fake, "alice@test.com")
+	fake.BreakItem(itemID, "ITEM_LOGIN_REQUIRED")
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if item, _ := s.store.GetItem(itemID); item.Status == db.ItemStatusError {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Expected the item to be checked")
+		}
+	}
+	s.Close()
+	time.Sleep(50 * time.Millisecond)
+	calls := fake.Calls("/item/get")
+	time.Sleep(100 * time.Millisecond)
+	if fake.Calls("/item/get") != calls {
+		t.Errorf("Expected the checks to stop")
+	}
+}
@@ -0,0 +1,415 @@
+package plaid
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"github.com/uitachi123/go-plaid/pkg/api"
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"go.uber.org/zap"
+)
+
+// maxNicknameLength is the maximum number of characters of item nicknames.
+const maxNicknameLength = 64
+
+// linkedItem is a Plaid item linked by a user together with its decrypted
+// access token.
+type linkedItem struct {
+	*db.Item
+	token string
+}
+
+var (
+	errNoItems      = api.NotFound("NO_ITEMS", "no items linked for user")
+	errItemNotFound = api.NotFound("ITEM_NOT_FOUND", "item not found")
+	errAmbiguous    = api.BadRequest("MISSING_FIELDS", "item_id is required when a user has more than one item")
+	errNoItemID     = api.BadRequest("MISSING_FIELDS", "item_id is required")
+)
+
+// registry resolves linked items, which are stored in pkg/db keyed by user
+// email and item_id with their access tokens encrypted at rest.
+type registry struct {
+	store *db.Store
+
+	mu sync.Mutex
+	// payments holds the payment_id created for a user's link token until
+	// the resulting public_token is exchanged for an item.
+	payments map[string]string
+}
+
+func newRegistry(store *db.Store) *registry {
+	return &registry{
+		store:    store,
+		payments: map[string]string{},
+	}
+}
+
+// put seals the access token and stores the item.
+func (r *registry) put(item *db.Item, accessToken string) error {
+	sealed, err := r.store.SealToken(accessToken)
+	if err != nil {
+		return err
+	}
+	item.AccessToken = sealed
+	return r.store.SaveItem(item)
+}
+
+// get returns the item of a user. When itemID is empty the user's only item
+// is returned.
+func (r *registry) get(user, itemID string) (*linkedItem, error) {
+	userItems, err := r.store.ListItems(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(userItems) == 0 {
+		return nil, errNoItems
+	}
+	var found *db.Item
+	if itemID == "" {
+		if len(userItems) > 1 {
+			return nil, errAmbiguous
+		}
+		found = userItems[0]
+	}
+	for _, item := range userItems {
+		if item.ID == itemID {
+			found = item
+		}
+	}
+	if found == nil {
+		return nil, errItemNotFound
+	}
+	token, err := r.store.Token(found)
+	if err != nil {
+		return nil, err
+	}
+	return &linkedItem{Item: found, token: token}, nil
+}
+
+// list returns the ids of the items of a user ordered by item_id.
+func (r *registry) list(user string) ([]string, error) {
+	userItems, err := r.store.ListItems(user)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, item := range userItems {
+		res = append(res, item.ID)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (r *registry) setPayment(user, paymentID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payments[user] = paymentID
+}
+
+// takePayment returns and forgets the pending payment_id of a user.
+func (r *registry) takePayment(user string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	paymentID := r.payments[user]
+	delete(r.payments, user)
+	return paymentID
+}
+
+// requestUser returns the email of the calling user, authenticated by its
+// session.
+func (s *Server) requestUser(r *http.Request) (string, error) {
+	email := auth.UserFrom(r.Context())
+	if email == "" {
+		return "", auth.ErrNoSession
+	}
+	return email, nil
+}
+
+// requestItem resolves the item of the calling user selected by the
+// "item_id" parameter of the request.
+func (s *Server) requestItem(r *http.Request) (*linkedItem, error) {
+	user, err := s.requestUser(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.items.get(user, r.FormValue("item_id"))
+}
+
+// requestAccountIDs returns the account ids selected by the request, either
+// repeated or comma separated "account_id" parameters.
+func requestAccountIDs(r *http.Request) []string {
+	if err := r.ParseForm(); err != nil {
+		return nil
+	}
+	var ids []string
+	for _, v := range r.Form["account_id"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// itemSummary is what is shown of an item in item lists, with its health but
+// without its access token or sync cursor.
+type itemSummary struct {
+	ItemID               string     `json:"item_id"`
+	InstitutionID        string     `json:"institution_id,omitempty"`
+	InstitutionName      string     `json:"institution_name,omitempty"`
+	Nickname             string     `json:"nickname,omitempty"`
+	Status               string     `json:"status"`
+	ErrorCode            string     `json:"error_code,omitempty"`
+	NewAccountsAvailable bool       `json:"new_accounts_available,omitempty"`
+	Products             []string   `json:"products"`
+	CreatedAt            time.Time  `json:"created_at"`
+	LastSyncedAt         *time.Time `json:"last_synced_at,omitempty"`
+	ConsentExpiresAt     *time.Time `json:"consent_expires_at,omitempty"`
+	CheckedAt            *time.Time `json:"checked_at,omitempty"`
+	// NeedsUpdate is set when the user has to reconnect the item with Link
+	// update mode.
+	NeedsUpdate bool `json:"needs_update"`
+}
+
+func summarizeItem(item *db.Item) itemSummary {
+	return itemSummary{
+		ItemID:               item.ID,
+		InstitutionID:        item.InstitutionID,
+		InstitutionName:      item.InstitutionName,
+		Nickname:             item.Nickname,
+		Status:               item.Status,
+		ErrorCode:            item.ErrorCode,
+		NewAccountsAvailable: item.NewAccountsAvailable,
+		NeedsUpdate:          needsUpdate(item),
+		Products:             item.Products,
+		CreatedAt:            item.CreatedAt,
+		LastSyncedAt:         item.LastSyncedAt,
+		ConsentExpiresAt:     item.ConsentExpiresAt,
+		CheckedAt:            item.CheckedAt,
+	}
+}
+
+// Items lists the items of the calling user, oldest first, with the name of
+// their institution and their status.
+func (s *Server) Items(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	user, err := s.requestUser(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	userItems, err := s.store.ListItems(user)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	sort.Slice(userItems, func(i, j int) bool {
+		if !userItems[i].CreatedAt.Equal(userItems[j].CreatedAt) {
+			return userItems[i].CreatedAt.Before(userItems[j].CreatedAt)
+		}
+		return userItems[i].ID < userItems[j].ID
+	})
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	res := []itemSummary{}
+	for _, item := range userItems {
+		res = append(res, summarizeItem(s.withInstitutionName(ctx, item)))
+	}
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{"items": res})
+}
+
+// withInstitutionName returns the item with the name of its institution,
+// fetched from Plaid and stored the first time. The item is returned as is
+// when the name can not be fetched, so lists still work while Plaid does
+// not.
+func (s *Server) withInstitutionName(ctx context.Context, item *db.Item) *db.Item {
+	if item.InstitutionName != "" || item.InstitutionID == "" {
+		return item
+	}
+	resp, _, err := s.client.PlaidApi.InstitutionsGetById(ctx).InstitutionsGetByIdRequest(
+		*plaid.NewInstitutionsGetByIdRequest(item.InstitutionID, convertCountryCodes(s.config.CountryCodes)),
+	).Execute()
+	if err != nil {
+		s.logger.Warn("error fetching institution", zap.String("institution_id", item.InstitutionID), zap.Error(err))
+		return item
+	}
+	name := resp.GetInstitution().Name
+	updated, err := s.store.UpdateItem(item.ID, func(item *db.Item) {
+		item.InstitutionName = name
+	})
+	if err != nil {
+		s.logger.Warn("error storing institution name", zap.String("item_id", item.ID), zap.Error(err))
+		return item
+	}
+	return updated
+}
+
+// RenameItem sets the nickname of the item of the "item_id" parameter to the
+// "nickname" parameter. An empty nickname removes it.
+func (s *Server) RenameItem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	if r.FormValue("item_id") == "" {
+		api.WriteError(w, errNoItemID)
+		return
+	}
+	nickname := strings.TrimSpace(r.FormValue("nickname"))
+	if utf8.RuneCountInString(nickname) > maxNicknameLength {
+		api.WriteError(w, api.BadRequest("INVALID_FIELD", "nickname is too long"))
+		return
+	}
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	updated, err := s.store.UpdateItem(item.ID, func(item *db.Item) {
+		item.Nickname = nickname
+	})
+	if err == db.ErrNotFound {
+		err = errItemNotFound
+	}
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, summarizeItem(updated))
+}
+
+// RemoveItem disconnects the item of the "item_id" parameter: the item is
+// removed at Plaid, which invalidates its access token, then its asset
+// reports are removed and the item is deleted with its transactions. The
+// removal is recorded as an audit event of the user.
+func (s *Server) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	if r.FormValue("item_id") == "" {
+		api.WriteError(w, errNoItemID)
+		return
+	}
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	if err := s.removeItemAtPlaid(ctx, item.token); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	jobs, err := s.userAssetReports(item.User, item.ID)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	removed := []string{}
+	for _, job := range jobs {
+		if err := s.removeAssetReport(ctx, job); err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		removed = append(removed, job.ID)
+	}
+	event, err := newAuditEvent(r, db.AuditItemRemoved, item.Item)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	err = s.store.DeleteItem(item.ID, event)
+	if err == db.ErrNotFound {
+		err = errItemNotFound
+	}
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	s.syncLocks.Delete(item.ID)
+	s.logger.Info("removed item", zap.String("item_id", item.ID), zap.String("user", item.User), zap.String("actor", event.Actor))
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"item_id":       item.ID,
+		"asset_reports": removed,
+	})
+}
+
+// RemoveUserItems removes every item of a user and its asset reports at
+// Plaid, before the user is deleted with its data.
+func (s *Server) RemoveUserItems(ctx context.Context, user string) error {
+	userItems, err := s.store.ListItems(user)
+	if err != nil {
+		return err
+	}
+	for _, item := range userItems {
+		token, err := s.store.Token(item)
+		if err != nil {
+			return err
+		}
+		if err := s.removeItemAtPlaid(ctx, token); err != nil {
+			return err
+		}
+		s.syncLocks.Delete(item.ID)
+		s.logger.Info("removed item", zap.String("item_id", item.ID), zap.String("user", user))
+	}
+	jobs, err := s.store.ListAssetReports(user)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := s.removeAssetReport(ctx, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeItemAtPlaid removes an item at Plaid, invalidating its access token.
+// An item Plaid no longer knows is taken as removed.
+func (s *Server) removeItemAtPlaid(ctx context.Context, accessToken string) error {
+	_, _, err := s.client.PlaidApi.ItemRemove(ctx).ItemRemoveRequest(
+		*plaid.NewItemRemoveRequest(accessToken),
+	).Execute()
+	if plaidErr, perr := plaid.ToPlaidError(err); err != nil && perr == nil &&
+		(plaidErr.ErrorCode == "INVALID_ACCESS_TOKEN" || plaidErr.ErrorCode == "ITEM_NOT_FOUND") {
+		return nil
+	}
+	return err
+}
+
+// newAuditEvent returns the audit event of an action on an item made by the
+// principal of the request.
+func newAuditEvent(r *http.Request, action string, item *db.Item) (*db.AuditEvent, error) {
+	id, err := db.NewAuditEventID()
+	if err != nil {
+		return nil, err
+	}
+	actor := item.User
+	if p := auth.PrincipalFrom(r.Context()); p != nil && p.APIKeyID != "" {
+		actor = "api_key:" + p.APIKeyID
+	}
+	return &db.AuditEvent{
+		ID:            id,
+		User:          item.User,
+		Actor:         actor,
+		Action:        action,
+		ItemID:        item.ID,
+		InstitutionID: item.InstitutionID,
+		CreatedAt:     time.Now(),
+	}, nil
+}
@@ -0,0 +1,166 @@
+package plaid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"github.com/uitachi123/go-plaid/pkg/plaidfake"
+)
+
+func Test_Items(t *testing.T) {
+	s, fake := newTestServer(t)
+	first := link(t, s, fake, "alice@test.com")
+	second := link(t, s, fake, "alice@test.com")
+
+	code, resp := do(t, s, "GET", "/api/items", url.Values{"user": {"alice@test.com"}})
+	if code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusOK, code, resp)
+	}
+	items := resp["items"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("Data mismatch, expected:  %v got: %v", 2, len(items))
+	}
+	item := items[0].(map[string]interface{})
+	if item["item_id"] != first || item["status"] != db.ItemStatusHealthy || item["institution_name"] == nil || item["access_token"] != nil {
+		t.Errorf("Unexpected item %v", item)
+	}
+	// institution names are only fetched once
+	calls := fake.Calls("/institutions/get_by_id")
+	do(t, s, "GET", "/api/items", url.Values{"user": {"alice@test.com"}})
+	if fake.Calls("/institutions/get_by_id") != calls {
+		t.Errorf("Data mismatch, expected:  %v got: %v", calls, fake.Calls("/institutions/get_by_id"))
+	}
+	if _, resp := do(t, s, "GET", "/api/items", url.Values{"user": {"bob@test.com"}}); len(resp["items"].([]interface{})) != 0 {
+		t.Errorf("Unexpected items of bob %v", resp)
+	}
+
+	code, resp = do(t, s, "POST", "/api/item/rename", url.Values{"user": {"alice@test.com"}, "item_id": {second}, "nickname": {" Joint checking "}})
+	if code != http.StatusOK || resp["nickname"] != "Joint checking" {
+		t.Errorf("Unexpected item %v %v", code, resp)
+	}
+	if item, _ := s.store.GetItem(second); item.Nickname != "Joint checking" {
+		t.Errorf("Data mismatch, expected:  %v got: %v", "Joint checking", item.Nickname)
+	}
+	code, resp = do(t, s, "POST", "/api/item/rename", url.Values{"user": {"alice@test.com"}, "item_id": {second}})
+	if code != http.StatusOK || resp["nickname"] != nil {
+		t.Errorf("Expected the nickname to be removed, got %v %v", code, resp)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		form     url.Values
+		expected int
+	}{
+		{"no item_id", url.Values{"user": {"alice@test.com"}, "nickname": {"Savings"}}, http.StatusBadRequest},
+		{"too long", url.Values{"user": {"alice@test.com"}, "item_id": {first}, "nickname": {strings.Repeat("a", 65)}}, http.StatusBadRequest},
+		{"other user", url.Values{"user": {"bob@test.com"}, "item_id": {first}, "nickname": {"Mine"}}, http.StatusNotFound},
+	} {
+		if code, resp := do(t, s, "POST", "/api/item/rename", tt.form); code != tt.expected {
+			t.Errorf("%s: Expected %v\tGot %v: %v", tt.name, tt.expected, code, resp)
+		}
+	}
+}
+
+func Test_RemoveItem(t *testing.T) {
+	s, fake := newTestServer(t)
+	removed := link(t, s, fake, "alice@test.com")
+	kept := link(t, s, fake, "alice@test.com")
+	alice := func(v url.Values) url.Values {
+		v.Set("user", "alice@test.com")
+		return v
+	}
+	do(t, s, "GET", "/api/transactions", alice(url.Values{"item_id": {removed}}))
+	do(t, s, "GET", "/api/transactions", alice(url.Values{"item_id": {kept}}))
+	code, resp := do(t, s, "POST", "/api/assets", alice(url.Values{"item_id": {removed}}))
+	if code != http.StatusAccepted {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusAccepted, code, resp)
+	}
+	jobID := resp["job_id"].(string)
+	waitForAssetReport(t, s, jobID)
+
+	if code, _ := do(t, s, "POST", "/api/item/remove", alice(url.Values{})); code != http.StatusBadRequest {
+		t.Errorf("Expected %v\tGot %v", http.StatusBadRequest, code)
+	}
+	if code, _ := do(t, s, "POST", "/api/item/remove", url.Values{"user": {"bob@test.com"}, "item_id": {removed}}); code != http.StatusNotFound {
+		t.Errorf("Expected %v\tGot %v", http.StatusNotFound, code)
+	}
+
+	code, resp = do(t, s, "POST", "/api/item/remove", alice(url.Values{"item_id": {removed}}))
+	if code != http.StatusOK || resp["item_id"] != removed {
+		t.Fatalf("Unexpected removal %v %v", code, resp)
+	}
+	if jobs := resp["asset_reports"].([]interface{}); len(jobs) != 1 || jobs[0] != jobID {
+		t.Errorf("Unexpected removed asset reports %v", jobs)
+	}
+	if fake.Calls("/item/remove") != 1 || fake.Calls("/asset_report/remove") != 1 {
+		t.Errorf("Expected the item and its report to be removed at Plaid, got %v and %v calls", fake.Calls("/item/remove"), fake.Calls("/asset_report/remove"))
+	}
+	if _, err := s.store.GetItem(removed); err != db.ErrNotFound {
+		t.Errorf("Expected %v, got %v", db.ErrNotFound, err)
+	}
+	if transactions, _ := s.store.ListTransactions(removed); len(transactions) != 0 {
+		t.Errorf("Expected the transactions to be deleted, got %v", len(transactions))
+	}
+	if transactions, _ := s.store.ListTransactions(kept); len(transactions) == 0 {
+		t.Errorf("Expected the transactions of the other item to be kept")
+	}
+	events, _ := s.store.ListAuditEvents("alice@test.com")
+	if len(events) != 1 || events[0].ItemID != removed || events[0].Action != db.AuditItemRemoved || events[0].Actor != "alice@test.com" {
+		t.Errorf("Unexpected audit events %v", events)
+	}
+	if code, _ := do(t, s, "POST", "/api/item/remove", alice(url.Values{"item_id": {removed}})); code != http.StatusNotFound {
+		t.Errorf("Expected %v\tGot %v", http.StatusNotFound, code)
+	}
+
+	// items already removed at Plaid are still deleted, and API keys are
+	// recorded as the actor
+	fake.FailNext("/item/remove", plaidfake.Error{ErrorType: "INVALID_INPUT", ErrorCode: "INVALID_ACCESS_TOKEN"})
+	key, _ := auth.GenerateAPIKey()
+	s.store.SaveAPIKey(&db.APIKey{ID: "key-1", User: "alice@test.com", Hash: auth.HashAPIKey(key), Scopes: []string{auth.ScopeItemsWrite}})
+	req := httptest.NewRequest("POST", "/api/item/remove", strings.NewReader(url.Values{"item_id": {kept}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+key)
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if events, _ := s.store.ListAuditEvents("alice@test.com"); len(events) != 2 || events[1].Actor != "api_key:key-1" {
+		t.Errorf("Unexpected audit events %v", events)
+	}
+}
+
+func Test_RemoveUserItems(t *testing.T) {
+	s, fake := newTestServer(t)
+	link(t, s, fake, "alice@test.com")
+	link(t, s, fake, "alice@test.com")
+	bobs := link(t, s, fake, "bob@test.com")
+	_, resp := do(t, s, "POST", "/api/assets", url.Values{"user": {"bob@test.com"}})
+	waitForAssetReport(t, s, resp["job_id"].(string))
+
+	if err := s.RemoveUserItems(context.Background(), "alice@test.com"); err != nil {
+		t.Fatalf("Error removing items: %v", err)
+	}
+	if fake.Calls("/item/remove") != 2 || fake.Calls("/asset_report/remove") != 0 {
+		t.Errorf("Expected the 2 items of alice to be removed at Plaid, got %v and %v calls", fake.Calls("/item/remove"), fake.Calls("/asset_report/remove"))
+	}
+	if err := s.RemoveUserItems(context.Background(), "bob@test.com"); err != nil {
+		t.Fatalf("Error removing items: %v", err)
+	}
+	if fake.Calls("/asset_report/remove") != 1 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 1, fake.Calls("/asset_report/remove"))
+	}
+	// removing again once the items are gone at Plaid succeeds
+	if err := s.RemoveUserItems(context.Background(), "bob@test.com"); err != nil {
+		t.Errorf("Error removing items again: %v", err)
+	}
+	if _, err := s.store.GetItem(bobs); err != nil {
+		t.Errorf("Expected the items to be deleted with the user only, got %v", err)
+	}
+}
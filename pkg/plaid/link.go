@@ -0,0 +1,150 @@
+package plaid
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"github.com/uitachi123/go-plaid/pkg/api"
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+// linkLanguages are the languages Link is displayed in.
+var linkLanguages = map[string]bool{
+	"da": true, "de": true, "en": true, "es": true, "et": true, "fr": true,
+	"it": true, "lt": true, "lv": true, "nl": true, "no": true, "pl": true,
+	"pt": true, "ro": true, "sv": true,
+}
+
+// linkTokenOptions customizes the Link flow opened with a link token. They
+// are read from the JSON body of /api/create_link_token, and anything left
+// out falls back to the configuration.
+type linkTokenOptions struct {
+	Products     []string `json:"products"`
+	CountryCodes []string `json:"country_codes"`
+	Language     string   `json:"language"`
+	// AccountFilters maps account types (depository, credit, loan and
+	// investment) to the subtypes shown in Link.
+	AccountFilters map[string][]string `json:"account_filters"`
+	RedirectURI    string              `json:"redirect_uri"`
+	// Webhook must be on the scheme and host of the configured webhook URL,
+	// so webhooks can not be sent to third parties.
+	Webhook string `json:"webhook"`
+
+	paymentInitiation *plaid.LinkTokenCreateRequestPaymentInitiation
+	// accessToken and update open Link in update mode for an item.
+	accessToken string
+	update      *plaid.LinkTokenCreateRequestUpdate
+}
+
+// requestLinkTokenOptions reads and validates the options of the request
+// body, which may be empty. webhookURL is the configured webhook URL.
+func requestLinkTokenOptions(r *http.Request, webhookURL string) (*linkTokenOptions, error) {
+	opts := &linkTokenOptions{}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(opts); err != nil && !errors.Is(err, io.EOF) {
+		return nil, api.BadRequest("INVALID_BODY", "request body must be JSON link token options: "+err.Error())
+	}
+	for _, p := range opts.Products {
+		if !plaid.Products(p).IsValid() {
+			return nil, api.BadRequest("INVALID_FIELD", fmt.Sprintf("unknown product %q", p))
+		}
+	}
+	for _, cc := range opts.CountryCodes {
+		if !plaid.CountryCode(cc).IsValid() {
+			return nil, api.BadRequest("INVALID_FIELD", fmt.Sprintf("unknown country code %q", cc))
+		}
+	}
+	if opts.Language != "" && !linkLanguages[opts.Language] {
+		return nil, api.BadRequest("INVALID_FIELD", fmt.Sprintf("unsupported language %q", opts.Language))
+	}
+	if _, err := opts.accountFilters(); err != nil {
+		return nil, err
+	}
+	for _, u := range []struct{ name, value string }{
+		{"redirect_uri", opts.RedirectURI},
+		{"webhook", opts.Webhook},
+	} {
+		if u.value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u.value); err != nil || !parsed.IsAbs() || parsed.Host == "" {
+			return nil, api.BadRequest("INVALID_FIELD", fmt.Sprintf("invalid %s %q", u.name, u.value))
+		}
+	}
+	if opts.Webhook != "" {
+		webhook, _ := url.Parse(opts.Webhook)
+		configured, err := url.Parse(webhookURL)
+		if webhookURL == "" || err != nil || webhook.Scheme != configured.Scheme || !strings.EqualFold(webhook.Host, configured.Host) {
+			return nil, api.BadRequest("INVALID_FIELD", fmt.Sprintf("webhook %q must be on the host of the configured webhook url", opts.Webhook))
+		}
+	}
+	return opts, nil
+}
+
+// accountFilters converts the account filters to Plaid ones, or returns nil
+// if there are none.
+func (o *linkTokenOptions) accountFilters() (*plaid.LinkTokenAccountFilters, error) {
+	if len(o.AccountFilters) == 0 {
+		return nil, nil
+	}
+	filters := plaid.NewLinkTokenAccountFilters()
+	for accountType, subtypes := range o.AccountFilters {
+		invalid := ""
+		switch accountType {
+		case "depository":
+			var res []plaid.DepositoryAccountSubtype
+			for _, v := range subtypes {
+				if res = append(res, plaid.DepositoryAccountSubtype(v)); !res[len(res)-1].IsValid() {
+					invalid = v
+				}
+			}
+			filters.SetDepository(*plaid.NewDepositoryFilter(res))
+		case "credit":
+			var res []plaid.CreditAccountSubtype
+			for _, v := range subtypes {
+				if res = append(res, plaid.CreditAccountSubtype(v)); !res[len(res)-1].IsValid() {
+					invalid = v
+				}
+			}
+			filters.SetCredit(*plaid.NewCreditFilter(res))
+		case "loan":
+			var res []plaid.LoanAccountSubtype
+			for _, v := range subtypes {
+				if res = append(res, plaid.LoanAccountSubtype(v)); !res[len(res)-1].IsValid() {
+					invalid = v
+				}
+			}
+			filters.SetLoan(*plaid.NewLoanFilter(res))
+		case "investment":
+			var res []plaid.InvestmentAccountSubtype
+			for _, v := range subtypes {
+				if res = append(res, plaid.InvestmentAccountSubtype(v)); !res[len(res)-1].IsValid() {
+					invalid = v
+				}
+			}
+			filters.SetInvestment(*plaid.NewInvestmentFilter(res))
+		default:
+			return nil, api.BadRequest("INVALID_FIELD", fmt.Sprintf("unknown account type %q", accountType))
+		}
+		if invalid != "" {
+			return nil, api.BadRequest("INVALID_FIELD", fmt.Sprintf("unknown %s account subtype %q", accountType, invalid))
+		}
+	}
+	return filters, nil
+}
+
+// clientUserID returns the id of a user given to Plaid. Plaid asks for a
+// stable id without personal information, so the email is hashed.
+func clientUserID(u *db.User) string {
+	sum := sha256.Sum256([]byte(u.Email))
+	return hex.EncodeToString(sum[:])
+}
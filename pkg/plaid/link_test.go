@@ -0,0 +1,84 @@
+package plaid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+func Test_CreateLinkToken(t *testing.T) {
+	s, fake := newTestServer(t, func(c *Config) {
+		c.WebhookURL = "https://app.test/api/webhook"
+	})
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/create_link_token", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(s.Sessions().Cookie("alice@test.com"))
+		w := httptest.NewRecorder()
+		s.Routes().ServeHTTP(w, req)
+		return w
+	}
+
+	// the configuration is used by default
+	if w := create(""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "link_token") {
+		t.Fatalf("Expected %v\tGot %v: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	sent := fake.LastRequest("/link/token/create")
+	user := sent["user"].(map[string]interface{})
+	if expected := clientUserID(&db.User{Email: "alice@test.com"}); user["client_user_id"] != expected {
+		t.Errorf("Data mismatch, expected:  %v got: %v", expected, user["client_user_id"])
+	}
+	if strings.Contains(user["client_user_id"].(string), "alice") {
+		t.Errorf("Expected no email in the client user id, got %v", user["client_user_id"])
+	}
+	if sent["language"] != "en" || !reflect.DeepEqual(sent["products"], []interface{}{"transactions", "auth"}) || sent["account_filters"] != nil {
+		t.Errorf("Unexpected request %v", sent)
+	}
+
+	w := create(`{
+		"products": ["auth", "identity"],
+		"country_codes": ["CA"],
+		"language": "fr",
+		"account_filters": {"depository": ["checking", "savings"]},
+		"redirect_uri": "https://app.test/oauth",
+		"webhook": "https://app.test/hooks"
+	}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	sent = fake.LastRequest("/link/token/create")
+	expected := map[string]interface{}{
+		"products":        []interface{}{"auth", "identity"},
+		"country_codes":   []interface{}{"CA"},
+		"language":        "fr",
+		"account_filters": map[string]interface{}{"depository": map[string]interface{}{"account_subtypes": []interface{}{"checking", "savings"}}},
+		"redirect_uri":    "https://app.test/oauth",
+		"webhook":         "https://app.test/hooks",
+	}
+	for k, v := range expected {
+		if !reflect.DeepEqual(v, sent[k]) {
+			t.Errorf("%s: Data mismatch, expected:  %v got: %v", k, v, sent[k])
+		}
+	}
+
+	for _, body := range []string{
+		`{"products": ["everything"]}`,
+		`{"country_codes": ["XX"]}`,
+		`{"language": "klingon"}`,
+		`{"account_filters": {"depository": ["credit card"]}}`,
+		`{"account_filters": {"crypto": ["wallet"]}}`,
+		`{"redirect_uri": "/oauth"}`,
+		`{"webhook": "https://attacker.test/hooks"}`,
+		`{"webhook": "http://app.test/hooks"}`,
+		`{"client_name": "Other"}`,
+		`not json`,
+	} {
+		if w := create(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: Expected %v\tGot %v: %s", body, http.StatusBadRequest, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package plaid
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/uitachi123/go-plaid/pkg/api"
+)
+
+const (
+	// oauthStateCookie holds the state binding the browser of a user to the
+	// link token it opened Link with, checked when the user comes back from
+	// the OAuth flow of an institution.
+	oauthStateCookie = "go_plaid_oauth_state"
+	// oauthStateTTL is how long a user has to go through the OAuth flow.
+	oauthStateTTL = 30 * time.Minute
+	// oauthUIPath is where users are sent back to resume Link.
+	oauthUIPath = "/"
+)
+
+var errInvalidOAuthState = api.NewError(http.StatusForbidden, "INVALID_REQUEST", "INVALID_OAUTH_STATE", "the OAuth redirect does not match a link token of this session")
+
+// pendingLink is a link token waiting for its user to come back from the
+// OAuth flow of an institution.
+type pendingLink struct {
+	state       string
+	linkToken   string
+	redirectURI string
+	expires     time.Time
+}
+
+// oauthLinks holds the pending link of each user.
+type oauthLinks struct {
+	mu    sync.Mutex
+	links map[string]pendingLink
+	now   func() time.Time
+}
+
+func newOAuthLinks() *oauthLinks {
+	return &oauthLinks{links: map[string]pendingLink{}, now: time.Now}
+}
+
+// start remembers the link token of a user and returns the state of its
+// OAuth flow, replacing any previous one.
+func (o *oauthLinks) start(user, linkToken, redirectURI string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.links[user] = pendingLink{
+		state:       state,
+		linkToken:   linkToken,
+		redirectURI: redirectURI,
+		expires:     o.now().Add(oauthStateTTL),
+	}
+	return state, nil
+}
+
+// get returns the pending link of a user if it has not expired and matches
+// the state of the request.
+func (o *oauthLinks) get(user string, r *http.Request) (pendingLink, error) {
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil {
+		return pendingLink{}, errInvalidOAuthState
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	link, ok := o.links[user]
+	if !ok || o.now().After(link.expires) || subtle.ConstantTimeCompare([]byte(link.state), []byte(cookie.Value)) != 1 {
+		return pendingLink{}, errInvalidOAuthState
+	}
+	return link, nil
+}
+
+// writeLinkToken answers with a link token created for user with opts. When
+// Link may redirect the user to an OAuth institution, the link token is
+// remembered and a state cookie set so OAuthRedirect can resume Link.
+func (s *Server) writeLinkToken(w http.ResponseWriter, r *http.Request, user, linkToken string, opts *linkTokenOptions) {
+	if redirectURI := s.linkRedirectURI(opts); redirectURI != "" {
+		state, err := s.oauth.start(user, linkToken, redirectURI)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     oauthStateCookie,
+			Value:    state,
+			Path:     "/api/oauth",
+			MaxAge:   int(oauthStateTTL / time.Second),
+			Secure:   r.TLS != nil,
+			HttpOnly: true,
+			// sent when the institution redirects the browser back
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"link_token": linkToken,
+	})
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	io.WriteString(w, string(b))
+}
+
+// OAuthRedirect is the redirect URI OAuth institutions send users back to,
+// with an "oauth_state_id" parameter. It checks the session and the state
+// cookie set with the link token, then redirects to the UI to resume Link.
+func (s *Server) OAuthRedirect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	oauthStateID := r.FormValue("oauth_state_id")
+	if oauthStateID == "" {
+		api.WriteError(w, api.BadRequest("MISSING_FIELDS", "oauth_state_id is required"))
+		return
+	}
+	user, err := s.requestUser(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	if _, err := s.oauth.get(user, r); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	http.Redirect(w, r, oauthUIPath+"?"+url.Values{"oauth_state_id": {oauthStateID}}.Encode(), http.StatusFound)
+}
+
+// OAuthLinkToken returns the link token to resume Link with after an OAuth
+// redirect, and the redirect URI Link was sent back to.
+func (s *Server) OAuthLinkToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	oauthStateID := r.FormValue("oauth_state_id")
+	if oauthStateID == "" {
+		api.WriteError(w, api.BadRequest("MISSING_FIELDS", "oauth_state_id is required"))
+		return
+	}
+	user, err := s.requestUser(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	link, err := s.oauth.get(user, r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	received, err := url.Parse(link.redirectURI)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	query := received.Query()
+	query.Set("oauth_state_id", oauthStateID)
+	received.RawQuery = query.Encode()
+	b, err := json.Marshal(map[string]interface{}{
+		"link_token":            link.linkToken,
+		"received_redirect_uri": received.String(),
+	})
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	io.WriteString(w, string(b))
+}
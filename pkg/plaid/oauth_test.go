@@ -0,0 +1,91 @@
+package plaid
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_OAuthRedirect(t *testing.T) {
+	s, _ := newTestServer(t, func(c *Config) {
+		c.RedirectURI = "https://app.test/api/oauth/redirect"
+	})
+	serve := func(method, path, user string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if user != "" {
+			req.AddCookie(s.Sessions().Cookie(user))
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.Routes().ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("POST", "/api/create_link_token", "alice@test.com")
+	var created map[string]string
+	json.Unmarshal(w.Body.Bytes(), &created)
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Name != oauthStateCookie || !cookies[0].HttpOnly {
+		t.Fatalf("Expected a state cookie, got %v %v", w.Code, cookies)
+	}
+	state := cookies[0]
+	wrongState := &http.Cookie{Name: oauthStateCookie, Value: "forged"}
+
+	tests := []struct {
+		path, user string
+		cookies    []*http.Cookie
+		code       int
+	}{
+		{"/api/oauth/redirect?oauth_state_id=oauth-1", "", []*http.Cookie{state}, http.StatusUnauthorized},
+		{"/api/oauth/redirect?oauth_state_id=oauth-1", "alice@test.com", nil, http.StatusForbidden},
+		{"/api/oauth/redirect?oauth_state_id=oauth-1", "alice@test.com", []*http.Cookie{wrongState}, http.StatusForbidden},
+		{"/api/oauth/redirect?oauth_state_id=oauth-1", "bob@test.com", []*http.Cookie{state}, http.StatusForbidden},
+		{"/api/oauth/redirect", "alice@test.com", []*http.Cookie{state}, http.StatusBadRequest},
+		{"/api/oauth/link_token?oauth_state_id=oauth-1", "alice@test.com", []*http.Cookie{wrongState}, http.StatusForbidden},
+		{"/api/oauth/redirect?oauth_state_id=oauth-1", "alice@test.com", []*http.Cookie{state}, http.StatusFound},
+		{"/api/oauth/link_token?oauth_state_id=oauth-1", "alice@test.com", []*http.Cookie{state}, http.StatusOK},
+	}
+	for _, test := range tests {
+		if w := serve("GET", test.path, test.user, test.cookies...); w.Code != test.code {
+			t.Errorf("%s as %s: Expected %v\tGot %v: %s", test.path, test.user, test.code, w.Code, w.Body.String())
+		}
+	}
+
+	w = serve("GET", "/api/oauth/redirect?oauth_state_id=oauth-1", "alice@test.com", state)
+	if location := w.Header().Get("Location"); location != "/?oauth_state_id=oauth-1" {
+		t.Errorf("Data mismatch, expected:  %v got: %v", "/?oauth_state_id=oauth-1", location)
+	}
+	w = serve("GET", "/api/oauth/link_token?oauth_state_id=oauth-1", "alice@test.com", state)
+	var resumed map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resumed)
+	expected := map[string]string{
+		"link_token":            created["link_token"],
+		"received_redirect_uri": "https://app.test/api/oauth/redirect?oauth_state_id=oauth-1",
+	}
+	for k, v := range expected {
+		if resumed[k] != v {
+			t.Errorf("%s: Data mismatch, expected:  %v got: %v", k, v, resumed[k])
+		}
+	}
+
+	// states expire
+	s.oauth.now = func() time.Time { return time.Now().Add(oauthStateTTL + time.Minute) }
+	if w := serve("GET", "/api/oauth/redirect?oauth_state_id=oauth-1", "alice@test.com", state); w.Code != http.StatusForbidden {
+		t.Errorf("Expected %v\tGot %v", http.StatusForbidden, w.Code)
+	}
+}
+
+func Test_OAuthRedirectNotConfigured(t *testing.T) {
+	s, _ := newTestServer(t)
+	req := httptest.NewRequest("POST", "/api/create_link_token", nil)
+	req.AddCookie(s.Sessions().Cookie("alice@test.com"))
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected no state cookie without a redirect URI, got %v %v", w.Code, w.Result().Cookies())
+	}
+}
@@ -0,0 +1,176 @@
+package plaid
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy configures how a Plaid endpoint is retried on retryable
+// errors. Delays grow exponentially from BaseDelay up to MaxDelay, with
+// jitter. Delays are durations such as 500ms.
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls made at most, 1 disabling retries.
+	MaxAttempts int      `json:"max_attempts" yaml:"max_attempts"`
+	BaseDelay   Duration `json:"base_delay" yaml:"base_delay"`
+	MaxDelay    Duration `json:"max_delay" yaml:"max_delay"`
+}
+
+// defaultRetryPolicy applies to endpoints without a policy, and fills the
+// fields left unset in configured policies.
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   Duration(200 * time.Millisecond),
+	MaxDelay:    Duration(2 * time.Second),
+}
+
+// retryableErrorCodes are the Plaid error codes worth calling again for.
+// Rate limits are retried by their RATE_LIMIT_EXCEEDED error type, as their
+// codes name the limit hit, e.g. ACCOUNTS_LIMIT.
+var retryableErrorCodes = map[string]bool{
+	"INTERNAL_SERVER_ERROR": true,
+	"PRODUCT_NOT_READY":     true,
+}
+
+// polledPaths are the Plaid endpoints polled by the server until their
+// report is ready. Their PRODUCT_NOT_READY errors are left to the poller
+// instead of being retried.
+var polledPaths = map[string]bool{
+	"/asset_report/get":     true,
+	"/asset_report/pdf/get": true,
+}
+
+// nonIdempotentPaths are the Plaid endpoints that are never retried, whatever
+// their configured policy: a call that failed on a network error or a Plaid
+// INTERNAL_SERVER_ERROR may still have moved money or consumed the public
+// token, and calling again would do it twice.
+var nonIdempotentPaths = map[string]bool{
+	"/transfer/authorization/create":       true,
+	"/transfer/create":                     true,
+	"/payment_initiation/recipient/create": true,
+	"/payment_initiation/payment/create":   true,
+	"/item/public_token/exchange":          true,
+}
+
+// retryPolicy returns the policy of the endpoint at path, falling back on the
+// "default" policy then on defaultRetryPolicy for unset fields. Endpoints in
+// nonIdempotentPaths get a single attempt.
+func (c *Config) retryPolicy(path string) RetryPolicy {
+	p := c.Retry[path]
+	for _, fallback := range []RetryPolicy{c.Retry["default"], defaultRetryPolicy} {
+		if p.MaxAttempts == 0 {
+			p.MaxAttempts = fallback.MaxAttempts
+		}
+		if p.BaseDelay == 0 {
+			p.BaseDelay = fallback.BaseDelay
+		}
+		if p.MaxDelay == 0 {
+			p.MaxDelay = fallback.MaxDelay
+		}
+	}
+	if nonIdempotentPaths[path] {
+		p.MaxAttempts = 1
+	}
+	return p
+}
+
+// delay returns how long to wait before the attempt following attempt,
+// counted from 1: half of the capped exponential delay plus a random part of
+// the other half.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d, max := time.Duration(p.BaseDelay), time.Duration(p.MaxDelay)
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryTransport retries the requests sent through next on network errors
+// and retryable Plaid errors, following the policy of each endpoint. It gives
+// up early rather than sleeping past the deadline of the request context.
+type retryTransport struct {
+	config *Config
+	next   http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := t.config.retryPolicy(req.URL.Path)
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 {
+			attemptReq = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptReq.Body = body
+			}
+		}
+		resp, err := t.next.RoundTrip(attemptReq)
+		retryable := err != nil && ctx.Err() == nil
+		if err == nil {
+			if retryable, err = retryableResponse(resp, req.URL.Path); err != nil {
+				return nil, err
+			}
+		}
+		if !retryable || attempt >= policy.MaxAttempts || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		delay := policy.delay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// retryableResponse tells whether resp, the response of the endpoint at
+// path, holds a rate limit or a retryable Plaid error, or a server error
+// without a Plaid error code. The body of error responses is read and
+// replaced so the caller can still read it.
+func retryableResponse(resp *http.Response, path string) (bool, error) {
+	if resp.StatusCode < http.StatusBadRequest {
+		return false, nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	var plaidErr struct {
+		ErrorType string `json:"error_type"`
+		ErrorCode string `json:"error_code"`
+	}
+	if json.Unmarshal(body, &plaidErr) != nil || plaidErr.ErrorCode == "" {
+		return resp.StatusCode >= http.StatusInternalServerError, nil
+	}
+	if plaidErr.ErrorCode == "PRODUCT_NOT_READY" && polledPaths[path] {
+		return false, nil
+	}
+	return plaidErr.ErrorType == "RATE_LIMIT_EXCEEDED" || retryableErrorCodes[plaidErr.ErrorCode], nil
+}
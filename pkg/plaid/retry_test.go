@@ -0,0 +1,128 @@
+package plaid
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_RetryPolicy(t *testing.T) {
+	c := &Config{Retry: map[string]RetryPolicy{
+		"default":           {MaxAttempts: 5},
+		"/asset_report/get": {BaseDelay: Duration(time.Second)},
+		"/transfer/create":  {MaxAttempts: 3},
+	}}
+	expected := RetryPolicy{MaxAttempts: 5, BaseDelay: Duration(time.Second), MaxDelay: defaultRetryPolicy.MaxDelay}
+	if p := c.retryPolicy("/asset_report/get"); p != expected {
+		t.Errorf("Data mismatch, expected:  %+v got: %+v", expected, p)
+	}
+	if p := (&Config{}).retryPolicy("/item/get"); p != defaultRetryPolicy {
+		t.Errorf("Data mismatch, expected:  %+v got: %+v", defaultRetryPolicy, p)
+	}
+	for _, path := range []string{"/transfer/create", "/item/public_token/exchange"} {
+		if p := c.retryPolicy(path); p.MaxAttempts != 1 {
+			t.Errorf("Expected %v not to be retried, got %+v", path, p)
+		}
+	}
+
+	p := RetryPolicy{BaseDelay: Duration(100 * time.Millisecond), MaxDelay: Duration(time.Second)}
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := p.delay(attempt); d < max/2 || d > max {
+				t.Errorf("Expected the delay of attempt %v in [%v, %v], got %v", attempt, max/2, max, d)
+			}
+		}
+	}
+}
+
+func Test_RetryTransport(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"access_token":"token"}` {
+			t.Errorf("Unexpected body %s", body)
+		}
+		n := atomic.AddInt32(&calls, 1)
+		switch {
+		case r.URL.Path == "/item/get" && n < 3:
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"error_type":"RATE_LIMIT_EXCEEDED","error_code":"ACCOUNTS_LIMIT"}`)
+		case r.URL.Path == "/transactions/sync" && n < 2:
+			// rate limits are retried by their type whatever the status
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error_type":"RATE_LIMIT_EXCEEDED","error_code":"TRANSACTIONS_SYNC_LIMIT"}`)
+		case r.URL.Path == "/slow" || r.URL.Path == "/transfer/create":
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error_type":"API_ERROR","error_code":"INTERNAL_SERVER_ERROR"}`)
+		case r.URL.Path == "/asset_report/get" || r.URL.Path == "/transactions/get":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error_type":"ASSET_REPORT_ERROR","error_code":"PRODUCT_NOT_READY"}`)
+		case r.URL.Path == "/gateway":
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/accounts/get":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error_type":"ITEM_ERROR","error_code":"ITEM_LOGIN_REQUIRED"}`)
+		default:
+			io.WriteString(w, `{}`)
+		}
+	}))
+	defer server.Close()
+	c := &Config{Retry: map[string]RetryPolicy{
+		"default": {MaxAttempts: 3, BaseDelay: Duration(time.Millisecond), MaxDelay: Duration(5 * time.Millisecond)},
+		"/slow":   {MaxAttempts: 3, BaseDelay: Duration(time.Hour), MaxDelay: Duration(time.Hour)},
+	}}
+	client := &http.Client{Transport: &retryTransport{config: c, next: http.DefaultTransport}}
+	post := func(ctx context.Context, path string) (*http.Response, error) {
+		req, _ := http.NewRequestWithContext(ctx, "POST", server.URL+path, strings.NewReader(`{"access_token":"token"}`))
+		return client.Do(req)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		calls  int32
+	}{
+		{"/item/get", http.StatusOK, 3},
+		{"/transactions/sync", http.StatusOK, 2},
+		{"/gateway", http.StatusBadGateway, 3},
+		{"/accounts/get", http.StatusBadRequest, 1},
+		{"/transfer/create", http.StatusInternalServerError, 1},
+		// asset reports are polled until ready instead
+		{"/asset_report/get", http.StatusBadRequest, 1},
+		{"/transactions/get", http.StatusBadRequest, 3},
+	}
+	for _, test := range tests {
+		atomic.StoreInt32(&calls, 0)
+		resp, err := post(context.Background(), test.path)
+		if err != nil {
+			t.Fatalf("error calling %v: %v", test.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != test.status || atomic.LoadInt32(&calls) != test.calls {
+			t.Errorf("Expected %v after %v calls of %v\tGot %v after %v calls", test.status, test.calls, test.path, resp.StatusCode, calls)
+		}
+		if test.path == "/accounts/get" && !strings.Contains(string(body), "ITEM_LOGIN_REQUIRED") {
+			t.Errorf("Expected the error body to be readable, got %s", body)
+		}
+	}
+
+	// a retry that would outlive the deadline is not attempted
+	atomic.StoreInt32(&calls, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	resp, err := post(ctx, "/slow")
+	if err != nil {
+		t.Fatalf("error calling /slow: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || atomic.LoadInt32(&calls) != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected a single call, got %v calls in %v", calls, time.Since(start))
+	}
+}
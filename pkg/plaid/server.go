@@ -1,33 +1,27 @@
 package plaid
 
 import (
-	"bufio"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
-	"sort"
-	"strings"
+	"strconv"
+	"sync"
 	"time"
 
 	plaid "github.com/plaid/plaid-go/v3/plaid"
-)
-
-var (
-	PLAID_CLIENT_ID                      = ""
-	PLAID_SECRET                         = ""
-	PLAID_ENV                            = ""
-	PLAID_PRODUCTS                       = ""
-	PLAID_COUNTRY_CODES                  = ""
-	PLAID_REDIRECT_URI                   = ""
-	APP_PORT                             = ""
-	client              *plaid.APIClient = nil
+	"github.com/uitachi123/go-plaid/pkg/api"
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"github.com/uitachi123/go-plaid/pkg/logging"
+	"github.com/uitachi123/go-plaid/pkg/metrics"
+	"github.com/uitachi123/go-plaid/pkg/webhook"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var environments = map[string]plaid.Environment{
@@ -36,103 +30,343 @@ var environments = map[string]plaid.Environment{
 	"production":  plaid.Production,
 }
 
-func init() {
-	// set constants from env
-	PLAID_CLIENT_ID = os.Getenv("PLAID_CLIENT_ID")
-	PLAID_SECRET = os.Getenv("PLAID_SECRET")
+// Server serves the Plaid endpoints of the app. Everything a server needs is
+// held here, so several configured servers can run in one process.
+type Server struct {
+	config  *Config
+	client  *plaid.APIClient
+	store   *db.Store
+	logger  *zap.Logger
+	metrics *metrics.Metrics
+	items   *registry
+
+	// ctx is the root context of the work done by the server. Close cancels
+	// it, stopping transaction syncs, asset report polling and item checks.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	verifier *webhook.Verifier
+	// webhooks counts the webhooks being handled in the background.
+	webhooks sync.WaitGroup
+	sessions *auth.Sessions
+	auth     *api.Authenticator
+	// oauth holds the link tokens of users going through the OAuth flow of
+	// an institution.
+	oauth *oauthLinks
+	// syncLocks serializes transaction syncs per item_id so two syncs never
+	// apply pages from the same cursor.
+	syncLocks sync.Map
+	// assetReports serializes updates of asset report jobs, which are made
+	// by handlers, pollers and webhooks concurrently.
+	assetReports sync.Mutex
+	// assetReportFallback is how often jobs whose report is delivered by
+	// webhook are polled anyway, in case the webhook is lost.
+	assetReportFallback time.Duration
+	// transferEvents remembers the last transfer event seen so each
+	// TRANSFER_EVENTS_UPDATE webhook only syncs new events.
+	transferEvents struct {
+		sync.Mutex
+		afterID int32
+	}
+}
 
-	if PLAID_CLIENT_ID == "" || PLAID_SECRET == "" {
-		log.Fatal("Error: PLAID_SECRET or PLAID_CLIENT_ID is not set. Did you set it in env vars?")
+// NewServer validates c and creates a server using store for users, items
+// and transactions. It sets up encryption of access tokens at rest and, if
+// configured, persistence of the store. logger is expected to redact
+// c.Secrets() with a logging.Redactor, as Plaid API calls are logged at debug
+// level. Plaid API calls, transaction syncs and asset report polls are
+// recorded in m.
+func NewServer(c *Config, store *db.Store, logger *zap.Logger, m *metrics.Metrics) (*Server, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
 	}
-	PLAID_ENV = os.Getenv("PLAID_ENV")
-	PLAID_PRODUCTS = os.Getenv("PLAID_PRODUCTS")
-	PLAID_COUNTRY_CODES = os.Getenv("PLAID_COUNTRY_CODES")
-	PLAID_REDIRECT_URI = os.Getenv("PLAID_REDIRECT_URI")
-	APP_PORT = os.Getenv("APP_PORT")
+	s := &Server{
+		config:  c,
+		client:  newClient(c, logger, m),
+		store:   store,
+		logger:  logger,
+		metrics: m,
+		items:   newRegistry(store),
+		oauth:   newOAuthLinks(),
+
+		assetReportFallback: defaultAssetReportFallback,
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.verifier = webhook.NewVerifier(s.fetchVerificationKey)
 
-	// set defaults
-	if PLAID_PRODUCTS == "" {
-		PLAID_PRODUCTS = "transactions"
+	// set up encryption of access tokens at rest and load stored items
+	keyring, err := s.loadKeyring()
+	if err != nil {
+		return nil, err
 	}
-	if PLAID_COUNTRY_CODES == "" {
-		PLAID_COUNTRY_CODES = "US"
+	store.UseKeyring(keyring)
+	if s.sessions, err = s.loadSessions(); err != nil {
+		return nil, err
 	}
-	if PLAID_ENV == "" {
-		PLAID_ENV = "sandbox"
+	s.auth = api.NewAuthenticator(s.sessions, store, c.Admins)
+	if c.DBFile != "" {
+		if err := store.Persist(c.DBFile); err != nil {
+			return nil, err
+		}
+		// re-encrypt tokens sealed with a key that was rotated out
+		if _, err := store.ReencryptItems(); err != nil {
+			return nil, err
+		}
+		if _, err := store.ReencryptAssetReports(); err != nil {
+			return nil, err
+		}
 	}
-	if APP_PORT == "" {
-		APP_PORT = "8080"
+	if err := s.resumeAssetReports(); err != nil {
+		return nil, err
 	}
-	if PLAID_CLIENT_ID == "" {
-		log.Fatal("PLAID_CLIENT_ID is not set. Make sure to fill out the .env file")
+	if c.ItemCheckInterval > 0 {
+		go s.checkItemsEvery(time.Duration(c.ItemCheckInterval))
 	}
-	if PLAID_SECRET == "" {
-		log.Fatal("PLAID_SECRET is not set. Make sure to fill out the .env file")
+	return s, nil
+}
+
+// Sessions returns the sessions authenticating the users of the server.
+func (s *Server) Sessions() *auth.Sessions {
+	return s.sessions
+}
+
+// Authenticator returns the authenticator of the sessions and API keys of
+// the users of the server.
+func (s *Server) Authenticator() *api.Authenticator {
+	return s.auth
+}
+
+// Close cancels the work still running on the server. Handlers in flight
+// fail with context.Canceled.
+func (s *Server) Close() {
+	s.cancel()
+}
+
+// requestContext returns the context of the Plaid calls made for r. It is
+// cancelled when the request ends or the server is closed.
+func (s *Server) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// Routes returns the handler serving the endpoints under /api/. Every
+// endpoint but logging in and out and the Plaid webhook requires the session
+// or an API key of a user, with the scope of the endpoint, and only serves
+// the items of that user.
+func (s *Server) Routes() http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern, scope string, h http.HandlerFunc) {
+		mux.Handle(pattern, s.auth.Require(scope, h))
 	}
+	mux.HandleFunc("/api/login", api.Login(s.sessions, s.store))
+	mux.HandleFunc("/api/logout", api.Logout(s.sessions))
+	mux.HandleFunc("/api/webhook", s.Webhook)
+	handle("/api/set_access_token", auth.ScopeItemsWrite, s.GetAccessToken)
+	handle("/api/create_link_token_for_payment", auth.ScopePaymentWrite, s.CreateLinkTokenForPayment)
+	handle("/api/auth", auth.ScopeAccountsRead, s.Auth)
+	handle("/api/accounts", auth.ScopeAccountsRead, s.Accounts)
+	handle("/api/balance", auth.ScopeAccountsRead, s.Balance)
+	handle("/api/item", auth.ScopeAccountsRead, s.Item)
+	handle("/api/items", auth.ScopeAccountsRead, s.Items)
+	handle("/api/items/health", auth.ScopeAccountsRead, s.ItemsHealth)
+	handle("/api/item/rename", auth.ScopeItemsWrite, s.RenameItem)
+	handle("/api/item/remove", auth.ScopeItemsWrite, s.RemoveItem)
+	handle("/api/item/update", auth.ScopeItemsWrite, s.CreateUpdateLinkToken)
+	handle("/api/item/update/complete", auth.ScopeItemsWrite, s.CompleteUpdate)
+	handle("/api/oauth/redirect", auth.ScopeItemsWrite, s.OAuthRedirect)
+	handle("/api/oauth/link_token", auth.ScopeItemsWrite, s.OAuthLinkToken)
+	handle("/api/identity", auth.ScopeAccountsRead, s.Identity)
+	handle("/api/transactions", auth.ScopeTransactionsRead, s.Transactions)
+	handle("/api/transactions/export", auth.ScopeTransactionsRead, s.ExportTransactions)
+	handle("/api/transactions/ledger", auth.ScopeTransactionsRead, s.ExportLedger)
+	handle("/api/payment", auth.ScopePaymentRead, s.Payment)
+	handle("/api/create_public_token", auth.ScopeItemsWrite, s.CreatePublicToken)
+	handle("/api/create_link_token", auth.ScopeItemsWrite, s.CreateLinkToken)
+	handle("/api/investments_transactions", auth.ScopeAccountsRead, s.InvestmentTransactions)
+	handle("/api/holdings", auth.ScopeAccountsRead, s.Holdings)
+	// asset report jobs are listed with GET and started with POST
+	mux.Handle("/api/assets", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := auth.ScopeAssetsWrite
+		if r.Method == "GET" {
+			scope = auth.ScopeAssetsRead
+		}
+		s.auth.Require(scope, http.HandlerFunc(s.Assets)).ServeHTTP(w, r)
+	}))
+	handle("/api/assets/report", auth.ScopeAssetsRead, s.AssetReportJSON)
+	handle("/api/assets/pdf", auth.ScopeAssetsRead, s.AssetReportPDF)
+	handle("/api/assets/refresh", auth.ScopeAssetsWrite, s.RefreshAssetReport)
+	handle("/api/assets/filter", auth.ScopeAssetsWrite, s.FilterAssetReport)
+	handle("/api/assets/audit_copy", auth.ScopeAssetsWrite, s.CreateAuditCopy)
+	handle("/api/assets/audit_copy/remove", auth.ScopeAssetsWrite, s.RemoveAuditCopy)
+	handle("/api/assets/remove", auth.ScopeAssetsWrite, s.RemoveAssetReports)
+	handle("/api/transfer", auth.ScopeTransferRead, s.Transfer)
+	handle("/api/info", auth.ScopeAccountsRead, s.Info)
+	return mux
+}
 
-	// create Plaid client
+// newClient creates a Plaid client for the configured environment, or for
+// the API URL when it is set. Calls are retried following the retry policies
+// of c and recorded in m, and requests and responses are logged when logger
+// is at debug level.
+func newClient(c *Config, logger *zap.Logger, m *metrics.Metrics) *plaid.APIClient {
 	configuration := plaid.NewConfiguration()
-	configuration.AddDefaultHeader("PLAID-CLIENT-ID", PLAID_CLIENT_ID)
-	configuration.AddDefaultHeader("PLAID-SECRET", PLAID_SECRET)
-	configuration.UseEnvironment(environments[PLAID_ENV])
-	configuration.Debug = true
-	client = plaid.NewAPIClient(configuration)
+	configuration.AddDefaultHeader("PLAID-CLIENT-ID", c.ClientID)
+	configuration.AddDefaultHeader("PLAID-SECRET", c.Secret)
+	configuration.UseEnvironment(environments[c.Env])
+	if c.APIURL != "" {
+		configuration.Servers = plaid.ServerConfigurations{{URL: c.APIURL}}
+	}
+	// every attempt of a call is logged and recorded
+	transport := http.DefaultTransport
+	if logger.Core().Enabled(zapcore.DebugLevel) {
+		transport = logging.Transport(logger.Named("plaid"), transport)
+	}
+	transport = &retryTransport{config: c, next: m.Transport(transport)}
+	configuration.HTTPClient = &http.Client{Transport: transport}
+	return plaid.NewAPIClient(configuration)
 }
 
-// We store the access_token in memory - in production, store it in a secure
-// persistent data store.
-var accessToken string
-var itemID string
-
-var paymentID string
+// loadKeyring loads the keys encrypting access tokens from the TokenKey or
+// TokenKeyFile configuration. Keys are base64 encoded, and the first one is
+// used for new tokens, so a key is rotated by putting a new key in front of
+// it.
+func (s *Server) loadKeyring() (*db.Keyring, error) {
+	c := s.config
+	raw := c.TokenKey
+	if c.TokenKeyFile != "" {
+		b, err := os.ReadFile(c.TokenKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		raw = string(b)
+	}
+	keys, err := db.ParseKeys(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		if c.DBFile != "" {
+			return nil, errors.New("PLAID_TOKEN_KEY or PLAID_TOKEN_KEY_FILE must be set to persist items")
+		}
+		s.logger.Warn("PLAID_TOKEN_KEY is not set, access tokens are encrypted with a temporary key")
+		key, err := db.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return db.NewKeyring(keys...)
+}
 
-// The transfer_id is only relevant for the Transfer ACH product.
-// We store the transfer_id in memory - in production, store it in a secure
-// persistent data store
-var transferID string
+// loadSessions sets up session cookies signed with the SessionKey
+// configuration, or with a temporary key if it is not set.
+func (s *Server) loadSessions() (*auth.Sessions, error) {
+	key, err := base64.StdEncoding.DecodeString(s.config.SessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		s.logger.Warn("PLAID_SESSION_KEY is not set, sessions are signed with a temporary key")
+		if key, err = auth.GenerateKey(); err != nil {
+			return nil, err
+		}
+	}
+	return auth.NewSessions(key, time.Duration(s.config.SessionTTL)), nil
+}
 
-func GetAccessToken(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetAccessToken(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		io.WriteString(w, "Method not supported")
+		api.WriteError(w, api.MethodNotAllowed)
 		return
 	}
 	err := r.ParseForm()
 	if err != nil {
-		io.WriteString(w, "Failed to parse POST form")
+		api.WriteError(w, api.BadRequest("INVALID_BODY", "Failed to parse POST form"))
 		return
 	}
 	publicToken := r.PostForm.Get("public_token")
 	if publicToken == "" {
-		io.WriteString(w, "Cant find public token")
+		api.WriteError(w, api.BadRequest("MISSING_FIELDS", "public_token is required"))
 		return
 	}
-	ctx := context.Background()
+	user, err := s.requestUser(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
 
 	// exchange the public_token for an access_token
-	exchangePublicTokenResp, _, err := client.PlaidApi.ItemPublicTokenExchange(ctx).ItemPublicTokenExchangeRequest(
+	exchangePublicTokenResp, _, err := s.client.PlaidApi.ItemPublicTokenExchange(ctx).ItemPublicTokenExchangeRequest(
 		*plaid.NewItemPublicTokenExchangeRequest(publicToken),
 	).Execute()
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
-	accessToken = exchangePublicTokenResp.GetAccessToken()
-	itemID = exchangePublicTokenResp.GetItemId()
-	if itemExists(strings.Split(PLAID_PRODUCTS, ","), "transfer") {
-		transferID, err = authorizeAndCreateTransfer(ctx, client, accessToken)
+	accessToken := exchangePublicTokenResp.GetAccessToken()
+	item := &db.Item{
+		ID:        exchangePublicTokenResp.GetItemId(),
+		User:      user,
+		CreatedAt: time.Now(),
+		Status:    db.ItemStatusHealthy,
+		PaymentID: s.items.takePayment(user),
+	}
+	// the products of the item are those Link was opened with, which may
+	// differ from the configured ones
+	itemGetResp, _, err := s.client.PlaidApi.ItemGet(ctx).ItemGetRequest(
+		*plaid.NewItemGetRequest(accessToken),
+	).Execute()
+	if err == nil {
+		item.Products = itemProducts(itemGetResp.GetItem())
+		if institutionID := itemGetResp.GetItem().InstitutionId.Get(); institutionID != nil {
+			item.InstitutionID = *institutionID
+		}
+	} else {
+		// without its products no transfer is created for the item
+		s.logger.Warn("error getting linked item, its products are set by the next item check", zap.String("item_id", item.ID), zap.Error(err))
+	}
+	// linking an item with the Transfer product creates a transfer, which
+	// the caller must be allowed to do; the item is removed otherwise
+	if itemExists(item.Products, "transfer") {
+		if err := api.CheckScope(r, auth.ScopeTransferWrite); err != nil {
+			if rerr := s.removeItemAtPlaid(ctx, accessToken); rerr != nil {
+				s.logger.Warn("error removing item linked without transfer scope", zap.String("item_id", item.ID), zap.Error(rerr))
+			}
+			api.WriteError(w, err)
+			return
+		}
+		if item.TransferID, err = s.authorizeAndCreateTransfer(ctx, accessToken, requestAccountIDs(r)); err != nil {
+			s.logger.Warn("error creating transfer", zap.String("item_id", item.ID), zap.Error(err))
+			item.TransferErrorCode = api.ToError(err).ErrorCode
+		}
+	}
+	if err := s.items.put(item, accessToken); err != nil {
+		api.WriteError(w, err)
+		return
 	}
 
-	fmt.Println("public token: " + publicToken)
-	fmt.Println("access token: " + accessToken)
-	fmt.Println("item ID: " + itemID)
+	s.logger.Info("linked item", zap.String("item_id", item.ID), zap.String("user", user))
 
-	b, err := json.Marshal(map[string]interface{}{
-		"access_token": accessToken,
-		"item_id":      itemID,
-	})
+	// the access token stays on the server
+	res := map[string]interface{}{
+		"item_id": item.ID,
+	}
+	if item.TransferErrorCode != "" {
+		res["transfer_error_code"] = item.TransferErrorCode
+	}
+	b, err := json.Marshal(res)
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
@@ -142,12 +376,18 @@ func GetAccessToken(w http.ResponseWriter, r *http.Request) {
 // Creates a link token configured for payment initiation. The payment
 // information will be associated with the link token, and will not have to be
 // passed in again when we initialize Plaid Link.
-func CreateLinkTokenForPayment(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreateLinkTokenForPayment(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		io.WriteString(w, "Method not supported")
+		api.WriteError(w, api.MethodNotAllowed)
 		return
 	}
-	ctx := context.Background()
+	user, err := s.requestUser(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
 
 	// Create payment recipient
 	paymentRecipientRequest := plaid.NewPaymentInitiationRecipientCreateRequest("Harry Potter")
@@ -158,9 +398,9 @@ func CreateLinkTokenForPayment(w http.ResponseWriter, r *http.Request) {
 		"11111",
 		"GB",
 	))
-	paymentRecipientCreateResp, _, err := client.PlaidApi.PaymentInitiationRecipientCreate(ctx).PaymentInitiationRecipientCreateRequest(*paymentRecipientRequest).Execute()
+	paymentRecipientCreateResp, _, err := s.client.PlaidApi.PaymentInitiationRecipientCreate(ctx).PaymentInitiationRecipientCreateRequest(*paymentRecipientRequest).Execute()
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
@@ -170,41 +410,46 @@ func CreateLinkTokenForPayment(w http.ResponseWriter, r *http.Request) {
 		"paymentRef",
 		*plaid.NewPaymentAmount("GBP", 1.34),
 	)
-	paymentCreateResp, _, err := client.PlaidApi.PaymentInitiationPaymentCreate(ctx).PaymentInitiationPaymentCreateRequest(*paymentCreateRequest).Execute()
+	paymentCreateResp, _, err := s.client.PlaidApi.PaymentInitiationPaymentCreate(ctx).PaymentInitiationPaymentCreateRequest(*paymentCreateRequest).Execute()
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
-	paymentID = paymentCreateResp.GetPaymentId()
-	fmt.Println("payment id: " + paymentID)
+	paymentID := paymentCreateResp.GetPaymentId()
+	s.items.setPayment(user, paymentID)
+	s.logger.Info("created payment", zap.String("payment_id", paymentID))
 
-	linkTokenCreateReqPaymentInitiation := plaid.NewLinkTokenCreateRequestPaymentInitiation(paymentID)
-	linkToken, err := linkTokenCreate(linkTokenCreateReqPaymentInitiation)
+	opts := &linkTokenOptions{
+		paymentInitiation: plaid.NewLinkTokenCreateRequestPaymentInitiation(paymentID),
+	}
+	linkToken, err := s.linkTokenCreate(ctx, user, opts)
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
+	s.writeLinkToken(w, r, user, linkToken, opts)
+}
 
-	b, err := json.Marshal(map[string]interface{}{
-		"link_token": linkToken,
-	})
+func (s *Server) Auth(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
-	io.WriteString(w, string(b))
-}
-
-func Auth(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	authGetResp, _, err := client.PlaidApi.AuthGet(ctx).AuthGetRequest(
-		*plaid.NewAuthGetRequest(accessToken),
-	).Execute()
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	request := plaid.NewAuthGetRequest(item.token)
+	if accountIDs := requestAccountIDs(r); len(accountIDs) > 0 {
+		options := plaid.NewAuthGetRequestOptions()
+		options.SetAccountIds(accountIDs)
+		request.SetOptions(*options)
+	}
+	authGetResp, _, err := s.client.PlaidApi.AuthGet(ctx).AuthGetRequest(*request).Execute()
 
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
@@ -213,21 +458,31 @@ func Auth(w http.ResponseWriter, r *http.Request) {
 		"numbers":  authGetResp.GetNumbers(),
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
 }
 
-func Accounts(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	accountsGetResp, _, err := client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(
-		*plaid.NewAccountsGetRequest(accessToken),
-	).Execute()
+func (s *Server) Accounts(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	request := plaid.NewAccountsGetRequest(item.token)
+	if accountIDs := requestAccountIDs(r); len(accountIDs) > 0 {
+		options := plaid.NewAccountsGetRequestOptions()
+		options.SetAccountIds(accountIDs)
+		request.SetOptions(*options)
+	}
+	accountsGetResp, _, err := s.client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(*request).Execute()
 
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
@@ -235,21 +490,31 @@ func Accounts(w http.ResponseWriter, r *http.Request) {
 		"accounts": accountsGetResp.GetAccounts(),
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
 }
 
-func Balance(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	balancesGetResp, _, err := client.PlaidApi.AccountsBalanceGet(ctx).AccountsBalanceGetRequest(
-		*plaid.NewAccountsBalanceGetRequest(accessToken),
-	).Execute()
+func (s *Server) Balance(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	request := plaid.NewAccountsBalanceGetRequest(item.token)
+	if accountIDs := requestAccountIDs(r); len(accountIDs) > 0 {
+		options := plaid.NewAccountsBalanceGetRequestOptions()
+		options.SetAccountIds(accountIDs)
+		request.SetOptions(*options)
+	}
+	balancesGetResp, _, err := s.client.PlaidApi.AccountsBalanceGet(ctx).AccountsBalanceGetRequest(*request).Execute()
 
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
@@ -257,55 +522,77 @@ func Balance(w http.ResponseWriter, r *http.Request) {
 		"accounts": balancesGetResp.GetAccounts(),
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
 }
 
-func Item(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	itemGetResp, _, err := client.PlaidApi.ItemGet(ctx).ItemGetRequest(
-		*plaid.NewItemGetRequest(accessToken),
-	).Execute()
-
+func (s *Server) Item(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
 
-	institutionGetByIdResp, _, err := client.PlaidApi.InstitutionsGetById(ctx).InstitutionsGetByIdRequest(
-		*plaid.NewInstitutionsGetByIdRequest(
-			*itemGetResp.GetItem().InstitutionId.Get(),
-			convertCountryCodes(strings.Split(PLAID_COUNTRY_CODES, ",")),
-		),
+	itemGetResp, _, err := s.client.PlaidApi.ItemGet(ctx).ItemGetRequest(
+		*plaid.NewItemGetRequest(item.token),
 	).Execute()
 
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
+	// items linked without an institution, e.g. with manual micro-deposits,
+	// have no institution_id
+	var institution interface{}
+	if institutionID := itemGetResp.GetItem().InstitutionId.Get(); institutionID != nil {
+		institutionGetByIdResp, _, err := s.client.PlaidApi.InstitutionsGetById(ctx).InstitutionsGetByIdRequest(
+			*plaid.NewInstitutionsGetByIdRequest(
+				*institutionID,
+				convertCountryCodes(s.config.CountryCodes),
+			),
+		).Execute()
+
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		institution = institutionGetByIdResp.GetInstitution()
+	}
+
 	b, err := json.Marshal(map[string]interface{}{
 		"item":        itemGetResp.GetItem(),
-		"institution": institutionGetByIdResp.GetInstitution(),
+		"institution": institution,
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
 }
 
-func Identity(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	identityGetResp, _, err := client.PlaidApi.IdentityGet(ctx).IdentityGetRequest(
-		*plaid.NewIdentityGetRequest(accessToken),
-	).Execute()
+func (s *Server) Identity(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	request := plaid.NewIdentityGetRequest(item.token)
+	if accountIDs := requestAccountIDs(r); len(accountIDs) > 0 {
+		options := plaid.NewIdentityGetRequestOptions()
+		options.SetAccountIds(accountIDs)
+		request.SetOptions(*options)
+	}
+	identityGetResp, _, err := s.client.PlaidApi.IdentityGet(ctx).IdentityGetRequest(*request).Execute()
+	if err != nil {
+		api.WriteError(w, err)
 		return
 	}
 
@@ -313,73 +600,118 @@ func Identity(w http.ResponseWriter, r *http.Request) {
 		"identity": identityGetResp.GetAccounts(),
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
 }
 
-func Transactions(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	// Set cursor to empty to receive all historical updates
-	var cursor *string
-
-	// New transaction updates since "cursor"
-	var added []plaid.Transaction
-	var modified []plaid.Transaction
-	var removed []plaid.RemovedTransaction // Removed transaction ids
-	hasMore := true
-	// Iterate through each page of new transaction updates for item
-	for hasMore {
-		request := plaid.NewTransactionsSyncRequest(accessToken)
-		if cursor != nil {
-			request.SetCursor(*cursor)
-		}
-		resp, _, err := client.PlaidApi.TransactionsSync(
-			ctx,
-		).TransactionsSyncRequest(*request).Execute()
-		if err != nil {
-			io.WriteString(w, err.Error())
-			return
-		}
+func (s *Server) Transactions(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
 
-		// Add this page of results
-		added = append(added, resp.GetAdded()...)
-		modified = append(modified, resp.GetModified()...)
-		removed = append(removed, resp.GetRemoved()...)
-		hasMore = resp.GetHasMore()
-		// Update cursor to the next cursor
-		nextCursor := resp.GetNextCursor()
-		cursor = &nextCursor
+	query, err := transactionQuery(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
 	}
+	query.ItemID = item.ID
 
-	sort.Slice(added, func(i, j int) bool {
-		return added[i].GetDate() < added[j].GetDate()
-	})
-	latestTransactions := added[len(added)-9:]
+	// Fetch what changed since the last sync, then answer from the local store
+	if err := s.syncTransactions(ctx, item.ID, item.token); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	transactions, total, nextCursor, err := s.store.QueryTransactions(query)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
 
 	b, err := json.Marshal(map[string]interface{}{
-		"latest_transactions": latestTransactions,
+		"latest_transactions": transactions,
+		"total_count":         total,
+		"next_cursor":         nextCursor,
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
 }
 
+// transactionQuery reads the filters, sort order and page of a transactions
+// request from its query parameters.
+func transactionQuery(r *http.Request) (db.TransactionQuery, error) {
+	q := db.TransactionQuery{
+		StartDate:  r.FormValue("start_date"),
+		EndDate:    r.FormValue("end_date"),
+		AccountIDs: requestAccountIDs(r),
+		Category:   r.FormValue("category"),
+		Merchant:   r.FormValue("merchant"),
+		Cursor:     r.FormValue("cursor"),
+	}
+	for _, date := range []string{q.StartDate, q.EndDate} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return q, api.BadRequest("INVALID_FIELD", fmt.Sprintf("invalid date %q, expected YYYY-MM-DD", date))
+		}
+	}
+	for name, amount := range map[string]**float64{
+		"min_amount": &q.MinAmount,
+		"max_amount": &q.MaxAmount,
+	} {
+		v := r.FormValue(name)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return q, api.BadRequest("INVALID_FIELD", fmt.Sprintf("invalid %s %q", name, v))
+		}
+		*amount = &f
+	}
+	switch order := r.FormValue("sort"); order {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		return q, api.BadRequest("INVALID_FIELD", fmt.Sprintf("invalid sort %q, expected asc or desc", order))
+	}
+	if v := r.FormValue("count"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil || count <= 0 {
+			return q, api.BadRequest("INVALID_FIELD", fmt.Sprintf("invalid count %q", v))
+		}
+		q.Limit = count
+	}
+	return q, nil
+}
+
 // This functionality is only relevant for the UK Payment Initiation product.
 // Retrieve Payment for a specified Payment ID
-func Payment(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+func (s *Server) Payment(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
 
-	paymentGetResp, _, err := client.PlaidApi.PaymentInitiationPaymentGet(ctx).PaymentInitiationPaymentGetRequest(
-		*plaid.NewPaymentInitiationPaymentGetRequest(paymentID),
+	paymentGetResp, _, err := s.client.PlaidApi.PaymentInitiationPaymentGet(ctx).PaymentInitiationPaymentGetRequest(
+		*plaid.NewPaymentInitiationPaymentGetRequest(item.PaymentID),
 	).Execute()
 
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
@@ -387,7 +719,7 @@ func Payment(w http.ResponseWriter, r *http.Request) {
 		"payment": paymentGetResp,
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
@@ -395,14 +727,20 @@ func Payment(w http.ResponseWriter, r *http.Request) {
 
 // This functionality is only relevant for the ACH Transfer product.
 // Retrieve Transfer for a specified Transfer ID
-func Transfer(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+func (s *Server) Transfer(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
 
-	transferGetResp, _, err := client.PlaidApi.TransferGet(ctx).TransferGetRequest(
-		*plaid.NewTransferGetRequest(transferID),
+	transferGetResp, _, err := s.client.PlaidApi.TransferGet(ctx).TransferGetRequest(
+		*plaid.NewTransferGetRequest(item.TransferID),
 	).Execute()
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
@@ -410,23 +748,34 @@ func Transfer(w http.ResponseWriter, r *http.Request) {
 		"transfer": transferGetResp.GetTransfer(),
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
 }
 
-func InvestmentTransactions(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+func (s *Server) InvestmentTransactions(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
 
 	endDate := time.Now().Local().Format("2006-01-02")
 	startDate := time.Now().Local().Add(-30 * 24 * time.Hour).Format("2006-01-02")
 
-	request := plaid.NewInvestmentsTransactionsGetRequest(accessToken, startDate, endDate)
-	invTxResp, _, err := client.PlaidApi.InvestmentsTransactionsGet(ctx).InvestmentsTransactionsGetRequest(*request).Execute()
+	request := plaid.NewInvestmentsTransactionsGetRequest(item.token, startDate, endDate)
+	if accountIDs := requestAccountIDs(r); len(accountIDs) > 0 {
+		options := plaid.NewInvestmentsTransactionsGetRequestOptions()
+		options.SetAccountIds(accountIDs)
+		request.SetOptions(*options)
+	}
+	invTxResp, _, err := s.client.PlaidApi.InvestmentsTransactionsGet(ctx).InvestmentsTransactionsGetRequest(*request).Execute()
 
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
@@ -434,20 +783,30 @@ func InvestmentTransactions(w http.ResponseWriter, r *http.Request) {
 		"investments_transactions": invTxResp,
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
 }
 
-func Holdings(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	holdingsGetResp, _, err := client.PlaidApi.InvestmentsHoldingsGet(ctx).InvestmentsHoldingsGetRequest(
-		*plaid.NewInvestmentsHoldingsGetRequest(accessToken),
-	).Execute()
+func (s *Server) Holdings(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	request := plaid.NewInvestmentsHoldingsGetRequest(item.token)
+	if accountIDs := requestAccountIDs(r); len(accountIDs) > 0 {
+		options := plaid.NewInvestmentHoldingsGetRequestOptions()
+		options.SetAccountIds(accountIDs)
+		request.SetOptions(*options)
+	}
+	holdingsGetResp, _, err := s.client.PlaidApi.InvestmentsHoldingsGet(ctx).InvestmentsHoldingsGetRequest(*request).Execute()
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
@@ -455,40 +814,61 @@ func Holdings(w http.ResponseWriter, r *http.Request) {
 		"holdings": holdingsGetResp,
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
 }
 
-func Info(w http.ResponseWriter, r *http.Request) {
+func (s *Server) Info(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		io.WriteString(w, "Method not supported")
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	user, err := s.requestUser(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	var itemID interface{}
+	if item, err := s.items.get(user, r.FormValue("item_id")); err == nil {
+		itemID = item.ID
+	}
+	itemIDs, err := s.items.list(user)
+	if err != nil {
+		api.WriteError(w, err)
 		return
 	}
 	b, err := json.Marshal(map[string]interface{}{
-		"item_id":      itemID,
-		"access_token": accessToken,
-		"products":     strings.Split(PLAID_PRODUCTS, ","),
+		"user":     user,
+		"item_id":  itemID,
+		"items":    itemIDs,
+		"products": s.config.Products,
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
 }
 
-func CreatePublicToken(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+func (s *Server) CreatePublicToken(w http.ResponseWriter, r *http.Request) {
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
 
 	// Create a one-time use public_token for the Item.
 	// This public_token can be used to initialize Link in update mode for a user
-	publicTokenCreateResp, _, err := client.PlaidApi.ItemCreatePublicToken(ctx).ItemPublicTokenCreateRequest(
-		*plaid.NewItemPublicTokenCreateRequest(accessToken),
+	publicTokenCreateResp, _, err := s.client.PlaidApi.ItemCreatePublicToken(ctx).ItemPublicTokenCreateRequest(
+		*plaid.NewItemPublicTokenCreateRequest(item.token),
 	).Execute()
 
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 
@@ -496,28 +876,38 @@ func CreatePublicToken(w http.ResponseWriter, r *http.Request) {
 		"public_token": publicTokenCreateResp.GetPublicToken(),
 	})
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
 	io.WriteString(w, string(b))
 }
 
-func CreateLinkToken(w http.ResponseWriter, r *http.Request) {
-	linkToken, err := linkTokenCreate(nil)
+// CreateLinkToken creates a link token for the calling user, customized by
+// the optional JSON linkTokenOptions of the request body.
+func (s *Server) CreateLinkToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	opts, err := requestLinkTokenOptions(r, s.config.WebhookURL)
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
-
-	b, err := json.Marshal(map[string]interface{}{
-		"link_token": linkToken,
-	})
+	user, err := s.requestUser(r)
 	if err != nil {
-		io.WriteString(w, err.Error())
+		api.WriteError(w, err)
 		return
 	}
-	io.WriteString(w, string(b))
-	log.Printf("created link: %s", string(b))
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+	linkToken, err := s.linkTokenCreate(ctx, user, opts)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	s.writeLinkToken(w, r, user, linkToken, opts)
+	s.logger.Debug("created link token")
 }
 
 func convertCountryCodes(countryCodeStrs []string) []plaid.CountryCode {
@@ -540,126 +930,108 @@ func convertProducts(productStrs []string) []plaid.Products {
 	return products
 }
 
-// linkTokenCreate creates a link token using the specified parameters
-func linkTokenCreate(
-	paymentInitiation *plaid.LinkTokenCreateRequestPaymentInitiation,
-) (string, error) {
-	ctx := context.Background()
-	countryCodes := convertCountryCodes(strings.Split(PLAID_COUNTRY_CODES, ","))
-	products := convertProducts(strings.Split(PLAID_PRODUCTS, ","))
-	redirectURI := PLAID_REDIRECT_URI
+// linkRedirectURI returns the OAuth redirect URI of a link token created with
+// opts, if any.
+func (s *Server) linkRedirectURI(opts *linkTokenOptions) string {
+	if opts.RedirectURI != "" {
+		return opts.RedirectURI
+	}
+	return s.config.RedirectURI
+}
+
+// linkTokenCreate creates a link token for a user. Options left unset use
+// the configured products, country codes, redirect URI and webhook.
+func (s *Server) linkTokenCreate(ctx context.Context, email string, opts *linkTokenOptions) (string, error) {
+	u, err := s.store.GetUser(email)
+	if err != nil {
+		return "", err
+	}
+	countryCodes, products := s.config.CountryCodes, s.config.Products
+	language, redirectURI, webhook := "en", s.linkRedirectURI(opts), s.config.WebhookURL
+	if len(opts.CountryCodes) > 0 {
+		countryCodes = opts.CountryCodes
+	}
+	if len(opts.Products) > 0 {
+		products = opts.Products
+	}
+	if opts.Language != "" {
+		language = opts.Language
+	}
+	if opts.Webhook != "" {
+		webhook = opts.Webhook
+	}
 
 	user := plaid.LinkTokenCreateRequestUser{
-		ClientUserId: time.Now().String(),
+		ClientUserId: clientUserID(u),
 	}
 
 	request := plaid.NewLinkTokenCreateRequest(
 		"Plaid Quickstart",
-		"en",
-		countryCodes,
+		language,
+		convertCountryCodes(countryCodes),
 		user,
 	)
 
-	request.SetProducts(products)
+	// products can not be changed in update mode
+	if opts.accessToken != "" {
+		request.SetAccessToken(opts.accessToken)
+	} else {
+		request.SetProducts(convertProducts(products))
+	}
+	if opts.update != nil {
+		request.SetUpdate(*opts.update)
+	}
 
 	if redirectURI != "" {
 		request.SetRedirectUri(redirectURI)
 	}
 
-	if paymentInitiation != nil {
-		request.SetPaymentInitiation(*paymentInitiation)
+	if webhook != "" {
+		request.SetWebhook(webhook)
 	}
 
-	linkTokenCreateResp, _, err := client.PlaidApi.LinkTokenCreate(ctx).LinkTokenCreateRequest(*request).Execute()
+	filters, err := opts.accountFilters()
 	if err != nil {
 		return "", err
 	}
-
-	return linkTokenCreateResp.GetLinkToken(), nil
-}
-
-func Assets(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	// create the asset report
-	assetReportCreateResp, _, err := client.PlaidApi.AssetReportCreate(ctx).AssetReportCreateRequest(
-		*plaid.NewAssetReportCreateRequest([]string{accessToken}, 10),
-	).Execute()
-	if err != nil {
-		io.WriteString(w, err.Error())
-		return
-	}
-
-	assetReportToken := assetReportCreateResp.GetAssetReportToken()
-
-	// get the asset report
-	assetReportGetResp, err := pollForAssetReport(ctx, client, assetReportToken)
-	if err != nil {
-		io.WriteString(w, err.Error())
-		return
-	}
-
-	// get it as a pdf
-	pdfRequest := plaid.NewAssetReportPDFGetRequest(assetReportToken)
-	pdfFile, _, err := client.PlaidApi.AssetReportPdfGet(ctx).AssetReportPDFGetRequest(*pdfRequest).Execute()
-	if err != nil {
-		io.WriteString(w, err.Error())
-		return
+	if filters != nil {
+		request.SetAccountFilters(*filters)
 	}
 
-	reader := bufio.NewReader(pdfFile)
-	content, err := ioutil.ReadAll(reader)
-	if err != nil {
-		io.WriteString(w, err.Error())
-		return
+	if opts.paymentInitiation != nil {
+		request.SetPaymentInitiation(*opts.paymentInitiation)
 	}
 
-	// convert pdf to base64
-	encodedPdf := base64.StdEncoding.EncodeToString(content)
-	b, err := json.Marshal(map[string]interface{}{
-		"json": assetReportGetResp.GetReport(),
-		"pdf":  encodedPdf,
-	})
+	linkTokenCreateResp, _, err := s.client.PlaidApi.LinkTokenCreate(ctx).LinkTokenCreateRequest(*request).Execute()
 	if err != nil {
-		io.WriteString(w, err.Error())
-		return
+		return "", err
 	}
-	io.WriteString(w, string(b))
-}
-
-func pollForAssetReport(ctx context.Context, client *plaid.APIClient, assetReportToken string) (*plaid.AssetReportGetResponse, error) {
-	numRetries := 20
-	request := plaid.NewAssetReportGetRequest(assetReportToken)
 
-	for i := 0; i < numRetries; i++ {
-		response, _, err := client.PlaidApi.AssetReportGet(ctx).AssetReportGetRequest(*request).Execute()
-		if err != nil {
-			plaidErr, err := plaid.ToPlaidError(err)
-			if plaidErr.ErrorCode == "PRODUCT_NOT_READY" {
-				time.Sleep(1 * time.Second)
-				continue
-			} else {
-				return nil, err
-			}
-		} else {
-			return &response, nil
-		}
-	}
-	return nil, errors.New("Timed out when polling for an asset report.")
+	return linkTokenCreateResp.GetLinkToken(), nil
 }
 
 // This is a helper function to authorize and create a Transfer after successful
 // exchange of a public_token for an access_token. The transfer_id is then used
 // to obtain the data about that particular Transfer.
-func authorizeAndCreateTransfer(ctx context.Context, client *plaid.APIClient, accessToken string) (string, error) {
-	// We call /accounts/get to obtain first account_id - in production,
-	// account_id's should be persisted in a data store and retrieved
-	// from there.
-	accountsGetResp, _, _ := client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(
-		*plaid.NewAccountsGetRequest(accessToken),
-	).Execute()
-
-	accountID := accountsGetResp.GetAccounts()[0].AccountId
+func (s *Server) authorizeAndCreateTransfer(ctx context.Context, accessToken string, accountIDs []string) (string, error) {
+	// Use the account selected by the caller, otherwise we call /accounts/get
+	// to obtain first account_id - in production, account_id's should be
+	// persisted in a data store and retrieved from there.
+	var accountID string
+	if len(accountIDs) > 0 {
+		accountID = accountIDs[0]
+	} else {
+		accountsGetResp, _, err := s.client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(
+			*plaid.NewAccountsGetRequest(accessToken),
+		).Execute()
+		if err != nil {
+			return "", err
+		}
+		if len(accountsGetResp.GetAccounts()) == 0 {
+			return "", errors.New("no accounts available for transfer")
+		}
+		accountID = accountsGetResp.GetAccounts()[0].AccountId
+	}
 
 	transferAuthorizationCreateUser := plaid.NewTransferUserInRequest("FirstName LastName")
 	transferAuthorizationCreateRequest := plaid.NewTransferAuthorizationCreateRequest(
@@ -671,11 +1043,15 @@ func authorizeAndCreateTransfer(ctx context.Context, client *plaid.APIClient, ac
 		"ppd",
 		*transferAuthorizationCreateUser,
 	)
-	transferAuthorizationCreateResp, _, err := client.PlaidApi.TransferAuthorizationCreate(ctx).TransferAuthorizationCreateRequest(*transferAuthorizationCreateRequest).Execute()
+	transferAuthorizationCreateResp, _, err := s.client.PlaidApi.TransferAuthorizationCreate(ctx).TransferAuthorizationCreateRequest(*transferAuthorizationCreateRequest).Execute()
 	if err != nil {
 		return "", err
 	}
-	authorizationID := transferAuthorizationCreateResp.GetAuthorization().Id
+	authorization := transferAuthorizationCreateResp.GetAuthorization()
+	if authorization.GetDecision() != plaid.TRANSFERAUTHORIZATIONDECISION_APPROVED {
+		return "", api.NewError(http.StatusConflict, "TRANSFER_ERROR", "TRANSFER_AUTHORIZATION_DECLINED", "the transfer was not authorized")
+	}
+	authorizationID := authorization.Id
 
 	transferCreateRequest := plaid.NewTransferCreateRequest(
 		accessToken,
@@ -688,7 +1064,10 @@ func authorizeAndCreateTransfer(ctx context.Context, client *plaid.APIClient, ac
 		"ppd",
 		*transferAuthorizationCreateUser,
 	)
-	transferCreateResp, _, err := client.PlaidApi.TransferCreate(ctx).TransferCreateRequest(*transferCreateRequest).Execute()
+	// a transfer is created once per authorization, even if this call is
+	// sent again
+	transferCreateRequest.SetIdempotencyKey(authorizationID)
+	transferCreateResp, _, err := s.client.PlaidApi.TransferCreate(ctx).TransferCreateRequest(*transferCreateRequest).Execute()
 	if err != nil {
 		return "", err
 	}
@@ -696,6 +1075,15 @@ func authorizeAndCreateTransfer(ctx context.Context, client *plaid.APIClient, ac
 	return transferCreateResp.GetTransfer().Id, nil
 }
 
+// itemProducts returns the products billed for an item.
+func itemProducts(item plaid.Item) []string {
+	var products []string
+	for _, p := range item.GetBilledProducts() {
+		products = append(products, string(p))
+	}
+	return products
+}
+
 // Helper function to determine if Transfer is in Plaid product array
 func itemExists(array []string, product string) bool {
 	for _, item := range array {
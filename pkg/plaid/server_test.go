@@ -0,0 +1,404 @@
+package plaid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uitachi123/go-plaid/pkg/auth"
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"github.com/uitachi123/go-plaid/pkg/metrics"
+	"github.com/uitachi123/go-plaid/pkg/plaidfake"
+	"go.uber.org/zap"
+)
+
+// newTestServer returns a server talking to a fresh plaidfake server, with
+// its own store. The configure functions adjust the default test config.
+func newTestServer(t *testing.T, configure ...func(*Config)) (*Server, *plaidfake.Server) {
+	t.Helper()
+	fake := plaidfake.NewServer()
+	t.Cleanup(fake.Close)
+	store, err := db.NewEmptyStore()
+	if err != nil {
+		t.Fatalf("error creating store: %v", err)
+	}
+	if err := store.SeedUsers(""); err != nil {
+		t.Fatalf("error seeding users: %v", err)
+	}
+	c := DefaultConfig()
+	c.ClientID, c.Secret = "client", "secret"
+	c.APIURL = fake.URL
+	c.Products = []string{"transactions", "auth"}
+	for _, f := range configure {
+		f(c)
+	}
+	s, err := NewServer(c, store, zap.NewNop(), metrics.New(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+	return s, fake
+}
+
+// do sends a request to the routes of s and decodes the JSON response. The
+// request is sent with a session of the "user" form value, if any.
+func do(t *testing.T, s *Server, method, path string, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+	var user string
+	if user = form.Get("user"); user != "" {
+		form = cloneValues(form)
+		form.Del("user")
+	}
+	var req *http.Request
+	if method == "POST" {
+		req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, path+"?"+form.Encode(), nil)
+	}
+	if user != "" {
+		req.AddCookie(s.Sessions().Cookie(user))
+	}
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+	resp := map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error decoding %s %s response %q: %v", method, path, w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+// sendWebhook posts a webhook signed by the fake to the server.
+func sendWebhook(t *testing.T, s *Server, fake *plaidfake.Server, payload map[string]interface{}) {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest("POST", "/api/webhook", bytes.NewReader(body))
+	req.Header.Set("Plaid-Verification", fake.SignWebhook(body))
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	s.webhooks.Wait()
+}
+
+func cloneValues(v url.Values) url.Values {
+	res := url.Values{}
+	for k, values := range v {
+		res[k] = append([]string(nil), values...)
+	}
+	return res
+}
+
+// link links an item of the fake for the user and returns its item_id.
+func link(t *testing.T, s *Server, fake *plaidfake.Server, user string) string {
+	t.Helper()
+	code, resp := do(t, s, "POST", "/api/set_access_token", url.Values{
+		"public_token": {fake.LinkItem()},
+		"user":         {user},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("error linking item: %v", resp)
+	}
+	if _, ok := resp["access_token"]; ok {
+		t.Fatalf("Expected the access token to stay on the server, got %v", resp)
+	}
+	return resp["item_id"].(string)
+}
+
+func Test_Accounts(t *testing.T) {
+	s, fake := newTestServer(t)
+	link(t, s, fake, "alice@test.com")
+
+	code, resp := do(t, s, "GET", "/api/accounts", url.Values{"user": {"alice@test.com"}, "account_id": {"acc-savings"}})
+	if code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusOK, code, resp)
+	}
+	accounts := resp["accounts"].([]interface{})
+	if len(accounts) != 1 || accounts[0].(map[string]interface{})["account_id"] != "acc-savings" {
+		t.Errorf("Expected only acc-savings, got %v", accounts)
+	}
+}
+
+func Test_Item(t *testing.T) {
+	s, fake := newTestServer(t)
+	itemID := link(t, s, fake, "alice@test.com")
+
+	code, resp := do(t, s, "GET", "/api/item", url.Values{"user": {"alice@test.com"}, "item_id": {itemID}})
+	if code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusOK, code, resp)
+	}
+	if institution, _ := resp["institution"].(map[string]interface{}); institution["name"] != "First Platypus Bank" {
+		t.Errorf("Unexpected institution %v", resp["institution"])
+	}
+
+	// items without an institution are served without one
+	fake.Update(func(f *plaidfake.Fixtures) { f.InstitutionID = "" })
+	code, resp = do(t, s, "GET", "/api/item", url.Values{"user": {"alice@test.com"}, "item_id": {itemID}})
+	if code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusOK, code, resp)
+	}
+	if resp["institution"] != nil {
+		t.Errorf("Expected no institution, got %v", resp["institution"])
+	}
+}
+
+func Test_Transfer(t *testing.T) {
+	s, fake := newTestServer(t, func(c *Config) {
+		c.Products = []string{"auth", "transfer"}
+	})
+	// items have the products Link was opened with, not the configured ones
+	fake.Update(func(f *plaidfake.Fixtures) { f.BilledProducts = []string{"transfer"} })
+	itemID := link(t, s, fake, "alice@test.com")
+	if item, _ := s.store.GetItem(itemID); item.TransferID == "" || !reflect.DeepEqual(item.Products, []string{"transfer"}) {
+		t.Errorf("Expected a transfer, got %v", item)
+	}
+	if key, _ := fake.LastRequest("/transfer/create")["idempotency_key"].(string); key == "" {
+		t.Errorf("Expected an idempotency key, got %v", fake.LastRequest("/transfer/create"))
+	}
+
+	// transfers failing on a server error are not created again
+	fake.FailNext("/transfer/create", plaidfake.Error{ErrorType: "API_ERROR", ErrorCode: "INTERNAL_SERVER_ERROR"})
+	calls := fake.Calls("/transfer/create")
+	code, resp := do(t, s, "POST", "/api/set_access_token", url.Values{"public_token": {fake.LinkItem()}, "user": {"alice@test.com"}})
+	if fake.Calls("/transfer/create") != calls+1 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", calls+1, fake.Calls("/transfer/create"))
+	}
+	// failed transfers are recorded on the linked item
+	if code != http.StatusOK || resp["transfer_error_code"] != "INTERNAL_SERVER_ERROR" {
+		t.Errorf("Unexpected response %v %v", code, resp)
+	}
+	if item, _ := s.store.GetItem(resp["item_id"].(string)); item.TransferID != "" || item.TransferErrorCode != "INTERNAL_SERVER_ERROR" {
+		t.Errorf("Unexpected item %v", item)
+	}
+
+	// declined transfers are not created
+	fake.Update(func(f *plaidfake.Fixtures) { f.TransferDeclined = true })
+	calls = fake.Calls("/transfer/create")
+	_, resp = do(t, s, "POST", "/api/set_access_token", url.Values{"public_token": {fake.LinkItem()}, "user": {"alice@test.com"}})
+	if fake.Calls("/transfer/create") != calls || resp["transfer_error_code"] != "TRANSFER_AUTHORIZATION_DECLINED" {
+		t.Errorf("Expected a declined transfer, got %v after %v calls", resp, fake.Calls("/transfer/create")-calls)
+	}
+
+	// API keys without the transfer:write scope can not link items
+	// creating transfers, even when the transfer product is not configured
+	s.config.Products = []string{"auth"}
+	fake.Update(func(f *plaidfake.Fixtures) { f.TransferDeclined = false })
+	key, _ := auth.GenerateAPIKey()
+	s.store.SaveAPIKey(&db.APIKey{ID: "key-1", User: "alice@test.com", Hash: auth.HashAPIKey(key), Scopes: []string{auth.ScopeItemsWrite}})
+	req := httptest.NewRequest("POST", "/api/set_access_token", strings.NewReader(url.Values{"public_token": {fake.LinkItem()}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+key)
+	w := httptest.NewRecorder()
+	calls = fake.Calls("/transfer/authorization/create")
+	s.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || fake.Calls("/transfer/authorization/create") != calls || fake.Calls("/item/remove") != 1 {
+		t.Errorf("Expected %v without a transfer and the item removed\tGot %v: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+}
+
+func Test_Transactions(t *testing.T) {
+	s, fake := newTestServer(t)
+	link(t, s, fake, "alice@test.com")
+
+	code, resp := do(t, s, "GET", "/api/transactions", url.Values{"user": {"alice@test.com"}, "sort": {"asc"}, "count": {"3"}})
+	if code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusOK, code, resp)
+	}
+	if total := resp["total_count"]; total != float64(4) {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 4, total)
+	}
+	transactions := resp["latest_transactions"].([]interface{})
+	if len(transactions) != 3 || transactions[0].(map[string]interface{})["transaction_id"] != "tx-1" {
+		t.Errorf("Unexpected first page %v", transactions)
+	}
+	if resp["next_cursor"] == "" {
+		t.Errorf("Expected a next page")
+	}
+	if calls := fake.Calls("/transactions/sync"); calls != 2 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 2, calls)
+	}
+}
+
+func Test_Errors(t *testing.T) {
+	s, fake := newTestServer(t)
+
+	code, resp := do(t, s, "GET", "/api/accounts", url.Values{"user": {"nobody@test.com"}})
+	if code != http.StatusUnauthorized || resp["error"].(map[string]interface{})["error_code"] != "INVALID_SESSION" {
+		t.Errorf("Expected INVALID_SESSION, got %v %v", code, resp)
+	}
+	code, resp = do(t, s, "GET", "/api/accounts", url.Values{"user": {"alice@test.com"}})
+	if code != http.StatusNotFound || resp["error"].(map[string]interface{})["error_code"] != "NO_ITEMS" {
+		t.Errorf("Expected NO_ITEMS, got %v %v", code, resp)
+	}
+
+	link(t, s, fake, "alice@test.com")
+	fake.FailNext("/accounts/get", plaidfake.Error{ErrorType: "ITEM_ERROR", ErrorCode: "ITEM_LOGIN_REQUIRED"})
+	code, resp = do(t, s, "GET", "/api/accounts", url.Values{"user": {"alice@test.com"}})
+	if code != http.StatusBadRequest || resp["error"].(map[string]interface{})["error_code"] != "ITEM_LOGIN_REQUIRED" {
+		t.Errorf("Expected ITEM_LOGIN_REQUIRED, got %v %v", code, resp)
+	}
+}
+
+func Test_Auth(t *testing.T) {
+	s, fake := newTestServer(t)
+	itemID := link(t, s, fake, "alice@test.com")
+
+	// the user parameter is not trusted anymore
+	req := httptest.NewRequest("GET", "/api/accounts?user=alice@test.com", nil)
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %v\tGot %v", http.StatusUnauthorized, w.Code)
+	}
+
+	hash, _ := auth.HashPassword("alice-password")
+	s.store.UpdateUser(&db.User{Email: "alice@test.com", Name: "Alice", PasswordHash: hash})
+	form := url.Values{"email": {"alice@test.com"}, "password": {"alice-password"}}
+	req = httptest.NewRequest("POST", "/api/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("Expected %v with a session cookie\tGot %v %v", http.StatusOK, w.Code, w.Body.String())
+	}
+	req = httptest.NewRequest("POST", "/api/info", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	w = httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+	var info map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &info)
+	if w.Code != http.StatusOK || info["item_id"] != itemID || info["user"] != "alice@test.com" {
+		t.Errorf("Unexpected info %v %v", w.Code, info)
+	}
+	if _, ok := info["access_token"]; ok || strings.Contains(w.Body.String(), "access-sandbox") {
+		t.Errorf("Expected no access token, got %v", w.Body.String())
+	}
+
+	// items of other users are not found
+	code, resp := do(t, s, "GET", "/api/accounts", url.Values{"user": {"bob@test.com"}, "item_id": {itemID}})
+	if code != http.StatusNotFound {
+		t.Errorf("Expected %v\tGot %v: %v", http.StatusNotFound, code, resp)
+	}
+
+	// API keys only reach the endpoints of their scopes
+	key, _ := auth.GenerateAPIKey()
+	s.store.SaveAPIKey(&db.APIKey{ID: "key-1", User: "alice@test.com", Hash: auth.HashAPIKey(key), Scopes: []string{auth.ScopeTransactionsRead}})
+	for path, expected := range map[string]int{
+		"/api/transactions/export?item_id=" + itemID: http.StatusOK,
+		"/api/accounts?item_id=" + itemID:            http.StatusForbidden,
+		"/api/assets":                                http.StatusForbidden,
+	} {
+		req = httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w = httptest.NewRecorder()
+		s.Routes().ServeHTTP(w, req)
+		if w.Code != expected {
+			t.Errorf("%s: Expected %v\tGot %v: %s", path, expected, w.Code, w.Body.String())
+		}
+	}
+}
+
+func Test_Webhook(t *testing.T) {
+	s, fake := newTestServer(t)
+	itemID := link(t, s, fake, "alice@test.com")
+
+	body, _ := json.Marshal(map[string]string{
+		"webhook_type": "TRANSACTIONS",
+		"webhook_code": "SYNC_UPDATES_AVAILABLE",
+		"item_id":      itemID,
+	})
+	req := httptest.NewRequest("POST", "/api/webhook", bytes.NewReader(body))
+	req.Header.Set("Plaid-Verification", fake.SignWebhook(body))
+	w := httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	// the sync runs once the webhook is acknowledged
+	s.webhooks.Wait()
+	transactions, _ := s.store.ListTransactions(itemID)
+	if len(transactions) != 4 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 4, len(transactions))
+	}
+
+	// webhooks of items that are not stored are acknowledged too
+	sendWebhook(t, s, fake, map[string]interface{}{
+		"webhook_type": "TRANSACTIONS",
+		"webhook_code": "SYNC_UPDATES_AVAILABLE",
+		"item_id":      "removed-item",
+	})
+
+	req = httptest.NewRequest("POST", "/api/webhook", bytes.NewReader(body))
+	req.Header.Set("Plaid-Verification", fake.SignWebhook([]byte("{}")))
+	w = httptest.NewRecorder()
+	s.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %v\tGot %v", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func Test_Instances(t *testing.T) {
+	a, fakeA := newTestServer(t)
+	b, _ := newTestServer(t)
+	link(t, a, fakeA, "alice@test.com")
+
+	if code, _ := do(t, a, "POST", "/api/info", url.Values{"user": {"alice@test.com"}}); code != http.StatusOK {
+		t.Errorf("Expected %v\tGot %v", http.StatusOK, code)
+	}
+	_, resp := do(t, b, "POST", "/api/info", url.Values{"user": {"alice@test.com"}})
+	if items := resp["items"].([]interface{}); len(items) != 0 {
+		t.Errorf("Expected no items on the other server, got %v", items)
+	}
+}
+
+func Test_Close(t *testing.T) {
+	s, fake := newTestServer(t)
+	link(t, s, fake, "alice@test.com")
+	fake.Update(func(f *plaidfake.Fixtures) { f.AssetReportPolls = 100 })
+
+	code, resp := do(t, s, "POST", "/api/assets", url.Values{"user": {"alice@test.com"}})
+	if code != http.StatusAccepted {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusAccepted, code, resp)
+	}
+	for fake.Calls("/asset_report/get") == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Close()
+	time.Sleep(100 * time.Millisecond)
+	calls := fake.Calls("/asset_report/get")
+	time.Sleep(time.Second)
+	if fake.Calls("/asset_report/get") != calls {
+		t.Errorf("Expected the asset report polling to stop")
+	}
+	_, resp = do(t, s, "GET", "/api/assets", url.Values{"user": {"alice@test.com"}, "job_id": {resp["job_id"].(string)}})
+	if resp["status"] != "pending" {
+		t.Errorf("Data mismatch, expected:  %v got: %v", "pending", resp["status"])
+	}
+}
+
+func Test_SyncRestart(t *testing.T) {
+	s, fake := newTestServer(t)
+	itemID := link(t, s, fake, "alice@test.com")
+	fake.FailNext("/transactions/sync", plaidfake.Error{ErrorType: "TRANSACTIONS_ERROR", ErrorCode: "TRANSACTIONS_SYNC_MUTATION_DURING_PAGINATION"})
+
+	item, _ := s.store.GetItem(itemID)
+	accessToken, _ := s.store.Token(item)
+	if err := s.syncTransactions(context.Background(), itemID, accessToken); err != nil {
+		t.Fatalf("error syncing transactions: %v", err)
+	}
+	if calls := fake.Calls("/transactions/sync"); calls != 3 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 3, calls)
+	}
+	transactions, _ := s.store.ListTransactions(itemID)
+	if len(transactions) != 4 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 4, len(transactions))
+	}
+}
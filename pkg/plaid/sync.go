@@ -0,0 +1,91 @@
+package plaid
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"go.uber.org/zap"
+)
+
+// syncTransactions fetches the transaction updates of an item since its
+// stored cursor and applies them to the local transactions table. Pages are
+// applied together once the last one is fetched, and pagination restarts from
+// the stored cursor when Plaid reports the updates changed in the meantime.
+func (s *Server) syncTransactions(ctx context.Context, itemID, accessToken string) error {
+	lock, _ := s.syncLocks.LoadOrStore(itemID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	item, err := s.store.GetItem(itemID)
+	if err != nil {
+		return err
+	}
+	policy := s.config.retryPolicy("/transactions/sync")
+	for attempt := 1; ; attempt++ {
+		err := s.syncTransactionPages(ctx, itemID, accessToken, item.Cursor)
+		plaidErr, perr := plaid.ToPlaidError(err)
+		if err == nil || perr != nil || plaidErr.ErrorCode != "TRANSACTIONS_SYNC_MUTATION_DURING_PAGINATION" || attempt >= policy.MaxAttempts {
+			return err
+		}
+		s.logger.Info("restarting transactions sync", zap.String("item_id", itemID), zap.Int("attempt", attempt))
+		select {
+		case <-time.After(policy.delay(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// syncTransactionPages fetches every page of transaction updates from cursor
+// and applies them to the local transactions table.
+func (s *Server) syncTransactionPages(ctx context.Context, itemID, accessToken, cursor string) error {
+	var added, modified []*db.Transaction
+	var removed []string
+	hasMore := true
+	// Iterate through each page of new transaction updates for item, an
+	// empty cursor receiving all historical updates
+	for hasMore {
+		request := plaid.NewTransactionsSyncRequest(accessToken)
+		if cursor != "" {
+			request.SetCursor(cursor)
+		}
+		resp, _, err := s.client.PlaidApi.TransactionsSync(
+			ctx,
+		).TransactionsSyncRequest(*request).Execute()
+		if err != nil {
+			return err
+		}
+		s.metrics.SyncPage()
+
+		added = append(added, convertTransactions(resp.GetAdded())...)
+		modified = append(modified, convertTransactions(resp.GetModified())...)
+		for _, t := range resp.GetRemoved() {
+			removed = append(removed, t.GetTransactionId())
+		}
+		hasMore = resp.GetHasMore()
+		// Update cursor to the next cursor
+		cursor = resp.GetNextCursor()
+	}
+	return s.store.ApplyTransactionsSync(itemID, added, modified, removed, cursor)
+}
+
+func convertTransactions(transactions []plaid.Transaction) []*db.Transaction {
+	res := []*db.Transaction{}
+	for _, t := range transactions {
+		res = append(res, &db.Transaction{
+			ID:              t.GetTransactionId(),
+			AccountID:       t.GetAccountId(),
+			Amount:          t.GetAmount(),
+			IsoCurrencyCode: t.GetIsoCurrencyCode(),
+			Date:            t.GetDate(),
+			Name:            t.GetName(),
+			MerchantName:    t.GetMerchantName(),
+			Category:        t.GetCategory(),
+			Pending:         t.GetPending(),
+		})
+	}
+	return res
+}
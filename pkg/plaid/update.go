@@ -0,0 +1,141 @@
+package plaid
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"github.com/uitachi123/go-plaid/pkg/api"
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"go.uber.org/zap"
+)
+
+var errItemHealthy = api.NewError(http.StatusConflict, "INVALID_REQUEST", "ITEM_UPDATE_NOT_NEEDED", "the item does not need to be re-authenticated")
+
+// needsUpdate tells if the user of an item has to go through Link update
+// mode for the item to keep working.
+func needsUpdate(item *db.Item) bool {
+	return item.Status == db.ItemStatusPendingExpiration ||
+		(item.Status == db.ItemStatusError && item.ErrorCode == "ITEM_LOGIN_REQUIRED")
+}
+
+// CreateUpdateLinkToken creates a link token opening Link in update mode for
+// the item of the "item_id" parameter, so its user re-authenticates an item
+// in ITEM_LOGIN_REQUIRED or PENDING_EXPIRATION state. With
+// "account_selection" set to true, it lets the user choose the accounts
+// shared instead, e.g. to add new accounts, whatever the item state.
+func (s *Server) CreateUpdateLinkToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	accountSelection, _ := strconv.ParseBool(r.FormValue("account_selection"))
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	if !accountSelection && !needsUpdate(item.Item) {
+		api.WriteError(w, errItemHealthy)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	update := plaid.NewLinkTokenCreateRequestUpdate()
+	update.SetAccountSelectionEnabled(accountSelection)
+	opts := &linkTokenOptions{
+		accessToken: item.token,
+		update:      update,
+	}
+	linkToken, err := s.linkTokenCreate(ctx, item.User, opts)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	s.writeLinkToken(w, r, item.User, linkToken, opts)
+}
+
+// CompleteUpdate is called once the user went through Link update mode for
+// the item of the "item_id" parameter, with the same "account_selection" as
+// the link token. The item is marked healthy again if Plaid no longer
+// reports an error for it, its consent expiration is updated and its
+// transactions are synced.
+func (s *Server) CompleteUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	accountSelection, _ := strconv.ParseBool(r.FormValue("account_selection"))
+	item, err := s.requestItem(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+
+	itemGetResp, _, err := s.client.PlaidApi.ItemGet(ctx).ItemGetRequest(
+		*plaid.NewItemGetRequest(item.token),
+	).Execute()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	if itemErr := itemGetResp.GetItem().Error.Get(); itemErr != nil {
+		api.WriteError(w, api.NewError(http.StatusConflict, itemErr.ErrorType, itemErr.ErrorCode, itemErr.ErrorMessage))
+		return
+	}
+	if err := s.repairItem(ctx, item.ID, accountSelection); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	// renewing the consent moves its expiration
+	now := time.Now()
+	updated, err := s.store.UpdateItem(item.ID, func(item *db.Item) {
+		item.ConsentExpiresAt = itemGetResp.GetItem().ConsentExpirationTime.Get()
+		item.CheckedAt = &now
+	})
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"item_id": updated.ID,
+		"status":  updated.Status,
+	})
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	io.WriteString(w, string(b))
+}
+
+// repairItem marks an item healthy again, with no new accounts to add once
+// the user selected accounts, and syncs the transactions missed while it
+// was broken.
+func (s *Server) repairItem(ctx context.Context, itemID string, accountsSelected bool) error {
+	item, err := s.store.UpdateItem(itemID, func(item *db.Item) {
+		item.Status = db.ItemStatusHealthy
+		item.ErrorCode = ""
+		if accountsSelected {
+			item.NewAccountsAvailable = false
+		}
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.Info("repaired item", zap.String("item_id", itemID))
+	if !itemExists(item.Products, "transactions") {
+		return nil
+	}
+	accessToken, err := s.store.Token(item)
+	if err != nil {
+		return err
+	}
+	return s.syncTransactions(ctx, itemID, accessToken)
+}
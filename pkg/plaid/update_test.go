@@ -0,0 +1,101 @@
+package plaid
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/uitachi123/go-plaid/pkg/db"
+)
+
+func Test_UpdateMode(t *testing.T) {
+	s, fake := newTestServer(t)
+	itemID := link(t, s, fake, "alice@test.com")
+	params := url.Values{"user": {"alice@test.com"}, "item_id": {itemID}}
+
+	// healthy items do not need to be re-authenticated
+	if code, resp := do(t, s, "POST", "/api/item/update", params); code != http.StatusConflict {
+		t.Errorf("Expected %v\tGot %v: %v", http.StatusConflict, code, resp)
+	}
+
+	fake.BreakItem(itemID, "ITEM_LOGIN_REQUIRED")
+	sendWebhook(t, s, fake, map[string]interface{}{
+		"webhook_type": "ITEM",
+		"webhook_code": "ERROR",
+		"item_id":      itemID,
+		"error":        map[string]interface{}{"error_type": "ITEM_ERROR", "error_code": "ITEM_LOGIN_REQUIRED", "error_message": "login required"},
+	})
+	if item, _ := s.store.GetItem(itemID); item.Status != db.ItemStatusError || item.ErrorCode != "ITEM_LOGIN_REQUIRED" {
+		t.Errorf("Expected a broken item, got %v", item)
+	}
+
+	code, resp := do(t, s, "POST", "/api/item/update", params)
+	if code != http.StatusOK || resp["link_token"] == nil {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusOK, code, resp)
+	}
+	sent := fake.LastRequest("/link/token/create")
+	if sent["access_token"] == nil || sent["products"] != nil {
+		t.Errorf("Expected an update mode link token request, got %v", sent)
+	}
+
+	// the user has not gone through Link yet
+	if code, resp := do(t, s, "POST", "/api/item/update/complete", params); code != http.StatusConflict || resp["error"].(map[string]interface{})["error_code"] != "ITEM_LOGIN_REQUIRED" {
+		t.Errorf("Expected %v\tGot %v: %v", http.StatusConflict, code, resp)
+	}
+	if transactions, _ := s.store.ListTransactions(itemID); len(transactions) != 0 {
+		t.Errorf("Expected no transactions synced, got %v", len(transactions))
+	}
+
+	fake.RepairItem(itemID)
+	code, resp = do(t, s, "POST", "/api/item/update/complete", params)
+	if code != http.StatusOK || resp["status"] != db.ItemStatusHealthy {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusOK, code, resp)
+	}
+	if item, _ := s.store.GetItem(itemID); item.Status != db.ItemStatusHealthy || item.ErrorCode != "" {
+		t.Errorf("Expected a healthy item, got %v", item)
+	}
+	if transactions, _ := s.store.ListTransactions(itemID); len(transactions) != 4 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 4, len(transactions))
+	}
+}
+
+func Test_UpdateModeWebhooks(t *testing.T) {
+	s, fake := newTestServer(t)
+	itemID := link(t, s, fake, "alice@test.com")
+	params := url.Values{"user": {"alice@test.com"}, "item_id": {itemID}}
+
+	sendWebhook(t, s, fake, map[string]interface{}{"webhook_type": "ITEM", "webhook_code": "PENDING_EXPIRATION", "item_id": itemID})
+	if item, _ := s.store.GetItem(itemID); item.Status != db.ItemStatusPendingExpiration {
+		t.Errorf("Data mismatch, expected:  %v got: %v", db.ItemStatusPendingExpiration, item.Status)
+	}
+	if code, resp := do(t, s, "POST", "/api/item/update", params); code != http.StatusOK {
+		t.Errorf("Expected %v\tGot %v: %v", http.StatusOK, code, resp)
+	}
+
+	// new accounts are added with account selection
+	sendWebhook(t, s, fake, map[string]interface{}{"webhook_type": "ITEM", "webhook_code": "NEW_ACCOUNTS_AVAILABLE", "item_id": itemID})
+	if item, _ := s.store.GetItem(itemID); !item.NewAccountsAvailable {
+		t.Errorf("Expected new accounts to be available, got %v", item)
+	}
+	selection := cloneValues(params)
+	selection.Set("account_selection", "true")
+	if code, resp := do(t, s, "POST", "/api/item/update", selection); code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusOK, code, resp)
+	}
+	update, _ := fake.LastRequest("/link/token/create")["update"].(map[string]interface{})
+	if update["account_selection_enabled"] != true {
+		t.Errorf("Expected account selection, got %v", update)
+	}
+
+	// items repaired outside of the app are healthy again
+	sendWebhook(t, s, fake, map[string]interface{}{"webhook_type": "ITEM", "webhook_code": "LOGIN_REPAIRED", "item_id": itemID})
+	if item, _ := s.store.GetItem(itemID); item.Status != db.ItemStatusHealthy || !item.NewAccountsAvailable {
+		t.Errorf("Expected a healthy item with new accounts, got %v", item)
+	}
+	if code, resp := do(t, s, "POST", "/api/item/update/complete", selection); code != http.StatusOK {
+		t.Fatalf("Expected %v\tGot %v: %v", http.StatusOK, code, resp)
+	}
+	if item, _ := s.store.GetItem(itemID); item.NewAccountsAvailable {
+		t.Errorf("Expected the new accounts to be selected, got %v", item)
+	}
+}
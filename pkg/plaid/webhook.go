@@ -0,0 +1,259 @@
+package plaid
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"github.com/uitachi123/go-plaid/pkg/api"
+	"github.com/uitachi123/go-plaid/pkg/db"
+	"github.com/uitachi123/go-plaid/pkg/webhook"
+	"go.uber.org/zap"
+)
+
+// maxWebhookSize caps the size of webhook bodies we are willing to read.
+const maxWebhookSize = 1 << 20
+
+// webhookPayload holds the fields of a Plaid webhook used to dispatch it.
+type webhookPayload struct {
+	WebhookType   string            `json:"webhook_type"`
+	WebhookCode   string            `json:"webhook_code"`
+	ItemID        string            `json:"item_id"`
+	Error         *plaid.PlaidError `json:"error"`
+	AssetReportID string            `json:"asset_report_id"`
+	// ConsentExpirationTime is set by ITEM PENDING_EXPIRATION webhooks.
+	ConsentExpirationTime *time.Time `json:"consent_expiration_time"`
+}
+
+type webhookHandler func(s *Server, ctx context.Context, p *webhookPayload) error
+
+// webhookHandlers maps webhook_type and webhook_code to their handler.
+var webhookHandlers = map[string]map[string]webhookHandler{
+	"TRANSACTIONS": {
+		"SYNC_UPDATES_AVAILABLE": (*Server).handleSyncUpdatesAvailable,
+	},
+	"ITEM": {
+		"ERROR":                   (*Server).handleItemError,
+		"USER_PERMISSION_REVOKED": (*Server).handleItemError,
+		"PENDING_EXPIRATION":      (*Server).handleItemPendingExpiration,
+		"NEW_ACCOUNTS_AVAILABLE":  (*Server).handleNewAccountsAvailable,
+		"LOGIN_REPAIRED":          (*Server).handleLoginRepaired,
+	},
+	"ASSETS": {
+		"PRODUCT_READY": (*Server).handleAssetsProductReady,
+		"ERROR":         (*Server).handleAssetsError,
+	},
+	"TRANSFER": {
+		"TRANSFER_EVENTS_UPDATE": (*Server).handleTransferEventsUpdate,
+	},
+}
+
+// Webhook receives webhooks from Plaid. The body is only trusted after its
+// Plaid-Verification JWT has been verified. Verified webhooks are
+// acknowledged right away and handled in the background, so Plaid does not
+// time out and resend them while e.g. transactions are synced.
+func (s *Server) Webhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.WriteError(w, api.MethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		api.WriteError(w, api.BadRequest("INVALID_BODY", err.Error()))
+		return
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+	if err := s.verifier.Verify(ctx, r.Header.Get("Plaid-Verification"), body); err != nil {
+		s.logger.Warn("rejected webhook", zap.Error(err))
+		api.WriteError(w, api.NewError(http.StatusUnauthorized, "INVALID_REQUEST", "INVALID_WEBHOOK_VERIFICATION", err.Error()))
+		return
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		api.WriteError(w, api.BadRequest("INVALID_BODY", err.Error()))
+		return
+	}
+	handler, ok := webhookHandlers[payload.WebhookType][payload.WebhookCode]
+	if !ok {
+		s.logger.Info("ignored webhook",
+			zap.String("webhook_type", payload.WebhookType),
+			zap.String("webhook_code", payload.WebhookCode),
+			zap.String("item_id", payload.ItemID),
+		)
+		io.WriteString(w, `{"received":true}`)
+		return
+	}
+	s.webhooks.Add(1)
+	go s.handleWebhook(handler, &payload)
+	io.WriteString(w, `{"received":true}`)
+}
+
+// handleWebhook runs the handler of a verified webhook until it is done or
+// the server is closed. Webhooks of items that are not stored, e.g. items
+// removed since, are ignored.
+func (s *Server) handleWebhook(handler webhookHandler, p *webhookPayload) {
+	defer s.webhooks.Done()
+	err := handler(s, s.ctx, p)
+	if err == db.ErrNotFound {
+		s.logger.Info("ignored webhook of unknown item",
+			zap.String("webhook_type", p.WebhookType),
+			zap.String("webhook_code", p.WebhookCode),
+			zap.String("item_id", p.ItemID),
+		)
+		return
+	}
+	if err != nil {
+		s.logger.Error("error handling webhook",
+			zap.String("webhook_type", p.WebhookType),
+			zap.String("webhook_code", p.WebhookCode),
+			zap.String("item_id", p.ItemID),
+			zap.Error(err),
+		)
+	}
+}
+
+// fetchVerificationKey gets a webhook verification key from Plaid.
+func (s *Server) fetchVerificationKey(ctx context.Context, kid string) (*webhook.Key, error) {
+	resp, _, err := s.client.PlaidApi.WebhookVerificationKeyGet(ctx).WebhookVerificationKeyGetRequest(
+		*plaid.NewWebhookVerificationKeyGetRequest(kid),
+	).Execute()
+	if err != nil {
+		return nil, err
+	}
+	jwk := resp.GetKey()
+	publicKey, err := webhook.PublicKey(jwk.Crv, jwk.X, jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+	key := &webhook.Key{PublicKey: publicKey}
+	if expiredAt := jwk.ExpiredAt.Get(); expiredAt != nil {
+		t := time.Unix(int64(*expiredAt), 0)
+		key.ExpiredAt = &t
+	}
+	return key, nil
+}
+
+// handleSyncUpdatesAvailable pulls the new transaction updates of the item
+// into the local store.
+func (s *Server) handleSyncUpdatesAvailable(ctx context.Context, p *webhookPayload) error {
+	item, err := s.store.GetItem(p.ItemID)
+	if err != nil {
+		return err
+	}
+	accessToken, err := s.store.Token(item)
+	if err != nil {
+		return err
+	}
+	return s.syncTransactions(ctx, item.ID, accessToken)
+}
+
+// handleItemError marks the item as broken so the user can be asked to
+// re-authenticate. Items whose user revoked their permission at the
+// institution are marked USER_PERMISSION_REVOKED when no error is given.
+func (s *Server) handleItemError(ctx context.Context, p *webhookPayload) error {
+	code := ""
+	if p.Error != nil {
+		code = p.Error.ErrorCode
+	} else if p.WebhookCode == "USER_PERMISSION_REVOKED" {
+		code = p.WebhookCode
+	}
+	s.logger.Warn("item error", zap.String("item_id", p.ItemID), zap.String("error_code", code))
+	_, err := s.store.UpdateItem(p.ItemID, func(item *db.Item) {
+		item.Status = db.ItemStatusError
+		if code != "" {
+			item.ErrorCode = code
+		}
+	})
+	return err
+}
+
+// handleItemPendingExpiration marks the item so the user can be asked to
+// renew its consent before it expires, and stores when it does.
+func (s *Server) handleItemPendingExpiration(ctx context.Context, p *webhookPayload) error {
+	_, err := s.store.UpdateItem(p.ItemID, func(item *db.Item) {
+		if p.ConsentExpirationTime != nil {
+			item.ConsentExpiresAt = p.ConsentExpirationTime
+		}
+		if item.Status == db.ItemStatusHealthy {
+			item.Status = db.ItemStatusPendingExpiration
+		}
+	})
+	return err
+}
+
+// handleNewAccountsAvailable marks the item so the user can be offered to
+// add the new accounts.
+func (s *Server) handleNewAccountsAvailable(ctx context.Context, p *webhookPayload) error {
+	_, err := s.store.UpdateItem(p.ItemID, func(item *db.Item) {
+		item.NewAccountsAvailable = true
+	})
+	return err
+}
+
+// handleLoginRepaired marks the item healthy again after its user fixed it
+// outside of this app, and resumes syncing.
+func (s *Server) handleLoginRepaired(ctx context.Context, p *webhookPayload) error {
+	return s.repairItem(ctx, p.ItemID, false)
+}
+
+// handleAssetsProductReady fetches the report of the asset report job.
+// Reports created outside of a job are ignored.
+func (s *Server) handleAssetsProductReady(ctx context.Context, p *webhookPayload) error {
+	job, err := s.store.FindAssetReport(p.AssetReportID)
+	if err == db.ErrNotFound {
+		s.logger.Info("ignored unknown asset report", zap.String("asset_report_id", p.AssetReportID))
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if job.Status == db.AssetReportStatusReady {
+		return nil
+	}
+	return s.fetchAssetReport(ctx, job)
+}
+
+// handleAssetsError marks the asset report job as failed.
+func (s *Server) handleAssetsError(ctx context.Context, p *webhookPayload) error {
+	job, err := s.store.FindAssetReport(p.AssetReportID)
+	if err == db.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var reportErr error = api.NewError(http.StatusBadGateway, "ASSET_REPORT_ERROR", "ASSET_REPORT_GENERATION_FAILED", "asset report generation failed")
+	if p.Error != nil {
+		reportErr = api.NewError(http.StatusBadGateway, p.Error.ErrorType, p.Error.ErrorCode, p.Error.ErrorMessage)
+	}
+	s.failAssetReport(job, reportErr)
+	return nil
+}
+
+func (s *Server) handleTransferEventsUpdate(ctx context.Context, p *webhookPayload) error {
+	s.transferEvents.Lock()
+	defer s.transferEvents.Unlock()
+	for {
+		resp, _, err := s.client.PlaidApi.TransferEventSync(ctx).TransferEventSyncRequest(
+			*plaid.NewTransferEventSyncRequest(s.transferEvents.afterID),
+		).Execute()
+		if err != nil {
+			return err
+		}
+		events := resp.GetTransferEvents()
+		if len(events) == 0 {
+			return nil
+		}
+		for _, event := range events {
+			s.logger.Info("transfer event",
+				zap.String("transfer_id", event.GetTransferId()),
+				zap.String("event_type", string(event.GetEventType())),
+			)
+			s.transferEvents.afterID = event.GetEventId()
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package plaidfake
+
+import "time"
+
+// Account is an account of the fake institution.
+type Account struct {
+	ID        string
+	Name      string
+	Type      string
+	Subtype   string
+	Mask      string
+	Current   float64
+	Available float64
+	Currency  string
+	// Routing numbers returned by /auth/get
+	AccountNumber string
+	RoutingNumber string
+	// Owner returned by /identity/get
+	OwnerName  string
+	OwnerEmail string
+}
+
+// Transaction is a transaction returned by /transactions/sync.
+type Transaction struct {
+	ID           string
+	AccountID    string
+	Amount       float64
+	Currency     string
+	Date         string
+	Name         string
+	MerchantName string
+	Category     []string
+	Pending      bool
+}
+
+// SyncPage is one page of /transactions/sync updates.
+type SyncPage struct {
+	Added    []Transaction
+	Modified []Transaction
+	Removed  []string
+}
+
+// Holding is an investment holding returned by /investments/holdings/get.
+type Holding struct {
+	AccountID  string
+	SecurityID string
+	Ticker     string
+	Name       string
+	Quantity   float64
+	Price      float64
+}
+
+// Fixtures is the data served by the fake. Every linked item sees the same
+// fixtures.
+type Fixtures struct {
+	// InstitutionID is the institution of the items, which have none when
+	// it is empty.
+	InstitutionID   string
+	InstitutionName string
+	Accounts        []Account
+	// SyncPages are served in order by /transactions/sync; the cursor of a
+	// page is its index, so pages appended later are picked up by the next
+	// sync from the last cursor.
+	SyncPages []SyncPage
+	Holdings  []Holding
+	// AssetReportPolls is how many /asset_report/get calls answer
+	// PRODUCT_NOT_READY before the report is ready.
+	AssetReportPolls int
+	AssetReportPDF   []byte
+	// ConsentExpiration is the consent_expiration_time of items, if set.
+	ConsentExpiration time.Time
+	// BilledProducts are the billed_products of items.
+	BilledProducts []string
+	// TransferDeclined makes /transfer/authorization/create decline
+	// transfers.
+	TransferDeclined bool
+}
+
+// DefaultFixtures returns a checking and a savings account with a few
+// transactions split over two sync pages.
+func DefaultFixtures() Fixtures {
+	return Fixtures{
+		InstitutionID:   "ins_109508",
+		InstitutionName: "First Platypus Bank",
+		Accounts: []Account{
+			{
+				ID: "acc-checking", Name: "Plaid Checking", Type: "depository", Subtype: "checking", Mask: "0000",
+				Current: 110, Available: 100, Currency: "USD",
+				AccountNumber: "1111222233330000", RoutingNumber: "011401533",
+				OwnerName: "Alberta Bobbeth Charleson", OwnerEmail: "accountholder0@example.com",
+			},
+			{
+				ID: "acc-savings", Name: "Plaid Saving", Type: "depository", Subtype: "savings", Mask: "1111",
+				Current: 210, Available: 200, Currency: "USD",
+				AccountNumber: "1111222233331111", RoutingNumber: "011401533",
+				OwnerName: "Alberta Bobbeth Charleson", OwnerEmail: "accountholder0@example.com",
+			},
+		},
+		SyncPages: []SyncPage{
+			{Added: []Transaction{
+				{ID: "tx-1", AccountID: "acc-checking", Amount: 6.33, Currency: "USD", Date: "2022-05-01", Name: "Uber 072515 SF**POOL**", MerchantName: "Uber", Category: []string{"Travel", "Taxi"}},
+				{ID: "tx-2", AccountID: "acc-checking", Amount: 500, Currency: "USD", Date: "2022-05-02", Name: "United Airlines", MerchantName: "United Airlines", Category: []string{"Travel", "Airlines and Aviation Services"}},
+			}},
+			{Added: []Transaction{
+				{ID: "tx-3", AccountID: "acc-checking", Amount: 4.33, Currency: "USD", Date: "2022-05-03", Name: "Starbucks", MerchantName: "Starbucks", Category: []string{"Food and Drink", "Restaurants", "Coffee Shop"}},
+				{ID: "tx-4", AccountID: "acc-savings", Amount: -25, Currency: "USD", Date: "2022-05-04", Name: "INTRST PYMNT", Category: []string{"Transfer", "Credit"}},
+			}},
+		},
+		Holdings: []Holding{
+			{AccountID: "acc-checking", SecurityID: "sec-1", Ticker: "ACME", Name: "Acme Corp", Quantity: 10, Price: 42.5},
+		},
+		AssetReportPolls: 1,
+		AssetReportPDF:   []byte("%PDF-1.4\n% fake asset report\n"),
+		BilledProducts:   []string{"transactions", "auth"},
+	}
+}
@@ -0,0 +1,842 @@
+// Package plaidfake is an in-process fake of the Plaid API for offline
+// development and tests. It serves the endpoints used by pkg/plaid from
+// scriptable fixtures, and lets callers inject Plaid errors.
+package plaidfake
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Error is a Plaid error returned by an endpoint.
+type Error struct {
+	Status         int    `json:"-"`
+	ErrorType      string `json:"error_type"`
+	ErrorCode      string `json:"error_code"`
+	ErrorMessage   string `json:"error_message"`
+	DisplayMessage string `json:"display_message"`
+	RequestID      string `json:"request_id"`
+}
+
+// Server is a fake Plaid API served over HTTP.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	fixtures Fixtures
+	// failures holds errors queued per endpoint path
+	failures map[string][]Error
+	calls    map[string]int
+	// requests holds the last request body of each endpoint path
+	requests map[string]map[string]interface{}
+	seq      int
+	// publicTokens and accessTokens map tokens to item ids
+	publicTokens map[string]string
+	accessTokens map[string]string
+	// itemErrors holds the error codes of broken items by item id
+	itemErrors map[string]string
+	// assetPolls counts the polls of each asset report token, and
+	// auditCopies maps audit copy tokens to their asset report token
+	assetPolls  map[string]int
+	auditCopies map[string]string
+	webhookKey  *ecdsa.PrivateKey
+}
+
+type handler func(s *Server, req map[string]interface{}) (interface{}, *Error)
+
+// routes maps Plaid endpoint paths to their fake implementation.
+var routes = map[string]handler{
+	"/link/token/create":                   (*Server).linkTokenCreate,
+	"/sandbox/public_token/create":         (*Server).sandboxPublicTokenCreate,
+	"/item/public_token/exchange":          (*Server).itemPublicTokenExchange,
+	"/item/public_token/create":            (*Server).itemPublicTokenCreate,
+	"/item/get":                            (*Server).itemGet,
+	"/item/remove":                         (*Server).itemRemove,
+	"/institutions/get_by_id":              (*Server).institutionsGetByID,
+	"/accounts/get":                        (*Server).accountsGet,
+	"/accounts/balance/get":                (*Server).accountsGet,
+	"/auth/get":                            (*Server).authGet,
+	"/identity/get":                        (*Server).identityGet,
+	"/transactions/sync":                   (*Server).transactionsSync,
+	"/investments/holdings/get":            (*Server).investmentsHoldingsGet,
+	"/investments/transactions/get":        (*Server).investmentsTransactionsGet,
+	"/asset_report/create":                 (*Server).assetReportCreate,
+	"/asset_report/get":                    (*Server).assetReportGet,
+	"/asset_report/pdf/get":                (*Server).assetReportPDFGet,
+	"/asset_report/refresh":                (*Server).assetReportRefresh,
+	"/asset_report/filter":                 (*Server).assetReportFilter,
+	"/asset_report/remove":                 (*Server).assetReportRemove,
+	"/asset_report/audit_copy/create":      (*Server).assetReportAuditCopyCreate,
+	"/asset_report/audit_copy/remove":      (*Server).assetReportAuditCopyRemove,
+	"/transfer/authorization/create":       (*Server).transferAuthorizationCreate,
+	"/transfer/create":                     (*Server).transferCreate,
+	"/transfer/get":                        (*Server).transferGet,
+	"/transfer/event/sync":                 (*Server).transferEventSync,
+	"/payment_initiation/recipient/create": (*Server).paymentRecipientCreate,
+	"/payment_initiation/payment/create":   (*Server).paymentCreate,
+	"/payment_initiation/payment/get":      (*Server).paymentGet,
+	"/webhook_verification_key/get":        (*Server).webhookVerificationKeyGet,
+}
+
+// NewServer starts a fake Plaid API serving DefaultFixtures. Close it when
+// done.
+func NewServer() *Server {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{
+		fixtures:     DefaultFixtures(),
+		failures:     map[string][]Error{},
+		calls:        map[string]int{},
+		requests:     map[string]map[string]interface{}{},
+		publicTokens: map[string]string{},
+		accessTokens: map[string]string{},
+		itemErrors:   map[string]string{},
+		assetPolls:   map[string]int{},
+		auditCopies:  map[string]string{},
+		webhookKey:   key,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Update changes the fixtures served from now on.
+func (s *Server) Update(fn func(f *Fixtures)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.fixtures)
+}
+
+// FailNext makes the next call to the endpoint at path return e. Calls to
+// FailNext queue up.
+func (s *Server) FailNext(path string, e Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.Status == 0 {
+		e.Status = http.StatusBadRequest
+	}
+	if e.ErrorMessage == "" {
+		e.ErrorMessage = e.ErrorCode
+	}
+	s.failures[path] = append(s.failures[path], e)
+}
+
+// Calls returns how many times the endpoint at path was called.
+func (s *Server) Calls(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[path]
+}
+
+// LastRequest returns the body of the last successfully decoded request to
+// the endpoint at path, or nil if there is none.
+func (s *Server) LastRequest(path string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// BreakItem makes the calls reading the data of an item fail with an
+// ITEM_ERROR of the given code, e.g. ITEM_LOGIN_REQUIRED, and /item/get
+// report that error, until RepairItem is called.
+func (s *Server) BreakItem(itemID, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.itemErrors[itemID] = code
+}
+
+// RepairItem clears the error of an item, as when its user goes through
+// Link in update mode.
+func (s *Server) RepairItem(itemID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.itemErrors, itemID)
+}
+
+// LinkItem creates an item as if a user went through Link and returns its
+// public token.
+func (s *Server) LinkItem() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.newPublicToken(s.newID("item"))
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[r.URL.Path]++
+	s.seq++
+	requestID := "req-" + strconv.Itoa(s.seq)
+
+	route, ok := routes[r.URL.Path]
+	if !ok {
+		s.writeError(w, Error{Status: http.StatusNotFound, ErrorType: "INVALID_REQUEST", ErrorCode: "UNKNOWN_FIELDS", ErrorMessage: "unknown endpoint " + r.URL.Path}, requestID)
+		return
+	}
+	if r.Header.Get("PLAID-CLIENT-ID") == "" || r.Header.Get("PLAID-SECRET") == "" {
+		s.writeError(w, Error{Status: http.StatusBadRequest, ErrorType: "INVALID_INPUT", ErrorCode: "INVALID_API_KEYS", ErrorMessage: "invalid client_id or secret provided"}, requestID)
+		return
+	}
+	if queued := s.failures[r.URL.Path]; len(queued) > 0 {
+		s.failures[r.URL.Path] = queued[1:]
+		s.writeError(w, queued[0], requestID)
+		return
+	}
+	req := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, Error{Status: http.StatusBadRequest, ErrorType: "INVALID_REQUEST", ErrorCode: "INVALID_BODY", ErrorMessage: err.Error()}, requestID)
+		return
+	}
+	s.requests[r.URL.Path] = req
+	if e := s.itemError(r.URL.Path, req); e != nil {
+		s.writeError(w, *e, requestID)
+		return
+	}
+	resp, e := route(s, req)
+	if e != nil {
+		s.writeError(w, *e, requestID)
+		return
+	}
+	if pdf, ok := resp.([]byte); ok {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write(pdf)
+		return
+	}
+	if m, ok := resp.(map[string]interface{}); ok {
+		m["request_id"] = requestID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, e Error, requestID string) {
+	e.RequestID = requestID
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(e)
+}
+
+func (s *Server) newID(prefix string) string {
+	s.seq++
+	return prefix + "-sandbox-" + strconv.Itoa(s.seq)
+}
+
+func (s *Server) newPublicToken(itemID string) string {
+	token := s.newID("public")
+	s.publicTokens[token] = itemID
+	return token
+}
+
+func invalidInput(code, message string) *Error {
+	return &Error{Status: http.StatusBadRequest, ErrorType: "INVALID_INPUT", ErrorCode: code, ErrorMessage: message}
+}
+
+// item returns the item of the access token of a request.
+func (s *Server) item(req map[string]interface{}) (string, *Error) {
+	token, _ := req["access_token"].(string)
+	itemID, ok := s.accessTokens[token]
+	if !ok {
+		return "", invalidInput("INVALID_ACCESS_TOKEN", "provided access token is in an invalid format")
+	}
+	return itemID, nil
+}
+
+// itemManagementPaths are the endpoints still working for broken items.
+var itemManagementPaths = map[string]bool{
+	"/item/get":                 true,
+	"/item/remove":              true,
+	"/item/public_token/create": true,
+	"/link/token/create":        true,
+	"/asset_report/remove":      true,
+}
+
+// itemError returns the error of the broken item of the access token of a
+// request to the endpoint at path, if any.
+func (s *Server) itemError(path string, req map[string]interface{}) *Error {
+	token, _ := req["access_token"].(string)
+	code, broken := s.itemErrors[s.accessTokens[token]]
+	if !broken || itemManagementPaths[path] {
+		return nil
+	}
+	return brokenItemError(code)
+}
+
+func brokenItemError(code string) *Error {
+	return &Error{Status: http.StatusBadRequest, ErrorType: "ITEM_ERROR", ErrorCode: code, ErrorMessage: "the item is in an error state: " + code}
+}
+
+func (s *Server) itemJSON(itemID string) map[string]interface{} {
+	var itemErr, consentExpiration, institutionID interface{}
+	if s.fixtures.InstitutionID != "" {
+		institutionID = s.fixtures.InstitutionID
+	}
+	if code, broken := s.itemErrors[itemID]; broken {
+		itemErr = brokenItemError(code)
+	}
+	if !s.fixtures.ConsentExpiration.IsZero() {
+		consentExpiration = s.fixtures.ConsentExpiration.Format(time.RFC3339)
+	}
+	return map[string]interface{}{
+		"item_id":                 itemID,
+		"institution_id":          institutionID,
+		"webhook":                 "",
+		"error":                   itemErr,
+		"available_products":      []string{"assets", "auth", "identity", "investments"},
+		"billed_products":         s.fixtures.BilledProducts,
+		"consent_expiration_time": consentExpiration,
+		"update_type":             "background",
+	}
+}
+
+// accounts returns the accounts selected by options.account_ids, or all.
+func (s *Server) accounts(req map[string]interface{}) []Account {
+	options, _ := req["options"].(map[string]interface{})
+	ids, _ := options["account_ids"].([]interface{})
+	if len(ids) == 0 {
+		return s.fixtures.Accounts
+	}
+	var res []Account
+	for _, a := range s.fixtures.Accounts {
+		for _, id := range ids {
+			if id == a.ID {
+				res = append(res, a)
+			}
+		}
+	}
+	return res
+}
+
+func accountJSON(a Account) map[string]interface{} {
+	return map[string]interface{}{
+		"account_id": a.ID,
+		"balances": map[string]interface{}{
+			"available":         a.Available,
+			"current":           a.Current,
+			"limit":             nil,
+			"iso_currency_code": a.Currency,
+		},
+		"mask":          a.Mask,
+		"name":          a.Name,
+		"official_name": a.Name,
+		"type":          a.Type,
+		"subtype":       a.Subtype,
+	}
+}
+
+func transactionJSON(t Transaction) map[string]interface{} {
+	return map[string]interface{}{
+		"transaction_id":    t.ID,
+		"account_id":        t.AccountID,
+		"amount":            t.Amount,
+		"iso_currency_code": t.Currency,
+		"date":              t.Date,
+		"name":              t.Name,
+		"merchant_name":     t.MerchantName,
+		"category":          t.Category,
+		"pending":           t.Pending,
+		"payment_channel":   "in store",
+		"location":          map[string]interface{}{},
+		"payment_meta":      map[string]interface{}{},
+	}
+}
+
+func (s *Server) linkTokenCreate(req map[string]interface{}) (interface{}, *Error) {
+	return map[string]interface{}{
+		"link_token": s.newID("link"),
+		"expiration": time.Now().Add(4 * time.Hour).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (s *Server) sandboxPublicTokenCreate(req map[string]interface{}) (interface{}, *Error) {
+	return map[string]interface{}{
+		"public_token": s.newPublicToken(s.newID("item")),
+	}, nil
+}
+
+func (s *Server) itemPublicTokenExchange(req map[string]interface{}) (interface{}, *Error) {
+	token, _ := req["public_token"].(string)
+	itemID, ok := s.publicTokens[token]
+	if !ok {
+		return nil, invalidInput("INVALID_PUBLIC_TOKEN", "provided public token is in an invalid format")
+	}
+	delete(s.publicTokens, token)
+	accessToken := s.newID("access")
+	s.accessTokens[accessToken] = itemID
+	return map[string]interface{}{
+		"access_token": accessToken,
+		"item_id":      itemID,
+	}, nil
+}
+
+func (s *Server) itemPublicTokenCreate(req map[string]interface{}) (interface{}, *Error) {
+	itemID, e := s.item(req)
+	if e != nil {
+		return nil, e
+	}
+	return map[string]interface{}{
+		"public_token": s.newPublicToken(itemID),
+		"expiration":   time.Now().Add(30 * time.Minute).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (s *Server) itemGet(req map[string]interface{}) (interface{}, *Error) {
+	itemID, e := s.item(req)
+	if e != nil {
+		return nil, e
+	}
+	return map[string]interface{}{
+		"item":   s.itemJSON(itemID),
+		"status": nil,
+	}, nil
+}
+
+func (s *Server) itemRemove(req map[string]interface{}) (interface{}, *Error) {
+	token, _ := req["access_token"].(string)
+	if _, e := s.item(req); e != nil {
+		return nil, e
+	}
+	delete(s.accessTokens, token)
+	return map[string]interface{}{}, nil
+}
+
+func (s *Server) institutionsGetByID(req map[string]interface{}) (interface{}, *Error) {
+	id, _ := req["institution_id"].(string)
+	if id != s.fixtures.InstitutionID {
+		return nil, invalidInput("INVALID_INSTITUTION", "invalid institution_id provided")
+	}
+	return map[string]interface{}{
+		"institution": map[string]interface{}{
+			"institution_id":  id,
+			"name":            s.fixtures.InstitutionName,
+			"products":        []string{"assets", "auth", "identity", "investments", "transactions"},
+			"country_codes":   []string{"US"},
+			"routing_numbers": []string{},
+			"oauth":           false,
+		},
+	}, nil
+}
+
+func (s *Server) accountsGet(req map[string]interface{}) (interface{}, *Error) {
+	itemID, e := s.item(req)
+	if e != nil {
+		return nil, e
+	}
+	accounts := []interface{}{}
+	for _, a := range s.accounts(req) {
+		accounts = append(accounts, accountJSON(a))
+	}
+	return map[string]interface{}{
+		"accounts": accounts,
+		"item":     s.itemJSON(itemID),
+	}, nil
+}
+
+func (s *Server) authGet(req map[string]interface{}) (interface{}, *Error) {
+	itemID, e := s.item(req)
+	if e != nil {
+		return nil, e
+	}
+	accounts, ach := []interface{}{}, []interface{}{}
+	for _, a := range s.accounts(req) {
+		accounts = append(accounts, accountJSON(a))
+		ach = append(ach, map[string]interface{}{
+			"account_id":   a.ID,
+			"account":      a.AccountNumber,
+			"routing":      a.RoutingNumber,
+			"wire_routing": a.RoutingNumber,
+		})
+	}
+	return map[string]interface{}{
+		"accounts": accounts,
+		"numbers": map[string]interface{}{
+			"ach":           ach,
+			"eft":           []interface{}{},
+			"international": []interface{}{},
+			"bacs":          []interface{}{},
+		},
+		"item": s.itemJSON(itemID),
+	}, nil
+}
+
+func (s *Server) identityGet(req map[string]interface{}) (interface{}, *Error) {
+	itemID, e := s.item(req)
+	if e != nil {
+		return nil, e
+	}
+	accounts := []interface{}{}
+	for _, a := range s.accounts(req) {
+		account := accountJSON(a)
+		account["owners"] = []interface{}{map[string]interface{}{
+			"names":         []string{a.OwnerName},
+			"emails":        []interface{}{map[string]interface{}{"data": a.OwnerEmail, "primary": true, "type": "primary"}},
+			"phone_numbers": []interface{}{},
+			"addresses":     []interface{}{},
+		}}
+		accounts = append(accounts, account)
+	}
+	return map[string]interface{}{
+		"accounts": accounts,
+		"item":     s.itemJSON(itemID),
+	}, nil
+}
+
+func (s *Server) transactionsSync(req map[string]interface{}) (interface{}, *Error) {
+	if _, e := s.item(req); e != nil {
+		return nil, e
+	}
+	page := 0
+	if cursor, _ := req["cursor"].(string); cursor != "" {
+		var err error
+		if page, err = strconv.Atoi(cursor); err != nil || page < 0 || page > len(s.fixtures.SyncPages) {
+			return nil, invalidInput("INVALID_FIELD", "cursor is invalid")
+		}
+	}
+	added, modified, removed := []interface{}{}, []interface{}{}, []interface{}{}
+	next := page
+	if page < len(s.fixtures.SyncPages) {
+		p := s.fixtures.SyncPages[page]
+		for _, t := range p.Added {
+			added = append(added, transactionJSON(t))
+		}
+		for _, t := range p.Modified {
+			modified = append(modified, transactionJSON(t))
+		}
+		for _, id := range p.Removed {
+			removed = append(removed, map[string]interface{}{"transaction_id": id})
+		}
+		next++
+	}
+	return map[string]interface{}{
+		"added":       added,
+		"modified":    modified,
+		"removed":     removed,
+		"next_cursor": strconv.Itoa(next),
+		"has_more":    next < len(s.fixtures.SyncPages),
+	}, nil
+}
+
+func (s *Server) investments() ([]interface{}, []interface{}) {
+	holdings, securities := []interface{}{}, []interface{}{}
+	for _, h := range s.fixtures.Holdings {
+		holdings = append(holdings, map[string]interface{}{
+			"account_id":              h.AccountID,
+			"security_id":             h.SecurityID,
+			"institution_price":       h.Price,
+			"institution_value":       h.Price * h.Quantity,
+			"quantity":                h.Quantity,
+			"iso_currency_code":       "USD",
+			"cost_basis":              nil,
+			"institution_price_as_of": nil,
+		})
+		securities = append(securities, map[string]interface{}{
+			"security_id":       h.SecurityID,
+			"name":              h.Name,
+			"ticker_symbol":     h.Ticker,
+			"type":              "equity",
+			"close_price":       h.Price,
+			"iso_currency_code": "USD",
+		})
+	}
+	return holdings, securities
+}
+
+func (s *Server) investmentsHoldingsGet(req map[string]interface{}) (interface{}, *Error) {
+	itemID, e := s.item(req)
+	if e != nil {
+		return nil, e
+	}
+	accounts := []interface{}{}
+	for _, a := range s.accounts(req) {
+		accounts = append(accounts, accountJSON(a))
+	}
+	holdings, securities := s.investments()
+	return map[string]interface{}{
+		"accounts":   accounts,
+		"holdings":   holdings,
+		"securities": securities,
+		"item":       s.itemJSON(itemID),
+	}, nil
+}
+
+func (s *Server) investmentsTransactionsGet(req map[string]interface{}) (interface{}, *Error) {
+	itemID, e := s.item(req)
+	if e != nil {
+		return nil, e
+	}
+	accounts := []interface{}{}
+	for _, a := range s.accounts(req) {
+		accounts = append(accounts, accountJSON(a))
+	}
+	_, securities := s.investments()
+	return map[string]interface{}{
+		"accounts":                      accounts,
+		"investment_transactions":       []interface{}{},
+		"securities":                    securities,
+		"total_investment_transactions": 0,
+		"item":                          s.itemJSON(itemID),
+	}, nil
+}
+
+func (s *Server) assetReportCreate(req map[string]interface{}) (interface{}, *Error) {
+	tokens, _ := req["access_tokens"].([]interface{})
+	if len(tokens) == 0 {
+		return nil, invalidInput("INVALID_FIELD", "access_tokens must not be empty")
+	}
+	for _, token := range tokens {
+		if _, e := s.item(map[string]interface{}{"access_token": token}); e != nil {
+			return nil, e
+		}
+	}
+	return s.newAssetReport(), nil
+}
+
+// newAssetReport creates an asset report token and returns it with a new
+// asset_report_id.
+func (s *Server) newAssetReport() map[string]interface{} {
+	token := s.newID("assets")
+	s.assetPolls[token] = 0
+	return map[string]interface{}{
+		"asset_report_token": token,
+		"asset_report_id":    s.newID("report"),
+	}
+}
+
+// knownAssetReport checks the asset report token of a request, ready or not.
+func (s *Server) knownAssetReport(req map[string]interface{}) (string, *Error) {
+	token, _ := req["asset_report_token"].(string)
+	if _, ok := s.assetPolls[token]; !ok {
+		return "", invalidInput("INVALID_ASSET_REPORT_TOKEN", "provided asset report token is invalid")
+	}
+	return token, nil
+}
+
+func (s *Server) assetReportRefresh(req map[string]interface{}) (interface{}, *Error) {
+	if _, e := s.knownAssetReport(req); e != nil {
+		return nil, e
+	}
+	return s.newAssetReport(), nil
+}
+
+func (s *Server) assetReportFilter(req map[string]interface{}) (interface{}, *Error) {
+	if _, e := s.assetReport(req); e != nil {
+		return nil, e
+	}
+	if _, ok := req["account_ids_to_exclude"].([]interface{}); !ok {
+		return nil, invalidInput("INVALID_FIELD", "account_ids_to_exclude must be an array")
+	}
+	return s.newAssetReport(), nil
+}
+
+func (s *Server) assetReportRemove(req map[string]interface{}) (interface{}, *Error) {
+	token, e := s.knownAssetReport(req)
+	if e != nil {
+		return nil, e
+	}
+	delete(s.assetPolls, token)
+	for auditCopy, reportToken := range s.auditCopies {
+		if reportToken == token {
+			delete(s.auditCopies, auditCopy)
+		}
+	}
+	return map[string]interface{}{"removed": true}, nil
+}
+
+func (s *Server) assetReportAuditCopyCreate(req map[string]interface{}) (interface{}, *Error) {
+	token, e := s.assetReport(req)
+	if e != nil {
+		return nil, e
+	}
+	if auditor, _ := req["auditor_id"].(string); auditor == "" {
+		return nil, invalidInput("INVALID_FIELD", "auditor_id must be set")
+	}
+	auditCopy := s.newID("a")
+	s.auditCopies[auditCopy] = token
+	return map[string]interface{}{"audit_copy_token": auditCopy}, nil
+}
+
+func (s *Server) assetReportAuditCopyRemove(req map[string]interface{}) (interface{}, *Error) {
+	auditCopy, _ := req["audit_copy_token"].(string)
+	if _, ok := s.auditCopies[auditCopy]; !ok {
+		return nil, invalidInput("INVALID_AUDIT_COPY_TOKEN", "provided audit copy token is invalid")
+	}
+	delete(s.auditCopies, auditCopy)
+	return map[string]interface{}{"removed": true}, nil
+}
+
+// assetReport checks the asset report token of a request and answers
+// PRODUCT_NOT_READY for the first AssetReportPolls calls.
+func (s *Server) assetReport(req map[string]interface{}) (string, *Error) {
+	token, e := s.knownAssetReport(req)
+	if e != nil {
+		return "", e
+	}
+	if s.assetPolls[token] < s.fixtures.AssetReportPolls {
+		s.assetPolls[token]++
+		return "", &Error{Status: http.StatusBadRequest, ErrorType: "ASSET_REPORT_ERROR", ErrorCode: "PRODUCT_NOT_READY", ErrorMessage: "the requested product is not yet ready"}
+	}
+	return token, nil
+}
+
+func (s *Server) assetReportPDFGet(req map[string]interface{}) (interface{}, *Error) {
+	if _, e := s.assetReport(req); e != nil {
+		return nil, e
+	}
+	return s.fixtures.AssetReportPDF, nil
+}
+
+func (s *Server) assetReportGet(req map[string]interface{}) (interface{}, *Error) {
+	token, e := s.assetReport(req)
+	if e != nil {
+		return nil, e
+	}
+	return map[string]interface{}{
+		"report": map[string]interface{}{
+			"asset_report_id":  token,
+			"client_report_id": nil,
+			"date_generated":   time.Now().UTC().Format(time.RFC3339),
+			"days_requested":   10,
+			"user":             map[string]interface{}{},
+			"items":            []interface{}{},
+		},
+		"warnings": []interface{}{},
+	}, nil
+}
+
+func (s *Server) transferAuthorizationCreate(req map[string]interface{}) (interface{}, *Error) {
+	if _, e := s.item(req); e != nil {
+		return nil, e
+	}
+	decision := "approved"
+	if s.fixtures.TransferDeclined {
+		decision = "declined"
+	}
+	return map[string]interface{}{
+		"authorization": map[string]interface{}{
+			"id":                 s.newID("authorization"),
+			"created":            time.Now().UTC().Format(time.RFC3339),
+			"decision":           decision,
+			"decision_rationale": nil,
+			"proposed_transfer":  req,
+		},
+	}, nil
+}
+
+func (s *Server) transferJSON(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          id,
+		"type":        "credit",
+		"amount":      "1.34",
+		"description": "Payment",
+		"status":      "pending",
+		"network":     "ach",
+		"created":     time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func (s *Server) transferCreate(req map[string]interface{}) (interface{}, *Error) {
+	if _, e := s.item(req); e != nil {
+		return nil, e
+	}
+	return map[string]interface{}{
+		"transfer": s.transferJSON(s.newID("transfer")),
+	}, nil
+}
+
+func (s *Server) transferGet(req map[string]interface{}) (interface{}, *Error) {
+	id, _ := req["transfer_id"].(string)
+	if id == "" {
+		return nil, invalidInput("INVALID_FIELD", "transfer_id must not be empty")
+	}
+	return map[string]interface{}{
+		"transfer": s.transferJSON(id),
+	}, nil
+}
+
+func (s *Server) transferEventSync(req map[string]interface{}) (interface{}, *Error) {
+	return map[string]interface{}{
+		"transfer_events": []interface{}{},
+	}, nil
+}
+
+func (s *Server) paymentRecipientCreate(req map[string]interface{}) (interface{}, *Error) {
+	return map[string]interface{}{
+		"recipient_id": s.newID("recipient"),
+	}, nil
+}
+
+func (s *Server) paymentCreate(req map[string]interface{}) (interface{}, *Error) {
+	return map[string]interface{}{
+		"payment_id": s.newID("payment"),
+		"status":     "PAYMENT_STATUS_INPUT_NEEDED",
+	}, nil
+}
+
+func (s *Server) paymentGet(req map[string]interface{}) (interface{}, *Error) {
+	id, _ := req["payment_id"].(string)
+	if id == "" {
+		return nil, invalidInput("INVALID_FIELD", "payment_id must not be empty")
+	}
+	return map[string]interface{}{
+		"payment_id":   id,
+		"reference":    "paymentRef",
+		"amount":       map[string]interface{}{"currency": "GBP", "value": 1.34},
+		"status":       "PAYMENT_STATUS_INITIATED",
+		"recipient_id": "recipient",
+	}, nil
+}
+
+// webhookKeyID is the key id of the key signing fake webhooks.
+const webhookKeyID = "plaidfake-key"
+
+func (s *Server) webhookVerificationKeyGet(req map[string]interface{}) (interface{}, *Error) {
+	if kid, _ := req["key_id"].(string); kid != webhookKeyID {
+		return nil, invalidInput("INVALID_WEBHOOK_VERIFICATION_KEY_ID", "invalid key_id provided")
+	}
+	pub := s.webhookKey.PublicKey
+	return map[string]interface{}{
+		"key": map[string]interface{}{
+			"alg":        "ES256",
+			"crv":        "P-256",
+			"kid":        webhookKeyID,
+			"kty":        "EC",
+			"use":        "sig",
+			"x":          base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+			"y":          base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+			"created_at": time.Now().Add(-time.Hour).Unix(),
+			"expired_at": nil,
+		},
+	}, nil
+}
+
+// SignWebhook returns the Plaid-Verification header value Plaid would send
+// along with a webhook body.
+func (s *Server) SignWebhook(body []byte) string {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": webhookKeyID, "typ": "JWT"})
+	sum := sha256.Sum256(body)
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat":                 time.Now().Unix(),
+		"request_body_sha256": hex.EncodeToString(sum[:]),
+	})
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, sig, err := ecdsa.Sign(rand.Reader, s.webhookKey, digest[:])
+	if err != nil {
+		panic(fmt.Sprintf("signing webhook: %v", err))
+	}
+	b := make([]byte, 64)
+	r.FillBytes(b[:32])
+	sig.FillBytes(b[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(b)
+}
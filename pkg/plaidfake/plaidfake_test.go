@@ -0,0 +1,285 @@
+package plaidfake
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	plaid "github.com/plaid/plaid-go/v3/plaid"
+	"github.com/uitachi123/go-plaid/pkg/webhook"
+)
+
+func newClient(s *Server) *plaid.APIClient {
+	configuration := plaid.NewConfiguration()
+	configuration.AddDefaultHeader("PLAID-CLIENT-ID", "client")
+	configuration.AddDefaultHeader("PLAID-SECRET", "secret")
+	configuration.Servers = plaid.ServerConfigurations{{URL: s.URL}}
+	return plaid.NewAPIClient(configuration)
+}
+
+func link(t *testing.T, s *Server, client *plaid.APIClient) string {
+	t.Helper()
+	resp, _, err := client.PlaidApi.ItemPublicTokenExchange(context.Background()).ItemPublicTokenExchangeRequest(
+		*plaid.NewItemPublicTokenExchangeRequest(s.LinkItem()),
+	).Execute()
+	if err != nil {
+		t.Fatalf("error exchanging public token: %v", err)
+	}
+	return resp.GetAccessToken()
+}
+
+func Test_Accounts(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(s)
+	ctx := context.Background()
+	accessToken := link(t, s, client)
+
+	resp, _, err := client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(*plaid.NewAccountsGetRequest(accessToken)).Execute()
+	if err != nil {
+		t.Fatalf("error getting accounts: %v", err)
+	}
+	if len(resp.GetAccounts()) != 2 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 2, len(resp.GetAccounts()))
+	}
+
+	options := plaid.NewAccountsGetRequestOptions()
+	options.SetAccountIds([]string{"acc-savings"})
+	req := plaid.NewAccountsGetRequest(accessToken)
+	req.SetOptions(*options)
+	resp, _, err = client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(*req).Execute()
+	if err != nil {
+		t.Fatalf("error getting accounts: %v", err)
+	}
+	accounts := resp.GetAccounts()
+	if len(accounts) != 1 || accounts[0].GetAccountId() != "acc-savings" {
+		t.Errorf("Expected only acc-savings, got %v", accounts)
+	}
+	if current := accounts[0].Balances.GetCurrent(); current != 210 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 210, current)
+	}
+	if sent := s.LastRequest("/accounts/get"); sent["access_token"] != accessToken || sent["options"] == nil {
+		t.Errorf("Unexpected last request %v", sent)
+	}
+
+	_, _, err = client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(*plaid.NewAccountsGetRequest("bogus")).Execute()
+	plaidErr, err := plaid.ToPlaidError(err)
+	if err != nil || plaidErr.ErrorCode != "INVALID_ACCESS_TOKEN" {
+		t.Errorf("Expected INVALID_ACCESS_TOKEN, got %v %v", plaidErr.ErrorCode, err)
+	}
+}
+
+func Test_TransactionsSync(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(s)
+	ctx := context.Background()
+	accessToken := link(t, s, client)
+
+	var added []string
+	cursor := ""
+	for {
+		req := plaid.NewTransactionsSyncRequest(accessToken)
+		if cursor != "" {
+			req.SetCursor(cursor)
+		}
+		resp, _, err := client.PlaidApi.TransactionsSync(ctx).TransactionsSyncRequest(*req).Execute()
+		if err != nil {
+			t.Fatalf("error syncing transactions: %v", err)
+		}
+		for _, tx := range resp.GetAdded() {
+			added = append(added, tx.GetTransactionId())
+		}
+		cursor = resp.GetNextCursor()
+		if !resp.GetHasMore() {
+			break
+		}
+	}
+	if len(added) != 4 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 4, added)
+	}
+
+	// pages added later are picked up from the last cursor
+	s.Update(func(f *Fixtures) {
+		f.SyncPages = append(f.SyncPages, SyncPage{Removed: []string{"tx-1"}})
+	})
+	req := plaid.NewTransactionsSyncRequest(accessToken)
+	req.SetCursor(cursor)
+	resp, _, err := client.PlaidApi.TransactionsSync(ctx).TransactionsSyncRequest(*req).Execute()
+	if err != nil {
+		t.Fatalf("error syncing transactions: %v", err)
+	}
+	if removed := resp.GetRemoved(); len(removed) != 1 || removed[0].GetTransactionId() != "tx-1" {
+		t.Errorf("Expected tx-1 to be removed, got %v", removed)
+	}
+}
+
+func Test_FailNext(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(s)
+	ctx := context.Background()
+	accessToken := link(t, s, client)
+
+	s.FailNext("/transactions/sync", Error{ErrorType: "TRANSACTIONS_ERROR", ErrorCode: "TRANSACTIONS_SYNC_MUTATION_DURING_PAGINATION"})
+	_, _, err := client.PlaidApi.TransactionsSync(ctx).TransactionsSyncRequest(*plaid.NewTransactionsSyncRequest(accessToken)).Execute()
+	plaidErr, err := plaid.ToPlaidError(err)
+	if err != nil || plaidErr.ErrorCode != "TRANSACTIONS_SYNC_MUTATION_DURING_PAGINATION" {
+		t.Errorf("Expected injected error, got %v %v", plaidErr.ErrorCode, err)
+	}
+	if _, _, err := client.PlaidApi.TransactionsSync(ctx).TransactionsSyncRequest(*plaid.NewTransactionsSyncRequest(accessToken)).Execute(); err != nil {
+		t.Errorf("Expected only one failure, got %v", err)
+	}
+	if calls := s.Calls("/transactions/sync"); calls != 2 {
+		t.Errorf("Data mismatch, expected:  %v got: %v", 2, calls)
+	}
+}
+
+func Test_AssetReport(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(s)
+	ctx := context.Background()
+	accessToken := link(t, s, client)
+
+	created, _, err := client.PlaidApi.AssetReportCreate(ctx).AssetReportCreateRequest(
+		*plaid.NewAssetReportCreateRequest([]string{accessToken}, 10),
+	).Execute()
+	if err != nil {
+		t.Fatalf("error creating asset report: %v", err)
+	}
+	get := func() error {
+		_, _, err := client.PlaidApi.AssetReportGet(ctx).AssetReportGetRequest(
+			*plaid.NewAssetReportGetRequest(created.GetAssetReportToken()),
+		).Execute()
+		return err
+	}
+	plaidErr, err := plaid.ToPlaidError(get())
+	if err != nil || plaidErr.ErrorCode != "PRODUCT_NOT_READY" {
+		t.Errorf("Expected PRODUCT_NOT_READY, got %v %v", plaidErr.ErrorCode, err)
+	}
+	if err := get(); err != nil {
+		t.Errorf("Expected report to be ready, got %v", err)
+	}
+}
+
+func Test_AssetReportRemove(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Update(func(f *Fixtures) { f.AssetReportPolls = 0 })
+	client := newClient(s)
+	ctx := context.Background()
+	accessToken := link(t, s, client)
+
+	created, _, err := client.PlaidApi.AssetReportCreate(ctx).AssetReportCreateRequest(
+		*plaid.NewAssetReportCreateRequest([]string{accessToken}, 10),
+	).Execute()
+	if err != nil {
+		t.Fatalf("error creating asset report: %v", err)
+	}
+	auditCopy, _, err := client.PlaidApi.AssetReportAuditCopyCreate(ctx).AssetReportAuditCopyCreateRequest(
+		*plaid.NewAssetReportAuditCopyCreateRequest(created.GetAssetReportToken(), "fannie_mae"),
+	).Execute()
+	if err != nil {
+		t.Fatalf("error creating audit copy: %v", err)
+	}
+	if _, _, err := client.PlaidApi.AssetReportRemove(ctx).AssetReportRemoveRequest(
+		*plaid.NewAssetReportRemoveRequest(created.GetAssetReportToken()),
+	).Execute(); err != nil {
+		t.Fatalf("error removing asset report: %v", err)
+	}
+
+	// the audit copies of a removed report are removed with it
+	_, _, err = client.PlaidApi.AssetReportAuditCopyRemove(ctx).AssetReportAuditCopyRemoveRequest(
+		*plaid.NewAssetReportAuditCopyRemoveRequest(auditCopy.GetAuditCopyToken()),
+	).Execute()
+	if plaidErr, perr := plaid.ToPlaidError(err); perr != nil || plaidErr.ErrorCode != "INVALID_AUDIT_COPY_TOKEN" {
+		t.Errorf("Expected INVALID_AUDIT_COPY_TOKEN, got %v", err)
+	}
+	_, _, err = client.PlaidApi.AssetReportRefresh(ctx).AssetReportRefreshRequest(
+		*plaid.NewAssetReportRefreshRequest(created.GetAssetReportToken()),
+	).Execute()
+	if plaidErr, perr := plaid.ToPlaidError(err); perr != nil || plaidErr.ErrorCode != "INVALID_ASSET_REPORT_TOKEN" {
+		t.Errorf("Expected INVALID_ASSET_REPORT_TOKEN, got %v", err)
+	}
+}
+
+func Test_SignWebhook(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(s)
+	v := webhook.NewVerifier(func(ctx context.Context, kid string) (*webhook.Key, error) {
+		resp, _, err := client.PlaidApi.WebhookVerificationKeyGet(ctx).WebhookVerificationKeyGetRequest(
+			*plaid.NewWebhookVerificationKeyGetRequest(kid),
+		).Execute()
+		if err != nil {
+			return nil, err
+		}
+		key, err := webhook.PublicKey(resp.Key.Crv, resp.Key.X, resp.Key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &webhook.Key{PublicKey: key}, nil
+	})
+	body := []byte(`{"webhook_type":"TRANSACTIONS","webhook_code":"SYNC_UPDATES_AVAILABLE"}`)
+	if err := v.Verify(context.Background(), s.SignWebhook(body), body); err != nil {
+		t.Errorf("Expected valid webhook, got %v", err)
+	}
+}
+
+func Test_APIKeys(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	resp, err := http.Post(s.URL+"/accounts/get", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %v\tGot %v: %s", http.StatusBadRequest, resp.StatusCode, body)
+	}
+}
+
+func Test_BreakItem(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(s)
+	ctx := context.Background()
+	accessToken := link(t, s, client)
+	itemResp, _, err := client.PlaidApi.ItemGet(ctx).ItemGetRequest(*plaid.NewItemGetRequest(accessToken)).Execute()
+	if err != nil {
+		t.Fatalf("error getting item: %v", err)
+	}
+	itemID := itemResp.GetItem().ItemId
+
+	s.BreakItem(itemID, "ITEM_LOGIN_REQUIRED")
+	_, _, err = client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(*plaid.NewAccountsGetRequest(accessToken)).Execute()
+	if plaidErr, err := plaid.ToPlaidError(err); err != nil || plaidErr.ErrorCode != "ITEM_LOGIN_REQUIRED" {
+		t.Errorf("Expected ITEM_LOGIN_REQUIRED, got %v %v", plaidErr.ErrorCode, err)
+	}
+	itemResp, _, err = client.PlaidApi.ItemGet(ctx).ItemGetRequest(*plaid.NewItemGetRequest(accessToken)).Execute()
+	if err != nil {
+		t.Fatalf("error getting item: %v", err)
+	}
+	if itemErr := itemResp.GetItem().Error.Get(); itemErr == nil || itemErr.ErrorCode != "ITEM_LOGIN_REQUIRED" {
+		t.Errorf("Expected the item error, got %v", itemErr)
+	}
+
+	s.RepairItem(itemID)
+	if _, _, err := client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(*plaid.NewAccountsGetRequest(accessToken)).Execute(); err != nil {
+		t.Errorf("error getting accounts of the repaired item: %v", err)
+	}
+
+	expiration := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.Update(func(f *Fixtures) { f.ConsentExpiration = expiration })
+	itemResp, _, err = client.PlaidApi.ItemGet(ctx).ItemGetRequest(*plaid.NewItemGetRequest(accessToken)).Execute()
+	if err != nil {
+		t.Fatalf("error getting item: %v", err)
+	}
+	if got := itemResp.GetItem().ConsentExpirationTime.Get(); got == nil || !got.Equal(expiration) {
+		t.Errorf("Data mismatch, expected:  %v got: %v", expiration, got)
+	}
+}
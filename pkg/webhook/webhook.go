@@ -0,0 +1,227 @@
+package webhook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxAge is how old a webhook may be before it is rejected as stale.
+	MaxAge = 5 * time.Minute
+	// KeyTTL is how long a fetched key is cached before it is fetched again,
+	// so keys Plaid expires are noticed.
+	KeyTTL = time.Hour
+	// UnknownKeyTTL is how long a key id that could not be fetched is
+	// rejected without fetching it again.
+	UnknownKeyTTL = time.Minute
+	// UnknownKeyInterval is the least time between fetches of key ids never
+	// seen before, so webhooks with made up key ids can not flood Plaid.
+	UnknownKeyInterval = 10 * time.Second
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid webhook verification token")
+	ErrKeyExpired   = errors.New("webhook verification key expired")
+	ErrStale        = errors.New("webhook is too old")
+	ErrBodyMismatch = errors.New("webhook body does not match its signature")
+	ErrUnknownKey   = errors.New("unknown webhook verification key")
+)
+
+// Key is a webhook verification key as returned by
+// /webhook_verification_key/get.
+type Key struct {
+	PublicKey *ecdsa.PublicKey
+	// ExpiredAt is set once the key has been rotated out by Plaid.
+	ExpiredAt *time.Time
+}
+
+// KeyFunc fetches the verification key with the given key id.
+type KeyFunc func(ctx context.Context, kid string) (*Key, error)
+
+// Verifier checks the Plaid-Verification JWT sent along with webhooks.
+// Verification keys are cached by key id for KeyTTL, and key ids that could
+// not be fetched for UnknownKeyTTL.
+type Verifier struct {
+	fetch KeyFunc
+	now   func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]*cachedKey
+	// lastUnknown is when a key id never seen before was last fetched.
+	lastUnknown time.Time
+}
+
+// cachedKey is a fetched key, or the error fetching it.
+type cachedKey struct {
+	key       *Key
+	err       error
+	fetchedAt time.Time
+}
+
+func NewVerifier(fetch KeyFunc) *Verifier {
+	return &Verifier{
+		fetch: fetch,
+		now:   time.Now,
+		keys:  map[string]*cachedKey{},
+	}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+type claims struct {
+	IssuedAt          int64  `json:"iat"`
+	RequestBodySHA256 string `json:"request_body_sha256"`
+}
+
+// Verify checks that token is an ES256 JWT signed by a current Plaid key, that
+// it was issued within MaxAge, and that it was issued for body.
+func (v *Verifier) Verify(ctx context.Context, token string, body []byte) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return err
+	}
+	if h.Alg != "ES256" || h.Kid == "" {
+		return ErrInvalidToken
+	}
+
+	key, err := v.key(ctx, h.Kid)
+	if err != nil {
+		return err
+	}
+	if key.expired(v.now()) {
+		return ErrKeyExpired
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return ErrInvalidToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(key.PublicKey, digest[:], r, s) {
+		return ErrInvalidToken
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return err
+	}
+	if v.now().Sub(time.Unix(c.IssuedAt, 0)) > MaxAge {
+		return ErrStale
+	}
+	bodySum := sha256.Sum256(body)
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(bodySum[:])), []byte(c.RequestBodySHA256)) != 1 {
+		return ErrBodyMismatch
+	}
+	return nil
+}
+
+// expired tells if the key was rotated out by now.
+func (k *Key) expired(now time.Time) bool {
+	return k.ExpiredAt != nil && !k.ExpiredAt.After(now)
+}
+
+// key returns the key for kid, fetching it on first use and once its cache
+// entry is older than KeyTTL. Expired keys stay expired and are not fetched
+// again. A cached key is still used if fetching it again fails.
+func (v *Verifier) key(ctx context.Context, kid string) (*Key, error) {
+	now := v.now()
+	v.mu.Lock()
+	cached, ok := v.keys[kid]
+	switch {
+	case ok && cached.key != nil && (now.Sub(cached.fetchedAt) < KeyTTL || cached.key.expired(now)):
+		v.mu.Unlock()
+		return cached.key, nil
+	case ok && cached.key == nil && now.Sub(cached.fetchedAt) < UnknownKeyTTL:
+		v.mu.Unlock()
+		return nil, cached.err
+	case !ok && now.Sub(v.lastUnknown) < UnknownKeyInterval:
+		v.mu.Unlock()
+		return nil, ErrUnknownKey
+	case !ok:
+		v.lastUnknown = now
+	}
+	v.mu.Unlock()
+
+	key, err := v.fetch(ctx, kid)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch {
+	case err == nil:
+		v.keys[kid] = &cachedKey{key: key, fetchedAt: now}
+		return key, nil
+	case ok && cached.key != nil:
+		return cached.key, nil
+	case ctx.Err() == nil:
+		v.pruneUnknown(now)
+		v.keys[kid] = &cachedKey{err: err, fetchedAt: now}
+	}
+	return nil, err
+}
+
+// pruneUnknown drops the key ids that could not be fetched longer than
+// UnknownKeyTTL ago. Callers hold v.mu.
+func (v *Verifier) pruneUnknown(now time.Time) {
+	for kid, cached := range v.keys {
+		if cached.key == nil && now.Sub(cached.fetchedAt) >= UnknownKeyTTL {
+			delete(v.keys, kid)
+		}
+	}
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// PublicKey builds a P-256 public key from the base64url encoded coordinates
+// of a JWK.
+func PublicKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	if crv != "P-256" {
+		return nil, fmt.Errorf("unsupported curve %s", crv)
+	}
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(xb),
+		Y:     new(big.Int).SetBytes(yb),
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("invalid public key")
+	}
+	return key, nil
+}
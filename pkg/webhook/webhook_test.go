@@ -0,0 +1,165 @@
+package webhook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, kid string, iat time.Time, body []byte) string {
+	t.Helper()
+	h, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": kid, "typ": "JWT"})
+	sum := sha256.Sum256(body)
+	c, _ := json.Marshal(map[string]interface{}{
+		"iat":                 iat.Unix(),
+		"request_body_sha256": hex.EncodeToString(sum[:]),
+	})
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func Test_Verify(t *testing.T) {
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fetches := 0
+	v := NewVerifier(func(ctx context.Context, kid string) (*Key, error) {
+		fetches++
+		if kid != "kid-1" {
+			return nil, errors.New("unknown kid")
+		}
+		return &Key{PublicKey: &priv.PublicKey}, nil
+	})
+	body := []byte(`{"webhook_type":"TRANSACTIONS","webhook_code":"SYNC_UPDATES_AVAILABLE"}`)
+	ctx := context.Background()
+
+	token := sign(t, priv, "kid-1", time.Now(), body)
+	if err := v.Verify(ctx, token, body); err != nil {
+		t.Errorf("Expected valid webhook, got %v", err)
+	}
+	if err := v.Verify(ctx, token, body); err != nil {
+		t.Errorf("Expected valid webhook, got %v", err)
+	}
+	if fetches != 1 {
+		t.Errorf("Expected key to be cached, fetched %d times", fetches)
+	}
+
+	if err := v.Verify(ctx, token, []byte(`{"webhook_type":"ITEM"}`)); err != ErrBodyMismatch {
+		t.Errorf("Expected %v, got %v", ErrBodyMismatch, err)
+	}
+
+	stale := sign(t, priv, "kid-1", time.Now().Add(-10*time.Minute), body)
+	if err := v.Verify(ctx, stale, body); err != ErrStale {
+		t.Errorf("Expected %v, got %v", ErrStale, err)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged := sign(t, other, "kid-1", time.Now(), body)
+	if err := v.Verify(ctx, forged, body); err != ErrInvalidToken {
+		t.Errorf("Expected %v, got %v", ErrInvalidToken, err)
+	}
+
+	if err := v.Verify(ctx, "not-a-jwt", body); err != ErrInvalidToken {
+		t.Errorf("Expected %v, got %v", ErrInvalidToken, err)
+	}
+}
+
+func Test_VerifyExpiredKey(t *testing.T) {
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	expired := time.Now().Add(-time.Hour)
+	v := NewVerifier(func(ctx context.Context, kid string) (*Key, error) {
+		return &Key{PublicKey: &priv.PublicKey, ExpiredAt: &expired}, nil
+	})
+	body := []byte(`{}`)
+	if err := v.Verify(context.Background(), sign(t, priv, "kid-1", time.Now(), body), body); err != ErrKeyExpired {
+		t.Errorf("Expected %v, got %v", ErrKeyExpired, err)
+	}
+}
+
+func Test_VerifyKeyCache(t *testing.T) {
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Now()
+	var expiredAt *time.Time
+	fetches := map[string]int{}
+	v := NewVerifier(func(ctx context.Context, kid string) (*Key, error) {
+		fetches[kid]++
+		if kid != "kid-1" {
+			return nil, errors.New("unknown kid")
+		}
+		return &Key{PublicKey: &priv.PublicKey, ExpiredAt: expiredAt}, nil
+	})
+	v.now = func() time.Time { return now }
+	body := []byte(`{}`)
+	verify := func(kid string) error {
+		return v.Verify(context.Background(), sign(t, priv, kid, now, body), body)
+	}
+
+	if err := verify("kid-1"); err != nil {
+		t.Errorf("Expected valid webhook, got %v", err)
+	}
+	now = now.Add(KeyTTL / 2)
+	verify("kid-1")
+	if fetches["kid-1"] != 1 {
+		t.Errorf("Expected the key to be cached, fetched %d times", fetches["kid-1"])
+	}
+	// keys are fetched again after KeyTTL, and their expiration honored
+	expired := now
+	expiredAt = &expired
+	now = now.Add(KeyTTL)
+	if err := verify("kid-1"); err != ErrKeyExpired || fetches["kid-1"] != 2 {
+		t.Errorf("Expected %v after 2 fetches, got %v after %v", ErrKeyExpired, err, fetches["kid-1"])
+	}
+	now = now.Add(2 * KeyTTL)
+	if err := verify("kid-1"); err != ErrKeyExpired || fetches["kid-1"] != 2 {
+		t.Errorf("Expected expired keys not to be fetched again, got %v after %v fetches", err, fetches["kid-1"])
+	}
+
+	// unknown key ids are not fetched again for a while, and new ones are
+	// fetched at most every UnknownKeyInterval
+	if err := verify("kid-2"); err == nil {
+		t.Errorf("Expected error for unknown kid")
+	}
+	verify("kid-2")
+	if err := verify("kid-3"); err != ErrUnknownKey {
+		t.Errorf("Expected %v, got %v", ErrUnknownKey, err)
+	}
+	if fetches["kid-2"] != 1 || fetches["kid-3"] != 0 {
+		t.Errorf("Unexpected fetches %v", fetches)
+	}
+	now = now.Add(UnknownKeyTTL)
+	verify("kid-2")
+	verify("kid-3")
+	if fetches["kid-2"] != 2 || fetches["kid-3"] != 1 {
+		t.Errorf("Unexpected fetches %v", fetches)
+	}
+}
+
+func Test_PublicKey(t *testing.T) {
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	x := base64.RawURLEncoding.EncodeToString(priv.PublicKey.X.Bytes())
+	y := base64.RawURLEncoding.EncodeToString(priv.PublicKey.Y.Bytes())
+	key, err := PublicKey("P-256", x, y)
+	if err != nil {
+		t.Fatalf("Error building key: %v", err)
+	}
+	if !key.Equal(&priv.PublicKey) {
+		t.Errorf("Key mismatch")
+	}
+	if _, err := PublicKey("P-384", x, y); err == nil {
+		t.Errorf("Expected error for unsupported curve")
+	}
+}
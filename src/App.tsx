@@ -1,17 +1,23 @@
-import React, { useEffect, useContext, useCallback } from "react";
+import React, { useEffect, useContext, useCallback, useState } from "react";
 
 import Header from "./Components/Headers";
 import Products from "./Components/ProductTypes/Products";
 import Items from "./Components/ProductTypes/Items";
+import Login from "./Components/Login";
 import Context from "./Context";
 
 import styles from "./App.module.scss";
 
 const App = () => {
   const { linkSuccess, isItemAccess, dispatch } = useContext(Context);
+  const [needsLogin, setNeedsLogin] = useState(false);
 
   const getInfo = useCallback(async () => {
     const response = await fetch("/api/info", { method: "POST" });
+    if (response.status === 401) {
+      setNeedsLogin(true);
+      return null;
+    }
     if (!response.ok) {
       dispatch({ type: "SET_STATE", state: { backend: false } });
       return { paymentInitiation: false };
@@ -37,11 +43,12 @@ const App = () => {
       const response = await fetch(path, {
         method: "POST",
       });
-      if (!response.ok) {
+      // errors come back as JSON with a 4xx or 5xx status
+      const data = await response.json().catch(() => null);
+      if (!response.ok && (data == null || data.error == null)) {
         dispatch({ type: "SET_STATE", state: { linkToken: null } });
         return;
       }
-      const data = await response.json();
       if (data) {
         if (data.error != null) {
           dispatch({
@@ -55,21 +62,44 @@ const App = () => {
         }
         dispatch({ type: "SET_STATE", state: { linkToken: data.link_token } });
       }
-      localStorage.setItem("link_token", data.link_token); //to use later for Oauth
     },
     [dispatch]
   );
 
   useEffect(() => {
+    if (needsLogin) {
+      return;
+    }
     const init = async () => {
-      const { paymentInitiation } = await getInfo(); // used to determine which path to take when generating token
-      // do not generate a new token for OAuth redirect; instead
-      // setLinkToken from localStorage
-      if (window.location.href.includes("?oauth_state_id=")) {
+      const info = await getInfo();
+      if (info == null) {
+        return;
+      }
+      const { paymentInitiation } = info; // used to determine which path to take when generating token
+      // do not generate a new token for OAuth redirect; instead resume Link
+      // with the token the server kept for this session
+      const oauthStateId = new URLSearchParams(window.location.search).get(
+        "oauth_state_id"
+      );
+      if (oauthStateId != null) {
+        const response = await fetch(
+          `/api/oauth/link_token?oauth_state_id=${encodeURIComponent(
+            oauthStateId
+          )}`
+        );
+        const data = await response.json().catch(() => null);
+        if (!response.ok || data == null) {
+          dispatch({
+            type: "SET_STATE",
+            state: { linkToken: null, linkTokenError: data?.error },
+          });
+          return;
+        }
         dispatch({
           type: "SET_STATE",
           state: {
-            linkToken: localStorage.getItem("link_token"),
+            linkToken: data.link_token,
+            receivedRedirectUri: data.received_redirect_uri,
           },
         });
         return;
@@ -77,12 +107,16 @@ const App = () => {
       generateToken(paymentInitiation);
     };
     init();
-  }, [dispatch, generateToken, getInfo]);
+  }, [dispatch, generateToken, getInfo, needsLogin]);
 
   return (
     <div className={styles.App}>
       <div className={styles.container}>
-        <Header />
+        {needsLogin ? (
+          <Login onLogin={() => setNeedsLogin(false)} />
+        ) : (
+          <Header />
+        )}
         {linkSuccess && isItemAccess && (
           <>
             <Products />
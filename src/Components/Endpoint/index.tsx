@@ -24,10 +24,51 @@ const Endpoint = (props: Props) => {
   const [error, setError] = useState<ErrorDataItem | null>(null);
   const [isLoading, setIsLoading] = useState(false);
 
+  // asset reports are generated by a job: start it, wait for the report to
+  // be ready, then fetch its JSON. The PDF is downloaded from its own URL.
+  const getAssetReport = async () => {
+    const response = await fetch(`/api/assets`, { method: "POST" });
+    let job = await response.json();
+    while (job.error == null && job.status === "pending") {
+      await new Promise((resolve) => setTimeout(resolve, 2000));
+      const status = await fetch(`/api/assets?job_id=${job.job_id}`, {
+        method: "GET",
+      });
+      job = await status.json();
+    }
+    if (job.error != null) {
+      return job;
+    }
+    if (job.status !== "ready") {
+      return {
+        error: {
+          error_type: "ASSET_REPORT_ERROR",
+          error_code: job.error_code,
+          error_message: "the asset report failed",
+          display_message: null,
+          status_code: null,
+        },
+      };
+    }
+    const report = await fetch(`/api/assets/report?job_id=${job.job_id}`, {
+      method: "GET",
+    });
+    const json = await report.json();
+    if (json.error != null) {
+      return json;
+    }
+    return { json, pdf: `/api/assets/pdf?job_id=${job.job_id}` };
+  };
+
   const getData = async () => {
     setIsLoading(true);
-    const response = await fetch(`/api/${props.endpoint}`, { method: "GET" });
-    const data = await response.json();
+    let data;
+    if (props.endpoint === "assets") {
+      data = await getAssetReport();
+    } else {
+      const response = await fetch(`/api/${props.endpoint}`, { method: "GET" });
+      data = await response.json();
+    }
     if (data.error != null) {
       setError(data.error);
       setIsLoading(false);
@@ -73,7 +114,7 @@ const Endpoint = (props: Props) => {
               centered
               wide
               className={styles.pdf}
-              href={`data:application/pdf;base64,${pdf}`}
+              href={pdf}
               componentProps={{ download: "Asset Report.pdf" }}
             >
               Download PDF
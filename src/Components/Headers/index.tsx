@@ -11,7 +11,6 @@ import styles from "./index.module.scss";
 const Header = () => {
   const {
     itemId,
-    accessToken,
     linkToken,
     linkSuccess,
     isItemAccess,
@@ -113,15 +112,10 @@ const Header = () => {
               <span className={styles.idName}>item_id</span>
               <span className={styles.tokenText}>{itemId}</span>
             </p>
-
-            <p className={styles.itemAccessRow}>
-              <span className={styles.idName}>access_token</span>
-              <span className={styles.tokenText}>{accessToken}</span>
-            </p>
           </div>
           {isItemAccess && (
             <p className={styles.requests}>
-              Now that you have an access_token, you can make all of the
+              Now that you have linked an item, you can make all of the
               following requests:
             </p>
           )}
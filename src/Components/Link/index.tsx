@@ -5,7 +5,7 @@ import Button from "plaid-threads/Button";
 import Context from "../../Context";
 
 const Link = () => {
-  const { linkToken, dispatch } = useContext(Context);
+  const { linkToken, receivedRedirectUri, dispatch } = useContext(Context);
 
   const onSuccess = React.useCallback(
     (public_token: string) => {
@@ -23,7 +23,6 @@ const Link = () => {
             type: "SET_STATE",
             state: {
               itemId: `no item_id retrieved`,
-              accessToken: `no access_token retrieved`,
               isItemAccess: false,
             },
           });
@@ -34,7 +33,6 @@ const Link = () => {
           type: "SET_STATE",
           state: {
             itemId: data.item_id,
-            accessToken: data.access_token,
             isItemAccess: true,
           },
         });
@@ -52,10 +50,10 @@ const Link = () => {
     onSuccess,
   };
 
-  if (window.location.href.includes("?oauth_state_id=")) {
+  if (receivedRedirectUri != null) {
     // TODO: figure out how to delete this ts-ignore
     // @ts-ignore
-    config.receivedRedirectUri = window.location.href;
+    config.receivedRedirectUri = receivedRedirectUri;
     isOauth = true;
   }
 
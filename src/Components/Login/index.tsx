@@ -0,0 +1,65 @@
+import React, { useState } from "react";
+import Button from "plaid-threads/Button";
+import Callout from "plaid-threads/Callout";
+
+import styles from "./index.module.scss";
+
+interface Props {
+  onLogin: () => void;
+}
+
+// Login asks for the email and password of a user and opens a session, kept
+// in an HTTP-only cookie sent with every later /api request.
+const Login = (props: Props) => {
+  const [email, setEmail] = useState("");
+  const [password, setPassword] = useState("");
+  const [error, setError] = useState<string | null>(null);
+
+  const login = async (event: React.FormEvent) => {
+    event.preventDefault();
+    const response = await fetch("/api/login", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/x-www-form-urlencoded;charset=UTF-8",
+      },
+      body: new URLSearchParams({ email, password }).toString(),
+    });
+    if (!response.ok) {
+      const data = await response.json().catch(() => null);
+      setError(data?.error?.error_message ?? "unable to log in");
+      return;
+    }
+    setError(null);
+    props.onLogin();
+  };
+
+  return (
+    <form className={styles.login} onSubmit={login}>
+      <h4 className={styles.title}>Log in to link your accounts</h4>
+      <input
+        className={styles.input}
+        type="email"
+        placeholder="email"
+        autoComplete="username"
+        value={email}
+        onChange={(e) => setEmail(e.target.value)}
+      />
+      <input
+        className={styles.input}
+        type="password"
+        placeholder="password"
+        autoComplete="current-password"
+        value={password}
+        onChange={(e) => setPassword(e.target.value)}
+      />
+      <Button small centered type="submit">
+        Log in
+      </Button>
+      {error != null && <Callout warning>{error}</Callout>}
+    </form>
+  );
+};
+
+Login.displayName = "Login";
+
+export default Login;
@@ -4,7 +4,8 @@ interface QuickstartState {
   linkSuccess: boolean;
   isItemAccess: boolean;
   linkToken: string | null;
-  accessToken: string | null;
+  // set when Link resumes after the OAuth flow of an institution
+  receivedRedirectUri: string | null;
   itemId: string | null;
   isError: boolean;
   backend: boolean;
@@ -20,7 +21,7 @@ const initialState: QuickstartState = {
   linkSuccess: false,
   isItemAccess: true,
   linkToken: "", // Don't set to null or error message will show up briefly when site loads
-  accessToken: null,
+  receivedRedirectUri: null,
   itemId: null,
   isError: false,
   backend: true,